@@ -0,0 +1,146 @@
+// Package anomaly scores the latest count of a time series against a
+// baseline learned from the counts before it, so that OgLogStream services
+// can flag unusual log volume without static thresholds.
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Method selects how the baseline is learned
+type Method string
+
+const (
+	// MethodEWMA follows the exponentially weighted mean and deviation of
+	// the whole history, adapting quickly to trends
+	MethodEWMA Method = "ewma"
+	// MethodSeasonal takes the median and median absolute deviation of the
+	// same point of previous seasons, such as the same hour of past days
+	MethodSeasonal Method = "seasonal"
+)
+
+const (
+	DefaultAlpha = 0.3
+
+	minEWMAHistory     = 5 // points before the scored one
+	minSeasonalHistory = 3 // seasons before the scored one
+)
+
+// Config selects and tunes a method
+type Config struct {
+	Method Method
+	Alpha  float64 // EWMA weight of the newest point, in (0, 1], DefaultAlpha when zero
+	Season int     // seasonal: points per season, e.g. 24 for hourly points and daily cycles
+}
+
+// Validate checks c and fills in defaults
+func (c *Config) Validate() error {
+	switch c.Method {
+	case "":
+		c.Method = MethodEWMA
+	case MethodEWMA, MethodSeasonal:
+	default:
+		return fmt.Errorf("invalid method %q, expected ewma or seasonal", c.Method)
+	}
+	if c.Alpha == 0 {
+		c.Alpha = DefaultAlpha
+	}
+	if c.Alpha < 0 || c.Alpha > 1 {
+		return fmt.Errorf("alpha must be between 0 and 1")
+	}
+	if c.Method == MethodSeasonal && c.Season < 1 {
+		return fmt.Errorf("seasonal baselines need a season of at least one point")
+	}
+	return nil
+}
+
+// MinPoints is the length of the shortest series c scores, the scored
+// point included
+func (c Config) MinPoints() int {
+	if c.Method == MethodSeasonal {
+		return minSeasonalHistory*c.Season + 1
+	}
+	return minEWMAHistory + 1
+}
+
+// Score is the last point of a series against its baseline
+type Score struct {
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"`
+	Spread   float64 `json:"spread"` // expected deviation from the baseline
+	Score    float64 `json:"score"`  // (Value - Baseline) / Spread, negative for drops
+}
+
+// Detect scores the last of values against the ones before it. It returns
+// false when there are fewer than c.MinPoints values. The spread is at least
+// the square root of the baseline, the deviation of random arrivals at that
+// rate, so quiet series don't flag single entries.
+func Detect(values []float64, c Config) (Score, bool) {
+	if len(values) < c.MinPoints() {
+		return Score{}, false
+	}
+	history, value := values[:len(values)-1], values[len(values)-1]
+
+	var baseline, spread float64
+	switch c.Method {
+	case MethodSeasonal:
+		var same []float64
+		for i := len(history) - c.Season; i >= 0; i -= c.Season {
+			same = append(same, history[i])
+		}
+		baseline = median(same)
+		deviations := make([]float64, len(same))
+		for i, v := range same {
+			deviations[i] = math.Abs(v - baseline)
+		}
+		// Scaled to match the standard deviation of normal data
+		spread = 1.4826 * median(deviations)
+	default:
+		baseline = history[0]
+		var variance float64
+		for _, v := range history[1:] {
+			diff := v - baseline
+			baseline += c.Alpha * diff
+			variance = (1 - c.Alpha) * (variance + c.Alpha*diff*diff)
+		}
+		spread = math.Sqrt(variance)
+	}
+
+	spread = math.Max(spread, math.Sqrt(math.Max(baseline, 1)))
+	return Score{Value: value, Baseline: baseline, Spread: spread, Score: (value - baseline) / spread}, true
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Series collects counts into consecutive steps
+type Series struct {
+	Start  time.Time
+	Step   time.Duration
+	Values []float64
+}
+
+// NewSeries returns n zero steps from start
+func NewSeries(start time.Time, step time.Duration, n int) *Series {
+	return &Series{Start: start, Step: step, Values: make([]float64, n)}
+}
+
+// Add counts n at t, ignoring times outside the series
+func (s *Series) Add(t time.Time, n float64) {
+	if t.Before(s.Start) {
+		return
+	}
+	if i := int(t.Sub(s.Start) / s.Step); i < len(s.Values) {
+		s.Values[i] += n
+	}
+}
@@ -0,0 +1,101 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDetectEWMA(t *testing.T) {
+	c := Config{}
+	if err := c.Validate(); err != nil || c.Method != MethodEWMA || c.Alpha != DefaultAlpha {
+		t.Fatalf("unexpected defaults %+v (%v)", c, err)
+	}
+
+	steady := []float64{100, 104, 96, 101, 99, 102, 98, 100}
+	s, ok := Detect(append(steady, 101), c)
+	if !ok || math.Abs(s.Score) > 1 {
+		t.Errorf("expected a normal point, got %+v", s)
+	}
+	s, _ = Detect(append(steady, 200), c)
+	if s.Score < 5 || math.Abs(s.Baseline-100) > 2 {
+		t.Errorf("expected a spike well above a baseline of 100, got %+v", s)
+	}
+	s, _ = Detect(append(steady, 10), c)
+	if s.Score > -5 {
+		t.Errorf("expected a drop, got %+v", s)
+	}
+
+	if _, ok := Detect([]float64{1, 2, 3, 4, 5}, c); ok {
+		t.Error("expected too short a history to be rejected")
+	}
+}
+
+func TestDetectQuietSeries(t *testing.T) {
+	// A flat zero history has no deviation; the floor keeps one entry normal
+	s, ok := Detect([]float64{0, 0, 0, 0, 0, 0, 1}, Config{Method: MethodEWMA, Alpha: DefaultAlpha})
+	if !ok || s.Spread != 1 || s.Score != 1 {
+		t.Errorf("expected a score of 1 against the floor, got %+v", s)
+	}
+}
+
+func TestDetectSeasonal(t *testing.T) {
+	c := Config{Method: MethodSeasonal, Season: 4}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A daily peak at the last point of each season is normal there
+	var values []float64
+	for day := 0; day < 3; day++ {
+		values = append(values, 10, 12, 11, 500+float64(day))
+	}
+	values = append(values, 10, 11, 12)
+
+	s, ok := Detect(append(values, 503), c)
+	if !ok || s.Baseline != 501 || math.Abs(s.Score) > 1 {
+		t.Errorf("expected the peak to match the same point of past seasons, got %+v", s)
+	}
+	s, _ = Detect(append(values, 50), c)
+	if s.Score > -10 {
+		t.Errorf("expected a missing peak to score as a drop, got %+v", s)
+	}
+	if _, ok := Detect(values[:12], c); ok {
+		t.Error("expected fewer than 3 past seasons to be rejected")
+	}
+
+	// The same values scored by EWMA see the peak as a spike
+	if s, _ := Detect(append(values, 503), Config{Method: MethodEWMA, Alpha: DefaultAlpha}); s.Score < 1 {
+		t.Errorf("expected EWMA to ignore seasons, got %+v", s)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Method: "median"},
+		{Alpha: 1.5},
+		{Method: MethodSeasonal},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	start := time.Date(2025, 7, 24, 0, 0, 0, 0, time.UTC)
+	s := NewSeries(start, time.Hour, 3)
+	s.Add(start, 1)
+	s.Add(start.Add(90*time.Minute), 2)
+	s.Add(start.Add(time.Hour), 3)
+	s.Add(start.Add(-time.Hour), 10)
+	s.Add(start.Add(3*time.Hour), 10)
+
+	expected := []float64{1, 5, 0}
+	for i, v := range expected {
+		if s.Values[i] != v {
+			t.Errorf("expected %v, got %v", expected, s.Values)
+			break
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/yourusername/oglogstream-anomaly
+
+go 1.24.5
@@ -0,0 +1,433 @@
+package logstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const selectColumns = `id, timestamp, level, message, service, attributes, repeat_count, first_seen, last_seen, trace_id, span_id`
+
+// insertColumns adds what is derived from an entry when it is written, and
+// the IDs of collapsed entries, which are only used to look rows up
+const insertColumns = selectColumns + `, pattern_hash, collapsed_ids`
+
+// ClickHouseStore stores entries in the ClickHouse logs table. The caller
+// opens db with the clickhouse driver.
+type ClickHouseStore struct {
+	db *sql.DB
+}
+
+func NewClickHouseStore(db *sql.DB) *ClickHouseStore {
+	return &ClickHouseStore{db: db}
+}
+
+func (s *ClickHouseStore) WriteBatch(ctx context.Context, entries []models.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if token := InsertToken(ctx); token != "" {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+			"insert_deduplication_token": token,
+		}))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO logs (`+insertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		attributes := entry.Attributes
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		firstSeen, lastSeen := entry.FirstSeen, entry.LastSeen
+		if firstSeen.IsZero() {
+			firstSeen = entry.Timestamp
+		}
+		if lastSeen.IsZero() {
+			lastSeen = entry.Timestamp
+		}
+		_, err = stmt.ExecContext(ctx, entry.ID, entry.Timestamp, entry.Level, entry.Message, entry.Service,
+			attributes, uint32(repeatCount(&entry)), firstSeen, lastSeen, entry.TraceID, entry.SpanID, PatternHash(entry.Message),
+			collapsedIDs(&entry))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *ClickHouseStore) StoredIDs(ctx context.Context, entries []models.LogEntry) (map[string]bool, error) {
+	query, args, ok := buildStoredIDs(entries)
+	if !ok {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		stored[id] = true
+	}
+	return stored, rows.Err()
+}
+
+func (s *ClickHouseStore) Search(ctx context.Context, q Query) ([]models.LogEntry, error) {
+	where, args := buildWhere(q)
+	query := `SELECT ` + selectColumns + ` FROM logs` + where +
+		fmt.Sprintf(` ORDER BY timestamp DESC, id DESC LIMIT %d OFFSET %d`, q.limit(), max(q.Offset, 0))
+	return s.queryEntries(ctx, query, args...)
+}
+
+func (s *ClickHouseStore) Tail(ctx context.Context, since time.Time, limit int) ([]models.LogEntry, error) {
+	query := `SELECT ` + selectColumns + ` FROM logs WHERE timestamp > ?` +
+		fmt.Sprintf(` ORDER BY timestamp ASC, id ASC LIMIT %d`, limitOrDefault(limit))
+	return s.queryEntries(ctx, query, since)
+}
+
+// Get also finds the row a burst holding id was collapsed into
+func (s *ClickHouseStore) Get(ctx context.Context, id string) (models.LogEntry, error) {
+	entries, err := s.queryEntries(ctx, `SELECT `+selectColumns+` FROM logs WHERE id = ? OR has(collapsed_ids, ?) LIMIT 1`, id, id)
+	if err != nil {
+		return models.LogEntry{}, err
+	}
+	if len(entries) == 0 {
+		return models.LogEntry{}, ErrNotFound
+	}
+	return entries[0], nil
+}
+
+func (s *ClickHouseStore) Trace(ctx context.Context, traceID string, limit int) ([]models.LogEntry, error) {
+	query := `SELECT ` + selectColumns + ` FROM logs WHERE trace_id = ?` +
+		fmt.Sprintf(` ORDER BY timestamp ASC, id ASC LIMIT %d`, limitOrDefault(limit))
+	return s.queryEntries(ctx, query, traceID)
+}
+
+func (s *ClickHouseStore) Surrounding(ctx context.Context, q SurroundingQuery) ([]models.LogEntry, []models.LogEntry, error) {
+	where, args := buildScope(q)
+	a := q.Anchor
+
+	var before, after []models.LogEntry
+	if n := min(max(q.Before, 0), MaxLimit); n > 0 {
+		query := `SELECT ` + selectColumns + ` FROM logs WHERE timestamp <= ? AND (timestamp < ? OR id < ?)` + where +
+			fmt.Sprintf(` ORDER BY timestamp DESC, id DESC LIMIT %d`, n)
+		entries, err := s.queryEntries(ctx, query, append([]interface{}{a.Timestamp, a.Timestamp, a.ID}, args...)...)
+		if err != nil {
+			return nil, nil, err
+		}
+		slices.Reverse(entries)
+		before = entries
+	}
+	if n := min(max(q.After, 0), MaxLimit); n > 0 {
+		query := `SELECT ` + selectColumns + ` FROM logs WHERE timestamp >= ? AND (timestamp > ? OR id > ?)` + where +
+			fmt.Sprintf(` ORDER BY timestamp ASC, id ASC LIMIT %d`, n)
+		entries, err := s.queryEntries(ctx, query, append([]interface{}{a.Timestamp, a.Timestamp, a.ID}, args...)...)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = entries
+	}
+	return before, after, nil
+}
+
+func (s *ClickHouseStore) Aggregate(ctx context.Context, q AggregateQuery) ([]Bucket, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	query, args, ok := buildRollupAggregate(q, time.Now())
+	if !ok {
+		query, args = buildAggregate("logs", "sum(repeat_count)", q)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []Bucket
+	for rows.Next() {
+		var b Bucket
+		keys := make([]string, len(q.GroupBy))
+		dest := make([]interface{}, 0, len(keys)+2)
+		if q.Interval > 0 {
+			dest = append(dest, &b.Time)
+		}
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &b.Count)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			b.Keys = make(map[string]string, len(keys))
+			for i, field := range q.GroupBy {
+				b.Keys[field] = keys[i]
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+func (s *ClickHouseStore) Patterns(ctx context.Context, q Query) ([]Pattern, error) {
+	where, args := buildWhere(q)
+	if where == "" {
+		where = " WHERE pattern_hash != 0"
+	} else {
+		where += " AND pattern_hash != 0"
+	}
+
+	// Grouping reads hashes rather than messages
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT pattern_hash, sum(repeat_count) AS count, min(first_seen), max(last_seen)
+		FROM logs`+where+`
+		GROUP BY pattern_hash
+		ORDER BY count DESC, pattern_hash
+		LIMIT ?`, append(args, q.limit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []Pattern
+	var hashes []uint64
+	for rows.Next() {
+		var p Pattern
+		var hash uint64
+		if err := rows.Scan(&hash, &p.Count, &p.FirstSeen, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		p.Hash = fmt.Sprintf("%016x", hash)
+		patterns = append(patterns, p)
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	// The query stops reading once every pattern has a sample
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT pattern_hash, message
+		FROM logs`+where+` AND has(?, pattern_hash)
+		LIMIT 1 BY pattern_hash
+		LIMIT ?`, append(args, hashes, len(hashes))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make(map[string]string, len(hashes))
+	for rows.Next() {
+		var hash uint64
+		var message string
+		if err := rows.Scan(&hash, &message); err != nil {
+			return nil, err
+		}
+		samples[fmt.Sprintf("%016x", hash)] = message
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range patterns {
+		patterns[i].Sample = samples[patterns[i].Hash]
+		patterns[i].Template = Template(patterns[i].Sample)
+	}
+	return patterns, nil
+}
+
+// Export streams rows from the driver as they arrive; cancelling ctx cancels
+// the query on the server
+func (s *ClickHouseStore) Export(ctx context.Context, q Query, fn func(*models.LogEntry) error) error {
+	where, args := buildWhere(q)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+selectColumns+` FROM logs`+where+` ORDER BY timestamp ASC, id ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.LogEntry
+		if err := scanEntry(rows, &e); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Facets counts the values of every field in a single query, see buildFacets
+func (s *ClickHouseStore) Facets(ctx context.Context, q FacetQuery) ([]Facet, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	query, args := buildFacets(q)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets, index := newFacets(q.Fields)
+	for rows.Next() {
+		var field string
+		var v FacetValue
+		var total uint64
+		if err := rows.Scan(&field, &v.Value, &v.Count, &total); err != nil {
+			return nil, err
+		}
+		if f := index[field]; f != nil {
+			f.Values = append(f.Values, v)
+			f.Total = total
+		}
+	}
+	return facets, rows.Err()
+}
+
+func (s *ClickHouseStore) queryEntries(ctx context.Context, query string, args ...interface{}) ([]models.LogEntry, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LogEntry
+	for rows.Next() {
+		var e models.LogEntry
+		if err := scanEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// scanEntry reads a row of selectColumns
+func scanEntry(rows *sql.Rows, e *models.LogEntry) error {
+	return rows.Scan(&e.ID, &e.Timestamp, &e.Level, &e.Message, &e.Service,
+		&e.Attributes, &e.RepeatCount, &e.FirstSeen, &e.LastSeen, &e.TraceID, &e.SpanID)
+}
+
+// buildWhere renders the filters of q as a WHERE clause with placeholders
+func buildWhere(q Query) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if q.Level != "" {
+		conditions = append(conditions, "level = ?")
+		args = append(args, q.Level)
+	}
+	if q.Service != "" {
+		conditions = append(conditions, "service ILIKE ?")
+		args = append(args, "%"+escapeLike(q.Service)+"%")
+	}
+	if q.TraceID != "" {
+		conditions = append(conditions, "trace_id = ?")
+		args = append(args, q.TraceID)
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, q.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// buildAggregate renders an aggregation over table counting with countExpr
+func buildAggregate(table, countExpr string, q AggregateQuery) (string, []interface{}) {
+	var columns, groups []string
+	if q.Interval > 0 {
+		columns = append(columns, fmt.Sprintf("toStartOfInterval(timestamp, INTERVAL %d SECOND) AS bucket", int64(q.Interval/time.Second)))
+		groups = append(groups, "bucket")
+	}
+	for _, field := range q.GroupBy {
+		// Group fields are validated against groupColumns
+		columns = append(columns, "toString("+field+") AS "+field)
+		groups = append(groups, field)
+	}
+	columns = append(columns, countExpr+" AS count")
+
+	where, args := buildWhere(q.Query)
+	query := `SELECT ` + strings.Join(columns, ", ") + ` FROM ` + table + where
+	if len(groups) > 0 {
+		query += ` GROUP BY ` + strings.Join(groups, ", ")
+	}
+
+	order := "count DESC"
+	if q.Interval > 0 {
+		order = "bucket ASC, count DESC"
+	}
+	query += ` ORDER BY ` + order
+	if q.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, q.Limit)
+	}
+	return query, args
+}
+
+// buildScope renders the scope of q as additional AND conditions
+func buildScope(q SurroundingQuery) (string, []interface{}) {
+	var where string
+	var args []interface{}
+	if q.Service != "" {
+		where += " AND service = ?"
+		args = append(args, q.Service)
+	}
+	if q.TraceID != "" {
+		where += " AND trace_id = ?"
+		args = append(args, q.TraceID)
+	}
+	keys := make([]string, 0, len(q.Attributes))
+	for k := range q.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		where += " AND attributes[?] = ?"
+		args = append(args, k, q.Attributes[k])
+	}
+	return where, args
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,107 @@
+package logstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultFacetValues = 10
+	MaxFacetValues     = 100
+	MaxFacetFields     = 10
+
+	// AttributePrefix selects an attribute key as a facet field
+	AttributePrefix = "attributes."
+)
+
+var facetColumns = map[string]bool{"level": true, "service": true, "trace_id": true}
+
+// FacetQuery counts the values of Fields among entries matching Query.
+// Limit caps the values returned per field (DefaultFacetValues when zero,
+// at most MaxFacetValues); Offset is ignored.
+type FacetQuery struct {
+	Query
+	Fields []string // any of "level", "service", "trace_id" and "attributes.<key>"
+}
+
+// Facet is the top values of a field, most frequent first
+type Facet struct {
+	Field  string       `json:"field"`
+	Values []FacetValue `json:"values"`
+	Total  uint64       `json:"total"` // entries with a non-empty value, listed or not
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// Validate checks the fields and limit of q, which Facets does too, so
+// callers can tell bad requests from store errors
+func (q FacetQuery) Validate() error {
+	if len(q.Fields) == 0 {
+		return fmt.Errorf("at least one facet field is required")
+	}
+	if len(q.Fields) > MaxFacetFields {
+		return fmt.Errorf("at most %d facet fields are allowed", MaxFacetFields)
+	}
+	seen := make(map[string]bool, len(q.Fields))
+	for _, field := range q.Fields {
+		if !facetColumns[field] && (!strings.HasPrefix(field, AttributePrefix) || field == AttributePrefix) {
+			return fmt.Errorf("cannot facet on %q", field)
+		}
+		if seen[field] {
+			return fmt.Errorf("duplicate facet field %q", field)
+		}
+		seen[field] = true
+	}
+	if q.Limit < 0 || q.Limit > MaxFacetValues {
+		return fmt.Errorf("at most %d values per facet are allowed", MaxFacetValues)
+	}
+	return nil
+}
+
+func (q FacetQuery) limit() int {
+	if q.Limit == 0 {
+		return DefaultFacetValues
+	}
+	return q.Limit
+}
+
+// newFacets returns an empty facet per field, in the order requested
+func newFacets(fields []string) ([]Facet, map[string]*Facet) {
+	facets := make([]Facet, len(fields))
+	index := make(map[string]*Facet, len(fields))
+	for i, field := range fields {
+		facets[i] = Facet{Field: field, Values: []FacetValue{}}
+		index[field] = &facets[i]
+	}
+	return facets, index
+}
+
+// buildFacets renders every facet of q as a single query. Each row is
+// expanded into one (field, value) pair per field, so the table is read once,
+// and the total per field is a window over the grouped counts.
+func buildFacets(q FacetQuery) (string, []interface{}) {
+	var pairs []string
+	var args []interface{}
+	for _, field := range q.Fields {
+		if key, ok := strings.CutPrefix(field, AttributePrefix); ok {
+			pairs = append(pairs, "(?, attributes[?])")
+			args = append(args, field, key)
+			continue
+		}
+		// Column fields are validated against facetColumns
+		pairs = append(pairs, "(?, toString("+field+"))")
+		args = append(args, field)
+	}
+
+	where, whereArgs := buildWhere(q.Query)
+	query := `SELECT facet.1 AS field, facet.2 AS value, sum(repeat_count) AS count, ` +
+		`sum(sum(repeat_count)) OVER (PARTITION BY field) AS total ` +
+		`FROM logs ARRAY JOIN [` + strings.Join(pairs, ", ") + `] AS facet` + where +
+		` GROUP BY field, value HAVING value != ''` +
+		` ORDER BY field, count DESC, value LIMIT ? BY field`
+	args = append(append(args, whereArgs...), q.limit())
+	return query, args
+}
@@ -0,0 +1,96 @@
+package logstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBuildFacets(t *testing.T) {
+	query, args := buildFacets(FacetQuery{
+		Query:  Query{Level: "error", Limit: 5},
+		Fields: []string{"service", "attributes.host"},
+	})
+	expected := "SELECT facet.1 AS field, facet.2 AS value, sum(repeat_count) AS count, " +
+		"sum(sum(repeat_count)) OVER (PARTITION BY field) AS total " +
+		"FROM logs ARRAY JOIN [(?, toString(service)), (?, attributes[?])] AS facet WHERE level = ? " +
+		"GROUP BY field, value HAVING value != '' ORDER BY field, count DESC, value LIMIT ? BY field"
+	if query != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, query)
+	}
+	// Pair arguments come before the filters, the limit last
+	want := []interface{}{"service", "attributes.host", "host", "error", 5}
+	if len(args) != len(want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("arg %d: expected %v, got %v", i, want[i], args[i])
+		}
+	}
+}
+
+func TestFacetQueryValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     FacetQuery
+		valid bool
+	}{
+		{"columns", FacetQuery{Fields: []string{"level", "service", "trace_id"}}, true},
+		{"attribute", FacetQuery{Fields: []string{"attributes.ingest_host"}}, true},
+		{"no fields", FacetQuery{}, false},
+		{"message", FacetQuery{Fields: []string{"message"}}, false},
+		{"empty attribute key", FacetQuery{Fields: []string{"attributes."}}, false},
+		{"duplicate", FacetQuery{Fields: []string{"level", "level"}}, false},
+		{"too many fields", FacetQuery{Fields: make([]string, MaxFacetFields+1)}, false},
+		{"too many values", FacetQuery{Query: Query{Limit: MaxFacetValues + 1}, Fields: []string{"level"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.q.Validate(); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreFacets(t *testing.T) {
+	entries := testEntries()
+	entries[0].Attributes = map[string]string{"host": "web-1"}
+	entries[1].Attributes = map[string]string{"host": "web-2"}
+	entries[2].Attributes = map[string]string{"host": "web-1"}
+	store := NewMemoryStore(entries...)
+	ctx := context.Background()
+
+	facets, err := store.Facets(ctx, FacetQuery{Fields: []string{"level", "attributes.host", "trace_id"}})
+	if err != nil {
+		t.Fatalf("Facets failed: %v", err)
+	}
+	if len(facets) != 3 || facets[0].Field != "level" || facets[1].Field != "attributes.host" {
+		t.Fatalf("expected a facet per field in order, got %+v", facets)
+	}
+	level := facets[0]
+	if level.Total != 7 || len(level.Values) != 3 || level.Values[0] != (FacetValue{"error", 5}) {
+		t.Errorf("unexpected level facet: %+v", level)
+	}
+	// The entry without the attribute is not counted
+	host := facets[1]
+	if host.Total != 6 || len(host.Values) != 2 || host.Values[0] != (FacetValue{"web-2", 4}) {
+		t.Errorf("unexpected host facet: %+v", host)
+	}
+	if facets[2].Total != 0 || facets[2].Values == nil || len(facets[2].Values) != 0 {
+		t.Errorf("expected an empty trace facet, got %+v", facets[2])
+	}
+
+	facets, _ = store.Facets(ctx, FacetQuery{
+		Query:  Query{From: base.Add(time.Minute), Limit: 1},
+		Fields: []string{"service"},
+	})
+	if len(facets[0].Values) != 1 || facets[0].Total != 6 || facets[0].Values[0] != (FacetValue{"payment-api", 4}) {
+		t.Errorf("expected the filtered top service only, got %+v", facets[0])
+	}
+
+	if _, err := store.Facets(ctx, FacetQuery{Fields: []string{"message"}}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
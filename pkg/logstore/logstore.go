@@ -0,0 +1,144 @@
+// Package logstore defines the storage contract shared by OgLogStream
+// services, with a ClickHouse implementation for production and an
+// in-memory implementation for tests and local development.
+package logstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// LogStore writes and reads log entries
+type LogStore interface {
+	BatchWriter
+
+	// Search returns entries matching q, newest first. Entries with the
+	// same timestamp are ordered by ID, so pages are stable.
+	Search(ctx context.Context, q Query) ([]models.LogEntry, error)
+
+	// Aggregate counts entries matching q, grouped by fields and time buckets.
+	// Collapsed rows count as RepeatCount entries.
+	Aggregate(ctx context.Context, q AggregateQuery) ([]Bucket, error)
+
+	// Tail returns up to limit entries newer than since, oldest first
+	Tail(ctx context.Context, since time.Time, limit int) ([]models.LogEntry, error)
+
+	// Get returns the entry with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (models.LogEntry, error)
+
+	// Surrounding returns up to q.Before entries preceding q.Anchor and up to
+	// q.After entries following it that match the scope, both oldest first.
+	// The anchor itself is in neither.
+	Surrounding(ctx context.Context, q SurroundingQuery) (before, after []models.LogEntry, err error)
+
+	// Trace returns up to limit entries of a trace across services, oldest first
+	Trace(ctx context.Context, traceID string, limit int) ([]models.LogEntry, error)
+
+	// Export calls fn with every entry matching q, oldest first, ignoring
+	// q.Limit and q.Offset. Entries are read as fn consumes them, and the
+	// first error from fn or ctx stops the export and is returned.
+	Export(ctx context.Context, q Query, fn func(*models.LogEntry) error) error
+
+	// Patterns groups entries matching q by the Template of their message,
+	// most frequent first. q.Limit caps the patterns returned and q.Offset is
+	// ignored. Collapsed rows count as RepeatCount entries.
+	Patterns(ctx context.Context, q Query) ([]Pattern, error)
+
+	// Facets returns the most frequent values of each field of q among
+	// entries matching it, one Facet per field in the order requested.
+	// Collapsed rows count as RepeatCount entries.
+	Facets(ctx context.Context, q FacetQuery) ([]Facet, error)
+}
+
+// SurroundingQuery selects the neighbours of an entry. Position is decided by
+// timestamp, then ID, as in Search.
+type SurroundingQuery struct {
+	Anchor     models.LogEntry
+	Service    string            // exact service, empty for any
+	TraceID    string            // exact trace ID, empty for any
+	Attributes map[string]string // exact attribute values
+	Before     int               // capped at MaxLimit
+	After      int               // capped at MaxLimit
+}
+
+// ErrNotFound is returned by Get for unknown IDs
+var ErrNotFound = errors.New("log entry not found")
+
+// Query filters entries. Zero values don't filter.
+type Query struct {
+	Level   string    // exact level
+	Service string    // case-insensitive substring of service
+	TraceID string    // exact trace ID
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	Limit   int       // DefaultLimit when zero, capped at MaxLimit
+	Offset  int
+}
+
+// AggregateQuery groups entries matching Query. Limit caps the number of
+// buckets returned (0 means no cap); Offset is ignored.
+type AggregateQuery struct {
+	Query
+	GroupBy  []string      // any of "level", "service"
+	Interval time.Duration // time bucket width, 0 for no time grouping
+}
+
+// Bucket is one row of an aggregation
+type Bucket struct {
+	Time  time.Time         `json:"time,omitzero"`
+	Keys  map[string]string `json:"keys,omitempty"`
+	Count uint64            `json:"count"`
+}
+
+var groupColumns = map[string]bool{"level": true, "service": true}
+
+func (q AggregateQuery) validate() error {
+	for _, field := range q.GroupBy {
+		if !groupColumns[field] {
+			return fmt.Errorf("cannot group by %q", field)
+		}
+	}
+	if q.Interval < 0 || (q.Interval > 0 && q.Interval < time.Second) {
+		return fmt.Errorf("interval must be at least 1s")
+	}
+	return nil
+}
+
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+func limitOrDefault(limit int) int {
+	return Query{Limit: limit}.limit()
+}
+
+// repeatCount treats rows written without burst collapsing as single entries
+func repeatCount(e *models.LogEntry) uint64 {
+	if e.RepeatCount == 0 {
+		return 1
+	}
+	return uint64(e.RepeatCount)
+}
+
+// collapsedIDs never writes a NULL array
+func collapsedIDs(e *models.LogEntry) []string {
+	if e.CollapsedIDs == nil {
+		return []string{}
+	}
+	return e.CollapsedIDs
+}
@@ -0,0 +1,402 @@
+package logstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// MemoryStore keeps entries in memory with the same semantics as
+// ClickHouseStore. It is meant for tests and local development.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	entries []models.LogEntry
+	tokens  map[string]bool
+}
+
+func NewMemoryStore(entries ...models.LogEntry) *MemoryStore {
+	s := &MemoryStore{}
+	s.WriteBatch(context.Background(), entries)
+	return s
+}
+
+func (s *MemoryStore) WriteBatch(ctx context.Context, entries []models.LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if token := InsertToken(ctx); token != "" {
+		if s.tokens[token] {
+			return nil
+		}
+		if s.tokens == nil {
+			s.tokens = make(map[string]bool)
+		}
+		s.tokens[token] = true
+	}
+
+	for _, entry := range entries {
+		entry.Attributes = copyAttributes(entry.Attributes)
+		entry.RepeatCount = uint32(repeatCount(&entry))
+		if entry.FirstSeen.IsZero() {
+			entry.FirstSeen = entry.Timestamp
+		}
+		if entry.LastSeen.IsZero() {
+			entry.LastSeen = entry.Timestamp
+		}
+		s.entries = append(s.entries, entry)
+	}
+	return nil
+}
+
+func (s *MemoryStore) StoredIDs(ctx context.Context, entries []models.LogEntry) (map[string]bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.ID != "" {
+			wanted[e.ID] = true
+		}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stored := make(map[string]bool)
+	for _, e := range s.entries {
+		for _, id := range append([]string{e.ID}, e.CollapsedIDs...) {
+			if wanted[id] {
+				stored[id] = true
+			}
+		}
+	}
+	return stored, nil
+}
+
+// Entries returns a copy of everything stored, in insertion order
+func (s *MemoryStore) Entries() []models.LogEntry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneEntries(s.entries)
+}
+
+func (s *MemoryStore) Search(ctx context.Context, q Query) ([]models.LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	matched := s.filter(q)
+	sort.SliceStable(matched, func(i, j int) bool { return newer(&matched[i], &matched[j]) })
+	return page(matched, max(q.Offset, 0), q.limit()), nil
+}
+
+func (s *MemoryStore) Tail(ctx context.Context, since time.Time, limit int) ([]models.LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	matched := s.filter(Query{})
+	var after []models.LogEntry
+	for _, e := range matched {
+		if e.Timestamp.After(since) {
+			after = append(after, e)
+		}
+	}
+	sort.SliceStable(after, func(i, j int) bool { return newer(&after[j], &after[i]) })
+	return page(after, 0, limitOrDefault(limit)), nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (models.LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return models.LogEntry{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, e := range s.entries {
+		if e.ID == id || slices.Contains(e.CollapsedIDs, id) {
+			return cloneEntries([]models.LogEntry{e})[0], nil
+		}
+	}
+	return models.LogEntry{}, ErrNotFound
+}
+
+func (s *MemoryStore) Trace(ctx context.Context, traceID string, limit int) ([]models.LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	matched := s.filter(Query{TraceID: traceID})
+	sort.SliceStable(matched, func(i, j int) bool { return newer(&matched[j], &matched[i]) })
+	return page(matched, 0, limitOrDefault(limit)), nil
+}
+
+func (s *MemoryStore) Export(ctx context.Context, q Query, fn func(*models.LogEntry) error) error {
+	matched := s.filter(q)
+	sort.SliceStable(matched, func(i, j int) bool { return newer(&matched[j], &matched[i]) })
+	for i := range matched {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&matched[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Surrounding(ctx context.Context, q SurroundingQuery) ([]models.LogEntry, []models.LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var before, after []models.LogEntry
+	for _, e := range s.filter(Query{}) {
+		if q.Service != "" && e.Service != q.Service || !hasAttributes(&e, q.Attributes) {
+			continue
+		}
+		if q.TraceID != "" && e.TraceID != q.TraceID {
+			continue
+		}
+		switch {
+		case newer(&q.Anchor, &e):
+			before = append(before, e)
+		case newer(&e, &q.Anchor):
+			after = append(after, e)
+		}
+	}
+
+	sort.SliceStable(before, func(i, j int) bool { return newer(&before[j], &before[i]) })
+	sort.SliceStable(after, func(i, j int) bool { return newer(&after[j], &after[i]) })
+	before = before[max(len(before)-min(max(q.Before, 0), MaxLimit), 0):]
+	after = after[:min(len(after), min(max(q.After, 0), MaxLimit))]
+	return before, after, nil
+}
+
+func hasAttributes(e *models.LogEntry, attrs map[string]string) bool {
+	for k, v := range attrs {
+		if e.Attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// newer orders by timestamp, then by ID like ClickHouseStore
+func newer(a, b *models.LogEntry) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.After(b.Timestamp)
+	}
+	return a.ID > b.ID
+}
+
+func (s *MemoryStore) Aggregate(ctx context.Context, q AggregateQuery) ([]Bucket, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]*Bucket)
+	var buckets []*Bucket
+	for _, e := range s.filter(q.Query) {
+		b := Bucket{}
+		if q.Interval > 0 {
+			b.Time = e.Timestamp.UTC().Truncate(q.Interval)
+		}
+		key := b.Time.String()
+		if len(q.GroupBy) > 0 {
+			b.Keys = make(map[string]string, len(q.GroupBy))
+			for _, field := range q.GroupBy {
+				value := fieldValue(&e, field)
+				b.Keys[field] = value
+				key += "\x00" + value
+			}
+		}
+
+		existing, ok := index[key]
+		if !ok {
+			existing = &b
+			index[key] = existing
+			buckets = append(buckets, existing)
+		}
+		existing.Count += repeatCount(&e)
+	}
+
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if !buckets[i].Time.Equal(buckets[j].Time) {
+			return buckets[i].Time.Before(buckets[j].Time)
+		}
+		return buckets[i].Count > buckets[j].Count
+	})
+	if q.Limit > 0 && len(buckets) > q.Limit {
+		buckets = buckets[:q.Limit]
+	}
+
+	result := make([]Bucket, len(buckets))
+	for i, b := range buckets {
+		result[i] = *b
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Patterns(ctx context.Context, q Query) ([]Pattern, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	index := make(map[uint64]*Pattern)
+	var patterns []*Pattern
+	for _, e := range s.filter(q) {
+		hash := PatternHash(e.Message)
+		p, ok := index[hash]
+		if !ok {
+			p = &Pattern{Hash: fmt.Sprintf("%016x", hash), Template: Template(e.Message), FirstSeen: e.FirstSeen, LastSeen: e.LastSeen, Sample: e.Message}
+			index[hash] = p
+			patterns = append(patterns, p)
+		}
+		p.Count += repeatCount(&e)
+		if e.FirstSeen.Before(p.FirstSeen) {
+			p.FirstSeen = e.FirstSeen
+		}
+		if e.LastSeen.After(p.LastSeen) {
+			p.LastSeen = e.LastSeen
+		}
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].Hash < patterns[j].Hash
+	})
+	if len(patterns) > q.limit() {
+		patterns = patterns[:q.limit()]
+	}
+
+	result := make([]Pattern, len(patterns))
+	for i, p := range patterns {
+		result[i] = *p
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Facets(ctx context.Context, q FacetQuery) ([]Facet, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	facets, _ := newFacets(q.Fields)
+	matched := s.filter(q.Query)
+	for i := range facets {
+		f := &facets[i]
+		counts := make(map[string]uint64)
+		for j := range matched {
+			if value := fieldValue(&matched[j], f.Field); value != "" {
+				counts[value] += repeatCount(&matched[j])
+				f.Total += repeatCount(&matched[j])
+			}
+		}
+		for value, count := range counts {
+			f.Values = append(f.Values, FacetValue{Value: value, Count: count})
+		}
+		sort.Slice(f.Values, func(i, j int) bool {
+			if f.Values[i].Count != f.Values[j].Count {
+				return f.Values[i].Count > f.Values[j].Count
+			}
+			return f.Values[i].Value < f.Values[j].Value
+		})
+		if len(f.Values) > q.limit() {
+			f.Values = f.Values[:q.limit()]
+		}
+	}
+	return facets, nil
+}
+
+// filter returns copies of entries matching q in insertion order
+func (s *MemoryStore) filter(q Query) []models.LogEntry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	service := strings.ToLower(q.Service)
+	var matched []models.LogEntry
+	for _, e := range s.entries {
+		if q.Level != "" && e.Level != q.Level {
+			continue
+		}
+		if service != "" && !strings.Contains(strings.ToLower(e.Service), service) {
+			continue
+		}
+		if q.TraceID != "" && e.TraceID != q.TraceID {
+			continue
+		}
+		if !q.From.IsZero() && e.Timestamp.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !e.Timestamp.Before(q.To) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return cloneEntries(matched)
+}
+
+func fieldValue(e *models.LogEntry, field string) string {
+	switch field {
+	case "level":
+		return e.Level
+	case "service":
+		return e.Service
+	case "trace_id":
+		return e.TraceID
+	}
+	if key, ok := strings.CutPrefix(field, AttributePrefix); ok {
+		return e.Attributes[key]
+	}
+	return ""
+}
+
+func page(entries []models.LogEntry, offset, limit int) []models.LogEntry {
+	if offset >= len(entries) {
+		return nil
+	}
+	entries = entries[offset:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func cloneEntries(entries []models.LogEntry) []models.LogEntry {
+	out := make([]models.LogEntry, len(entries))
+	for i, e := range entries {
+		e.Attributes = copyAttributes(e.Attributes)
+		out[i] = e
+	}
+	return out
+}
+
+func copyAttributes(attrs map[string]string) map[string]string {
+	if attrs == nil {
+		return nil
+	}
+	out := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		out[k] = v
+	}
+	return out
+}
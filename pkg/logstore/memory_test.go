@@ -0,0 +1,346 @@
+package logstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+var base = time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+
+func testEntries() []models.LogEntry {
+	return []models.LogEntry{
+		{Timestamp: base, Level: "info", Message: "User login successful", Service: "auth-service"},
+		{Timestamp: base.Add(time.Minute), Level: "error", Message: "Payment failed", Service: "payment-api", RepeatCount: 4},
+		{Timestamp: base.Add(2 * time.Minute), Level: "warn", Message: "High CPU usage", Service: "monitoring-svc"},
+		{Timestamp: base.Add(3 * time.Minute), Level: "error", Message: "Token expired", Service: "Auth-Service"},
+	}
+}
+
+func TestMemoryStoreSearch(t *testing.T) {
+	store := NewMemoryStore(testEntries()...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{"all newest first", Query{}, []string{"Token expired", "High CPU usage", "Payment failed", "User login successful"}},
+		{"level", Query{Level: "error"}, []string{"Token expired", "Payment failed"}},
+		{"service substring case-insensitive", Query{Service: "auth"}, []string{"Token expired", "User login successful"}},
+		{"time range", Query{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)}, []string{"High CPU usage", "Payment failed"}},
+		{"limit and offset", Query{Limit: 2, Offset: 1}, []string{"High CPU usage", "Payment failed"}},
+		{"offset past end", Query{Offset: 10}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := store.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("expected %d entries, got %d", len(tt.expected), len(entries))
+			}
+			for i, e := range entries {
+				if e.Message != tt.expected[i] {
+					t.Errorf("entry %d: expected %q, got %q", i, tt.expected[i], e.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreAggregate(t *testing.T) {
+	store := NewMemoryStore(testEntries()...)
+	ctx := context.Background()
+
+	buckets, err := store.Aggregate(ctx, AggregateQuery{GroupBy: []string{"level"}})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	counts := map[string]uint64{}
+	for _, b := range buckets {
+		counts[b.Keys["level"]] = b.Count
+	}
+	if counts["error"] != 5 || counts["info"] != 1 || counts["warn"] != 1 || len(counts) != 3 {
+		t.Errorf("unexpected level counts: %v", counts)
+	}
+	if buckets[0].Keys["level"] != "error" {
+		t.Errorf("expected buckets ordered by count, got %+v", buckets)
+	}
+
+	timed, err := store.Aggregate(ctx, AggregateQuery{Interval: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if len(timed) != 2 || !timed[0].Time.Equal(base) || timed[0].Count != 5 || timed[1].Count != 2 {
+		t.Errorf("unexpected time buckets: %+v", timed)
+	}
+
+	if _, err := store.Aggregate(ctx, AggregateQuery{GroupBy: []string{"message"}}); err == nil {
+		t.Error("expected error for unsupported group field")
+	}
+}
+
+func TestMemoryStoreTail(t *testing.T) {
+	store := NewMemoryStore(testEntries()...)
+
+	entries, err := store.Tail(context.Background(), base.Add(time.Minute), 1)
+	if err != nil {
+		t.Fatalf("Tail failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Message != "High CPU usage" {
+		t.Errorf("unexpected tail: %+v", entries)
+	}
+}
+
+func TestMemoryStoreIsolation(t *testing.T) {
+	entry := models.LogEntry{Timestamp: base, Level: "info", Message: "m", Service: "s", Attributes: map[string]string{"k": "v"}}
+	store := NewMemoryStore(entry)
+	entry.Attributes["k"] = "changed"
+
+	stored := store.Entries()
+	if stored[0].Attributes["k"] != "v" {
+		t.Error("store must not share attribute maps with callers")
+	}
+	if stored[0].RepeatCount != 1 || !stored[0].FirstSeen.Equal(base) {
+		t.Errorf("expected defaults for single entries, got %+v", stored[0])
+	}
+}
+
+func TestBuildWhere(t *testing.T) {
+	where, args := buildWhere(Query{Level: "error", Service: "pay_%", From: base})
+	expected := " WHERE level = ? AND service ILIKE ? AND timestamp >= ?"
+	if where != expected {
+		t.Errorf("expected %q, got %q", expected, where)
+	}
+	if len(args) != 3 || args[1] != `%pay\_\%%` {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	if where, args := buildWhere(Query{}); where != "" || args != nil {
+		t.Errorf("expected no filters, got %q %v", where, args)
+	}
+}
+
+func TestBuildAggregate(t *testing.T) {
+	query, _ := buildAggregate("logs", "sum(repeat_count)", AggregateQuery{
+		Query:    Query{Level: "error", Limit: 10},
+		GroupBy:  []string{"service"},
+		Interval: time.Hour,
+	})
+	expected := "SELECT toStartOfInterval(timestamp, INTERVAL 3600 SECOND) AS bucket, toString(service) AS service, " +
+		"sum(repeat_count) AS count FROM logs WHERE level = ? GROUP BY bucket, service ORDER BY bucket ASC, count DESC LIMIT 10"
+	if query != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, query)
+	}
+}
+
+func TestMemoryStoreInsertToken(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := WithInsertToken(context.Background(), "batch-1")
+
+	for i := 0; i < 2; i++ {
+		if err := store.WriteBatch(ctx, testEntries()); err != nil {
+			t.Fatalf("WriteBatch failed: %v", err)
+		}
+	}
+	if got := len(store.Entries()); got != 4 {
+		t.Errorf("expected a repeated token to be ignored, got %d entries", got)
+	}
+
+	store.WriteBatch(WithInsertToken(context.Background(), "batch-2"), testEntries()[:1])
+	store.WriteBatch(context.Background(), testEntries()[:1])
+	store.WriteBatch(context.Background(), testEntries()[:1])
+	if got := len(store.Entries()); got != 7 {
+		t.Errorf("expected new and untokened batches to be stored, got %d entries", got)
+	}
+}
+
+func TestMemoryStoreStoredIDs(t *testing.T) {
+	entries := testEntries()
+	entries[0].ID, entries[1].ID = "a", "b"
+	entries[1].CollapsedIDs = []string{"b2"}
+	store := NewMemoryStore(entries[:2]...)
+
+	batch := []models.LogEntry{{ID: "b"}, {ID: "b2"}, {ID: "c"}, {}}
+	stored, err := store.StoredIDs(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("StoredIDs failed: %v", err)
+	}
+	if len(stored) != 2 || !stored["b"] || !stored["b2"] {
+		t.Errorf("expected b and the collapsed b2 to be reported, got %v", stored)
+	}
+}
+
+func TestBuildStoredIDs(t *testing.T) {
+	if _, _, ok := buildStoredIDs(testEntries()); ok {
+		t.Error("expected no lookup for entries without IDs")
+	}
+
+	entries := testEntries()
+	entries[1].ID, entries[2].ID = "b", "c"
+	query, args, ok := buildStoredIDs(entries)
+	if !ok || !strings.Contains(query, "has(?, id)") {
+		t.Fatalf("unexpected query %q", query)
+	}
+	if args[0] != base.Add(time.Minute-collapsedLookback) || args[1] != base.Add(2*time.Minute) {
+		t.Errorf("expected the range of the entries with IDs, got %v", args[:2])
+	}
+	if ids := args[2].([]string); len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Errorf("unexpected IDs %v", ids)
+	}
+}
+
+func TestMemoryStoreGet(t *testing.T) {
+	entries := testEntries()
+	for i := range entries {
+		entries[i].ID = fmt.Sprintf("0198-%d", i)
+	}
+	entries[1].CollapsedIDs = []string{"0198-9"}
+	store := NewMemoryStore(entries...)
+
+	e, err := store.Get(context.Background(), "0198-1")
+	if err != nil || e.Message != "Payment failed" {
+		t.Errorf("unexpected entry %+v, err %v", e, err)
+	}
+	// An entry collapsed into a burst resolves to the burst row
+	e, err = store.Get(context.Background(), "0198-9")
+	if err != nil || e.ID != "0198-1" {
+		t.Errorf("unexpected entry for collapsed ID %+v, err %v", e, err)
+	}
+	if _, err := store.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStoreOrdersTiesByID(t *testing.T) {
+	store := NewMemoryStore(
+		models.LogEntry{ID: "b", Timestamp: base, Level: "info", Message: "second", Service: "s"},
+		models.LogEntry{ID: "a", Timestamp: base, Level: "info", Message: "first", Service: "s"},
+		models.LogEntry{ID: "c", Timestamp: base, Level: "info", Message: "third", Service: "s"},
+	)
+
+	search, _ := store.Search(context.Background(), Query{})
+	tail, _ := store.Tail(context.Background(), base.Add(-time.Second), 0)
+	if search[0].ID != "c" || search[2].ID != "a" {
+		t.Errorf("expected search by ID descending on equal timestamps, got %+v", search)
+	}
+	if tail[0].ID != "a" || tail[2].ID != "c" {
+		t.Errorf("expected tail by ID ascending on equal timestamps, got %+v", tail)
+	}
+}
+
+func TestMemoryStoreSurrounding(t *testing.T) {
+	var entries []models.LogEntry
+	for i := 0; i < 6; i++ {
+		host := "a"
+		if i%2 == 1 {
+			host = "b"
+		}
+		entries = append(entries, models.LogEntry{
+			ID: fmt.Sprintf("id-%d", i), Timestamp: base.Add(time.Duration(i) * time.Second),
+			Level: "info", Message: fmt.Sprintf("line %d", i), Service: "api",
+			Attributes: map[string]string{"host": host},
+		})
+	}
+	entries = append(entries, models.LogEntry{ID: "other", Timestamp: base.Add(2 * time.Second), Level: "info", Message: "other", Service: "worker"})
+	store := NewMemoryStore(entries...)
+	anchor := entries[2]
+
+	messages := func(entries []models.LogEntry) string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Message)
+		}
+		return fmt.Sprint(out)
+	}
+
+	before, after, err := store.Surrounding(context.Background(), SurroundingQuery{Anchor: anchor, Service: "api", Before: 1, After: 2})
+	if err != nil {
+		t.Fatalf("Surrounding failed: %v", err)
+	}
+	if messages(before) != "[line 1]" || messages(after) != "[line 3 line 4]" {
+		t.Errorf("unexpected service scope: %s %s", messages(before), messages(after))
+	}
+
+	before, after, _ = store.Surrounding(context.Background(), SurroundingQuery{
+		Anchor: anchor, Attributes: map[string]string{"host": "a"}, Before: 10, After: 10,
+	})
+	if messages(before) != "[line 0]" || messages(after) != "[line 4]" {
+		t.Errorf("unexpected host scope: %s %s", messages(before), messages(after))
+	}
+}
+
+func TestBuildScope(t *testing.T) {
+	where, args := buildScope(SurroundingQuery{Service: "api", Attributes: map[string]string{"trace_id": "t", "host": "h"}})
+	expected := " AND service = ? AND attributes[?] = ? AND attributes[?] = ?"
+	if where != expected {
+		t.Errorf("expected %q, got %q", expected, where)
+	}
+	if fmt.Sprint(args) != "[api host h trace_id t]" {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
+
+func TestMemoryStoreTrace(t *testing.T) {
+	const trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	store := NewMemoryStore(
+		models.LogEntry{Timestamp: base.Add(time.Second), Level: "error", Message: "charge failed", Service: "payment-api", TraceID: trace},
+		models.LogEntry{Timestamp: base, Level: "info", Message: "checkout started", Service: "web", TraceID: trace},
+		models.LogEntry{Timestamp: base, Level: "info", Message: "unrelated", Service: "web", TraceID: "0af7651916cd43dd8448eb211c80319c"},
+	)
+
+	entries, err := store.Trace(context.Background(), trace, 0)
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Message != "checkout started" || entries[1].Message != "charge failed" {
+		t.Errorf("expected the trace across services oldest first, got %+v", entries)
+	}
+
+	where, args := buildWhere(Query{TraceID: trace})
+	if where != " WHERE trace_id = ?" || len(args) != 1 {
+		t.Errorf("unexpected trace filter %q %v", where, args)
+	}
+}
+
+func TestMemoryStoreExport(t *testing.T) {
+	store := NewMemoryStore(
+		models.LogEntry{Timestamp: base.Add(2 * time.Second), Level: "error", Message: "third", Service: "api"},
+		models.LogEntry{Timestamp: base, Level: "error", Message: "first", Service: "api"},
+		models.LogEntry{Timestamp: base.Add(time.Second), Level: "info", Message: "skipped", Service: "api"},
+		models.LogEntry{Timestamp: base.Add(time.Second), Level: "error", Message: "second", Service: "api"},
+	)
+
+	// Limit doesn't apply, and entries come oldest first
+	var messages []string
+	err := store.Export(context.Background(), Query{Level: "error", Limit: 1}, func(e *models.LogEntry) error {
+		messages = append(messages, e.Message)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if strings.Join(messages, ",") != "first,second,third" {
+		t.Errorf("unexpected export order: %v", messages)
+	}
+
+	// An error from fn stops the export
+	stop := errors.New("stop")
+	calls := 0
+	err = store.Export(context.Background(), Query{}, func(e *models.LogEntry) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected the export to stop after one entry, got %v after %d", err, calls)
+	}
+}
@@ -0,0 +1,162 @@
+package logstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// BatchWriter stores batches of entries. Every LogStore is a BatchWriter;
+// NativeWriter is a write-only alternative for the ingestion path.
+type BatchWriter interface {
+	// WriteBatch stores all entries or none of them
+	WriteBatch(ctx context.Context, entries []models.LogEntry) error
+}
+
+// NativeWriter inserts batches over the native ClickHouse protocol, appending
+// whole columns instead of binding a statement per row. With async set the
+// server buffers inserts (async_insert) and acknowledges once they are flushed.
+type NativeWriter struct {
+	conn  driver.Conn
+	async bool
+}
+
+func NewNativeWriter(conn driver.Conn, async bool) *NativeWriter {
+	return &NativeWriter{conn: conn, async: async}
+}
+
+// OpenNativeConn opens a native protocol connection for a clickhouse:// DSN
+func OpenNativeConn(dsn string) (driver.Conn, error) {
+	opts, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return clickhouse.Open(opts)
+}
+
+func (w *NativeWriter) WriteBatch(ctx context.Context, entries []models.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	settings := clickhouse.Settings{}
+	if w.async {
+		settings["async_insert"] = 1
+		settings["wait_for_async_insert"] = 1
+	}
+	if token := InsertToken(ctx); token != "" {
+		settings["insert_deduplication_token"] = token
+		if w.async {
+			settings["async_insert_deduplicate"] = 1
+		}
+	}
+	if len(settings) > 0 {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+	}
+
+	batch, err := w.conn.PrepareBatch(ctx, `INSERT INTO logs (`+insertColumns+`)`)
+	if err != nil {
+		return err
+	}
+	defer batch.Abort()
+
+	for i, column := range newColumns(entries).values() {
+		if err := batch.Column(i).Append(column); err != nil {
+			return fmt.Errorf("append column %d: %w", i, err)
+		}
+	}
+	return batch.Send()
+}
+
+func (w *NativeWriter) StoredIDs(ctx context.Context, entries []models.LogEntry) (map[string]bool, error) {
+	query, args, ok := buildStoredIDs(entries)
+	if !ok {
+		return nil, nil
+	}
+	rows, err := w.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		stored[id] = true
+	}
+	return stored, rows.Err()
+}
+
+// columns holds a batch in the column order of insertColumns
+type columns struct {
+	id          []string
+	timestamp   []time.Time
+	level       []string
+	message     []string
+	service     []string
+	attributes  []map[string]string
+	repeatCount []uint32
+	firstSeen   []time.Time
+	lastSeen    []time.Time
+	traceID     []string
+	spanID      []string
+	patternHash []uint64
+	collapsed   [][]string
+}
+
+func newColumns(entries []models.LogEntry) *columns {
+	n := len(entries)
+	c := &columns{
+		id:          make([]string, n),
+		timestamp:   make([]time.Time, n),
+		level:       make([]string, n),
+		message:     make([]string, n),
+		service:     make([]string, n),
+		attributes:  make([]map[string]string, n),
+		repeatCount: make([]uint32, n),
+		firstSeen:   make([]time.Time, n),
+		lastSeen:    make([]time.Time, n),
+		traceID:     make([]string, n),
+		spanID:      make([]string, n),
+		patternHash: make([]uint64, n),
+		collapsed:   make([][]string, n),
+	}
+	for i := range entries {
+		e := &entries[i]
+		c.id[i] = e.ID
+		c.timestamp[i] = e.Timestamp
+		c.level[i] = e.Level
+		c.message[i] = e.Message
+		c.service[i] = e.Service
+		c.attributes[i] = e.Attributes
+		if c.attributes[i] == nil {
+			c.attributes[i] = map[string]string{}
+		}
+		c.repeatCount[i] = uint32(repeatCount(e))
+		c.firstSeen[i], c.lastSeen[i] = e.FirstSeen, e.LastSeen
+		if c.firstSeen[i].IsZero() {
+			c.firstSeen[i] = e.Timestamp
+		}
+		if c.lastSeen[i].IsZero() {
+			c.lastSeen[i] = e.Timestamp
+		}
+		c.traceID[i] = e.TraceID
+		c.spanID[i] = e.SpanID
+		c.patternHash[i] = PatternHash(e.Message)
+		c.collapsed[i] = collapsedIDs(e)
+	}
+	return c
+}
+
+func (c *columns) values() []interface{} {
+	return []interface{}{c.id, c.timestamp, c.level, c.message, c.service,
+		c.attributes, c.repeatCount, c.firstSeen, c.lastSeen, c.traceID, c.spanID, c.patternHash, c.collapsed}
+}
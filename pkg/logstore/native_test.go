@@ -0,0 +1,144 @@
+package logstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestNewColumns(t *testing.T) {
+	entries := testEntries()
+	entries[0].Attributes = map[string]string{"env": "prod"}
+	entries[1].FirstSeen = base.Add(-time.Minute)
+	entries[1].CollapsedIDs = []string{"b2", "b3"}
+
+	c := newColumns(entries)
+	values := c.values()
+	if len(values) != 13 {
+		t.Fatalf("expected a value per column of %q, got %d", insertColumns, len(values))
+	}
+	for i, v := range values {
+		if n := columnLen(v); n != len(entries) {
+			t.Errorf("column %d: expected %d rows, got %d", i, len(entries), n)
+		}
+	}
+
+	if c.attributes[0]["env"] != "prod" || c.attributes[2] == nil {
+		t.Errorf("expected attributes with empty maps for missing ones, got %v", c.attributes)
+	}
+	if c.repeatCount[0] != 1 || c.repeatCount[1] != 4 {
+		t.Errorf("unexpected repeat counts: %v", c.repeatCount)
+	}
+	if !c.firstSeen[1].Equal(base.Add(-time.Minute)) || !c.lastSeen[1].Equal(entries[1].Timestamp) {
+		t.Errorf("unexpected burst bounds: %v %v", c.firstSeen[1], c.lastSeen[1])
+	}
+	if c.collapsed[0] == nil || len(c.collapsed[1]) != 2 {
+		t.Errorf("expected collapsed IDs with empty arrays for missing ones, got %v", c.collapsed)
+	}
+}
+
+func TestNativeWriterEmptyBatch(t *testing.T) {
+	// Empty batches never reach the connection
+	if err := NewNativeWriter(nil, false).WriteBatch(context.Background(), nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func columnLen(v interface{}) int {
+	switch c := v.(type) {
+	case []time.Time:
+		return len(c)
+	case []string:
+		return len(c)
+	case []map[string]string:
+		return len(c)
+	case [][]string:
+		return len(c)
+	case []uint32:
+		return len(c)
+	case []uint64:
+		return len(c)
+	}
+	return -1
+}
+
+// The write benchmarks need a migrated ClickHouse, e.g.
+// CLICKHOUSE_TEST_DSN=clickhouse://default:@localhost:9000/default go test -bench Write
+func benchmarkDSN(b *testing.B) string {
+	dsn := os.Getenv("CLICKHOUSE_TEST_DSN")
+	if dsn == "" {
+		b.Skip("CLICKHOUSE_TEST_DSN not set")
+	}
+	return dsn
+}
+
+func benchmarkBatch(size int) []models.LogEntry {
+	entries := make([]models.LogEntry, size)
+	now := time.Now()
+	for i := range entries {
+		entries[i] = models.LogEntry{
+			Timestamp:  now,
+			Level:      "info",
+			Message:    fmt.Sprintf("benchmark entry %d", i),
+			Service:    "logstore-bench",
+			Attributes: map[string]string{"env": "bench"},
+		}
+	}
+	return entries
+}
+
+func benchmarkWriter(b *testing.B, w BatchWriter, size int) {
+	entries := benchmarkBatch(size)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.WriteBatch(ctx, entries); err != nil {
+			b.Fatalf("WriteBatch failed: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	dsn := benchmarkDSN(b)
+
+	db, err := sql.Open("clickhouse", dsn)
+	if err != nil {
+		b.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	conn, err := OpenNativeConn(dsn)
+	if err != nil {
+		b.Fatalf("open native: %v", err)
+	}
+	defer conn.Close()
+
+	writers := []struct {
+		name string
+		w    BatchWriter
+	}{
+		{"sql", NewClickHouseStore(db)},
+		{"native", NewNativeWriter(conn, false)},
+		{"native-async", NewNativeWriter(conn, true)},
+	}
+	for _, size := range []int{100, 1000, 10000} {
+		for _, wr := range writers {
+			b.Run(fmt.Sprintf("%s/%d", wr.name, size), func(b *testing.B) {
+				benchmarkWriter(b, wr.w, size)
+			})
+		}
+	}
+}
+
+func BenchmarkNewColumns(b *testing.B) {
+	entries := benchmarkBatch(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newColumns(entries)
+	}
+}
@@ -0,0 +1,175 @@
+package logstore
+
+import (
+	"hash/fnv"
+	"net"
+	"strings"
+	"time"
+)
+
+// Tokens replacing the variable parts of a message in its template
+const (
+	maskNumber = "<num>"
+	maskHex    = "<hex>"
+	maskUUID   = "<uuid>"
+	maskIP     = "<ip>"
+)
+
+// Pattern is a group of entries whose messages share a template
+type Pattern struct {
+	Hash      string    `json:"hash"` // PatternHash of the messages, as 16 hex characters
+	Template  string    `json:"template"`
+	Count     uint64    `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Sample    string    `json:"sample"` // the message of one of the entries
+}
+
+// Template masks the variable tokens of a message: UUIDs, IP addresses with
+// an optional port, hex strings and any other run of digits. Words are split
+// on whitespace, which is kept, and the value of a key=value word is masked on
+// its own.
+func Template(message string) string {
+	var b strings.Builder
+	b.Grow(len(message))
+	for len(message) > 0 {
+		end := strings.IndexAny(message, " \t\r\n")
+		if end < 0 {
+			end = len(message)
+		}
+		maskWord(&b, message[:end])
+
+		space := end
+		for space < len(message) && isSpace(message[space]) {
+			space++
+		}
+		b.WriteString(message[end:space])
+		message = message[space:]
+	}
+	return b.String()
+}
+
+// PatternHash identifies the template of a message. It is never 0, which
+// marks entries stored without one.
+func PatternHash(message string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(Template(message)))
+	if sum := h.Sum64(); sum != 0 {
+		return sum
+	}
+	return 1
+}
+
+func maskWord(b *strings.Builder, word string) {
+	if strings.IndexAny(word, "0123456789") < 0 {
+		b.WriteString(word)
+		return
+	}
+
+	// Punctuation around a token is kept, as is the key of key=value
+	start := 0
+	for start < len(word) && strings.IndexByte(`"'([{<`, word[start]) >= 0 {
+		start++
+	}
+	end := len(word)
+	for end > start && strings.IndexByte(`"')]}>,;.:!?`, word[end-1]) >= 0 {
+		end--
+	}
+	if eq := strings.LastIndexByte(word[start:end], '='); eq >= 0 {
+		start += eq + 1
+	}
+	// A bracketed IPv6 address with a port keeps its opening bracket
+	if start > 0 && word[start-1] == '[' && isIP(word[start-1:end]) {
+		start--
+	}
+	b.WriteString(word[:start])
+
+	token := word[start:end]
+	switch {
+	case isUUID(token):
+		b.WriteString(maskUUID)
+	case isIP(token):
+		b.WriteString(maskIP)
+	case isHex(token):
+		b.WriteString(maskHex)
+	default:
+		maskDigits(b, token)
+	}
+	b.WriteString(word[end:])
+}
+
+// maskDigits replaces runs of digits, with any decimal part, by maskNumber
+func maskDigits(b *strings.Builder, token string) {
+	for i := 0; i < len(token); {
+		if !isDigit(token[i]) {
+			b.WriteByte(token[i])
+			i++
+			continue
+		}
+		for i < len(token) && (isDigit(token[i]) || (token[i] == '.' && i+1 < len(token) && isDigit(token[i+1]))) {
+			i++
+		}
+		b.WriteString(maskNumber)
+	}
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isIP(s string) bool {
+	if strings.IndexByte(s, '.') < 0 && strings.IndexByte(s, ':') < 0 {
+		return false
+	}
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(s)
+	return err == nil && net.ParseIP(host) != nil
+}
+
+// isHex is true for 0x-prefixed hex, and for 8 or more hex characters with
+// a letter, so that long numbers are masked as numbers
+func isHex(s string) bool {
+	prefixed := len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+	if prefixed {
+		s = s[2:]
+	} else if len(s) < 8 {
+		return false
+	}
+	letter := false
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+		letter = letter || !isDigit(s[i])
+	}
+	return prefixed || letter
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
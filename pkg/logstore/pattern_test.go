@@ -0,0 +1,70 @@
+package logstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"User login successful", "User login successful"},
+		{"Request 42 took 35ms", "Request <num> took <num>ms"},
+		{"latency=1.25s retries=3", "latency=<num>s retries=<num>"},
+		{"Order 123e4567-e89b-12d3-a456-426614174000 shipped", "Order <uuid> shipped"},
+		{"Connection from 10.0.0.12:51234 refused", "Connection from <ip> refused"},
+		{"peer [2001:db8::1]:443 closed, client=192.168.1.7.", "peer <ip> closed, client=<ip>."},
+		{"Address fe80::1ff:fe23:4567:890a unreachable", "Address <ip> unreachable"},
+		{"commit 9fceb02d0ae598e95dc970b74767f19372d61af8 at 0x7ffd5e8c", "commit <hex> at <hex>"},
+		{"batch 20250724 of user42", "batch <num> of user<num>"},
+		{"Deadline exceeded (deadbeef)", "Deadline exceeded (deadbeef)"},
+		{"  at 12:30:45\twith\n\"code\": 500", "  at <num>:<num>:<num>\twith\n\"code\": <num>"},
+	}
+	for _, tt := range tests {
+		if got := Template(tt.message); got != tt.expected {
+			t.Errorf("Template(%q)\nexpected %q\ngot      %q", tt.message, tt.expected, got)
+		}
+	}
+
+	if PatternHash("Request 1 took 2ms") != PatternHash("Request 30 took 400ms") {
+		t.Error("expected messages with the same template to share a hash")
+	}
+	if PatternHash("Request 1 took 2ms") == PatternHash("Request 1 failed") {
+		t.Error("expected different templates to have different hashes")
+	}
+}
+
+func TestMemoryStorePatterns(t *testing.T) {
+	store := NewMemoryStore(
+		models.LogEntry{Timestamp: base, Level: "error", Message: "Payment 1 failed", Service: "payment-api"},
+		models.LogEntry{Timestamp: base.Add(time.Minute), Level: "error", Message: "Payment 2 failed", Service: "payment-api", RepeatCount: 3},
+		models.LogEntry{Timestamp: base.Add(2 * time.Minute), Level: "info", Message: "Payment 3 failed", Service: "payment-api"},
+		models.LogEntry{Timestamp: base.Add(3 * time.Minute), Level: "error", Message: "Token expired", Service: "auth-service"},
+	)
+	ctx := context.Background()
+
+	patterns, err := store.Patterns(ctx, Query{})
+	if err != nil {
+		t.Fatalf("Patterns failed: %v", err)
+	}
+	if len(patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %+v", patterns)
+	}
+	p := patterns[0]
+	if p.Template != "Payment <num> failed" || p.Count != 5 || p.Sample != "Payment 1 failed" || len(p.Hash) != 16 {
+		t.Errorf("unexpected top pattern: %+v", p)
+	}
+	if !p.FirstSeen.Equal(base) || !p.LastSeen.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("unexpected bounds: %v %v", p.FirstSeen, p.LastSeen)
+	}
+
+	patterns, _ = store.Patterns(ctx, Query{Level: "error", Limit: 1})
+	if len(patterns) != 1 || patterns[0].Count != 4 {
+		t.Errorf("expected the filtered top pattern only, got %+v", patterns)
+	}
+}
@@ -0,0 +1,114 @@
+package logstore
+
+import (
+	"strings"
+	"time"
+)
+
+// rollup is a table of entry counts by service and level per step, kept by a
+// materialized view on logs. Rollups are created by processing-svc migrations.
+type rollup struct {
+	table  string
+	column string        // start of the step
+	step   time.Duration // width of a row
+	keep   time.Duration // how far back counts are complete, 0 for ever
+}
+
+// rollups from the coarsest. Rows of logs_minutely expire after 31 days, so
+// only the last 30 are read from it.
+var rollups = []rollup{
+	{table: "logs_hourly", column: "hour", step: time.Hour},
+	{table: "logs_minutely", column: "minute", step: time.Minute, keep: 30 * 24 * time.Hour},
+}
+
+// rollupPlan splits the range of an aggregation between rollups and logs
+type rollupPlan struct {
+	q        AggregateQuery
+	now      time.Time
+	branches []string
+	args     []interface{}
+	rollups  int
+}
+
+// buildRollupAggregate renders q over the coarsest rollups that cover its
+// range, reading logs only for what no rollup does, such as the seconds at
+// either end. It returns false when q needs logs throughout: it filters by
+// trace or its buckets are not whole minutes.
+func buildRollupAggregate(q AggregateQuery, now time.Time) (string, []interface{}, bool) {
+	var tiers []rollup
+	for _, r := range rollups {
+		if q.TraceID == "" && q.Interval%r.step == 0 {
+			tiers = append(tiers, r)
+		}
+	}
+
+	p := &rollupPlan{q: q, now: now}
+	p.add(q.From, q.To, tiers)
+	if p.rollups == 0 {
+		return "", nil, false
+	}
+
+	// Filters were applied per branch; only grouping and the limit remain
+	outer := AggregateQuery{Query: Query{Limit: q.Limit}, GroupBy: q.GroupBy, Interval: q.Interval}
+	query, _ := buildAggregate("("+strings.Join(p.branches, " UNION ALL ")+")", "sum(count)", outer)
+	return query, p.args, true
+}
+
+// add covers [from, to) with the first of tiers, passing what it cannot to
+// the rest. A zero from or to leaves that end open.
+func (p *rollupPlan) add(from, to time.Time, tiers []rollup) {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return
+	}
+	if len(tiers) == 0 {
+		p.branch(`SELECT timestamp, service, toString(level) AS level, toUInt64(repeat_count) AS count FROM logs`, from, to)
+		return
+	}
+	r, rest := tiers[0], tiers[1:]
+
+	if r.keep > 0 {
+		oldest := p.now.Add(-r.keep).Truncate(r.step)
+		if to.IsZero() || to.After(oldest) {
+			if from.Before(oldest) {
+				p.add(from, oldest, rest)
+				from = oldest
+			}
+		} else {
+			p.add(from, to, rest)
+			return
+		}
+	}
+
+	// Whole steps in [start, end) are read from the rollup. An open end
+	// needs no others, since the view is written with every insert.
+	start, end := from, to
+	if !start.IsZero() {
+		start = from.Truncate(r.step)
+		if start.Before(from) {
+			start = start.Add(r.step)
+		}
+	}
+	if !end.IsZero() {
+		end = to.Truncate(r.step)
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		p.add(from, to, rest)
+		return
+	}
+
+	if start.After(from) {
+		p.add(from, start, rest)
+	}
+	// The filters apply to the timestamp alias of the step column
+	p.branch(`SELECT `+r.column+` AS timestamp, service, level, count FROM `+r.table, start, end)
+	p.rollups++
+	if end.Before(to) {
+		p.add(end, to, rest)
+	}
+}
+
+func (p *rollupPlan) branch(query string, from, to time.Time) {
+	where, args := buildWhere(Query{Level: p.q.Level, Service: p.q.Service, From: from, To: to})
+	p.branches = append(p.branches, query+where)
+	p.args = append(p.args, args...)
+}
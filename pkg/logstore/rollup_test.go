@@ -0,0 +1,66 @@
+package logstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildRollupAggregate(t *testing.T) {
+	hour := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	now := hour.Add(24 * time.Hour)
+	hourly := "SELECT hour AS timestamp, service, level, count FROM logs_hourly"
+	minutely := "SELECT minute AS timestamp, service, level, count FROM logs_minutely"
+	raw := "SELECT timestamp, service, toString(level) AS level, toUInt64(repeat_count) AS count FROM logs"
+	const ranged = " WHERE timestamp >= ? AND timestamp < ?"
+
+	tests := []struct {
+		name     string
+		q        Query
+		interval time.Duration
+		now      time.Time
+		branches []string // none when logs are read throughout
+		args     int
+	}{
+		{"all time", Query{}, 0, now, []string{hourly}, 0},
+		{"whole hours", Query{From: hour, To: hour.Add(2 * time.Hour)}, time.Hour, now, []string{hourly + ranged}, 2},
+		{"partial hours", Query{Level: "error", From: hour.Add(-90 * time.Second), To: hour.Add(2*time.Hour + time.Minute)}, 0, now,
+			[]string{
+				raw + " WHERE level = ? AND timestamp >= ? AND timestamp < ?",
+				minutely + " WHERE level = ? AND timestamp >= ? AND timestamp < ?",
+				hourly + " WHERE level = ? AND timestamp >= ? AND timestamp < ?",
+				minutely + " WHERE level = ? AND timestamp >= ? AND timestamp < ?",
+			}, 12},
+		{"open end", Query{From: hour.Add(time.Minute)}, 0, now,
+			[]string{minutely + ranged, hourly + " WHERE timestamp >= ?"}, 3},
+		{"minute buckets", Query{From: hour, To: hour.Add(2 * time.Hour)}, 5 * time.Minute, now, []string{minutely + ranged}, 2},
+		{"minutes expired", Query{From: hour, To: hour.Add(time.Hour)}, time.Minute, hour.Add(60 * 24 * time.Hour), nil, 0},
+		{"minutes expired before now", Query{}, time.Minute, now,
+			[]string{raw + " WHERE timestamp < ?", minutely + " WHERE timestamp >= ?"}, 2},
+		{"within a minute", Query{From: hour.Add(time.Second), To: hour.Add(time.Minute)}, 0, now, nil, 0},
+		{"seconds buckets", Query{From: hour, To: hour.Add(time.Hour)}, 30 * time.Second, now, nil, 0},
+		{"trace", Query{TraceID: "t", From: hour, To: hour.Add(time.Hour)}, 0, now, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := AggregateQuery{Query: tt.q, GroupBy: []string{"service"}, Interval: tt.interval}
+			query, args, ok := buildRollupAggregate(q, tt.now)
+			if ok != (tt.branches != nil) {
+				t.Fatalf("expected rollups used %v, got %v: %s", tt.branches != nil, ok, query)
+			}
+			if !ok {
+				return
+			}
+
+			// The outer aggregation is covered by TestBuildAggregate
+			outer := AggregateQuery{GroupBy: q.GroupBy, Interval: q.Interval}
+			expected, _ := buildAggregate("("+strings.Join(tt.branches, " UNION ALL ")+")", "sum(count)", outer)
+			if query != expected {
+				t.Errorf("expected\n%s\ngot\n%s", expected, query)
+			}
+			if len(args) != tt.args {
+				t.Errorf("expected %d args, got %v", tt.args, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package logstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// collapsedLookback bounds how much earlier than an entry the row of the
+// burst it was collapsed into can be. Bursts span seconds.
+const collapsedLookback = time.Hour
+
+type insertTokenKey struct{}
+
+// WithInsertToken attaches an idempotency token to a WriteBatch call. Writing
+// the same token twice stores the batch once: ClickHouse drops the repeated
+// block through insert_deduplication_token, MemoryStore ignores it.
+func WithInsertToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, insertTokenKey{}, token)
+}
+
+// InsertToken returns the token attached by WithInsertToken, if any
+func InsertToken(ctx context.Context) string {
+	token, _ := ctx.Value(insertTokenKey{}).(string)
+	return token
+}
+
+// IDLookup finds the entries of a batch that are already stored, by event ID.
+// Insert tokens only cover a batch retried as is; redelivered entries can
+// come back in batches made up differently, and are left out by ID instead.
+type IDLookup interface {
+	// StoredIDs returns the IDs of entries already stored, either as the ID
+	// of a row or collapsed into one. Entries without an ID are never reported.
+	StoredIDs(ctx context.Context, entries []models.LogEntry) (map[string]bool, error)
+}
+
+// buildStoredIDs renders the lookup of the IDs of entries, bounded by their
+// timestamps so that only the partitions and granules of the batch are read.
+// A collapsed row takes the earliest timestamp of its burst, so the range
+// reaches collapsedLookback further back. It returns false when no entry has
+// an ID.
+func buildStoredIDs(entries []models.LogEntry) (string, []interface{}, bool) {
+	var ids []string
+	var from, to time.Time
+	for _, e := range entries {
+		if e.ID == "" {
+			continue
+		}
+		if len(ids) == 0 || e.Timestamp.Before(from) {
+			from = e.Timestamp
+		}
+		if len(ids) == 0 || e.Timestamp.After(to) {
+			to = e.Timestamp
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) == 0 {
+		return "", nil, false
+	}
+	return `SELECT DISTINCT stored FROM logs ARRAY JOIN arrayConcat([id], collapsed_ids) AS stored
+		WHERE timestamp >= ? AND timestamp <= ? AND (has(?, id) OR hasAny(collapsed_ids, ?)) AND has(?, stored)`,
+		[]interface{}{from.Add(-collapsedLookback), to, ids, ids, ids}, true
+}
@@ -6,8 +6,32 @@ import "time"
 // Используется для передачи, обработки и хранения логов
 
 type LogEntry struct {
+	// Sortable unique ID (UUIDv7) assigned by ingestion-api
+	ID string `json:"id,omitempty"`
+
 	Timestamp time.Time `json:"timestamp"`
 	Level     string    `json:"level"`    // e.g., "info", "error"
 	Message   string    `json:"message"`
 	Service   string    `json:"service"`  // e.g., "auth-service"
-} 
\ No newline at end of file
+
+	// W3C trace context: 32 and 16 lowercase hex characters
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+
+	// Free-form key/value metadata, including enrichment labels
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Burst collapsing: how many identical entries this row stands for
+	RepeatCount uint32    `json:"repeat_count,omitempty"`
+	FirstSeen   time.Time `json:"first_seen,omitzero"`
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+	// IDs of the other entries of a collapsed burst, which resolve to this row
+	CollapsedIDs []string `json:"collapsed_ids,omitempty"`
+}
+
+// NATS headers set by ingestion-api on every published entry
+const (
+	HeaderIngestHost = "Ingest-Host" // ingestion-api instance that accepted the entry
+	HeaderClientIP   = "Client-IP"   // client address as seen by ingestion-api
+	HeaderReceivedAt = "Received-At" // RFC 3339 time the entry was accepted
+)
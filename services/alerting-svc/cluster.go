@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	feedSubject      = "logs.live" // entries after redaction, see processing-svc
+	feedQueueGroup   = "alerting-group"
+	heartbeatSubject = "alerting.heartbeat"
+	alertSubject     = "alerting.alerts"
+	ruleSubject      = "alerting.rules"
+
+	heartbeatInterval = time.Second
+	peerTTL           = 3 * heartbeatInterval
+)
+
+// Report is a replica's heartbeat: its window totals of every streaming rule
+type Report struct {
+	Replica string            `json:"replica"`
+	At      time.Time         `json:"at"`
+	Counts  map[string]uint64 `json:"counts,omitempty"`
+}
+
+// ruleChange announces a created, updated or deleted rule to other replicas
+type ruleChange struct {
+	ID string `json:"id"`
+}
+
+// Cluster coordinates alerting-svc replicas over NATS. The feed is shared
+// through a queue group, so each replica counts part of it; heartbeats carry
+// those partial counts to every replica. Each rule is owned by one live
+// replica, chosen by hashing its ID, and only the owner evaluates it.
+// Owners broadcast every evaluation so all replicas report the same alerts.
+type Cluster struct {
+	nc      *nats.Conn
+	self    string
+	started time.Time
+
+	mu    sync.Mutex
+	peers map[string]Report
+}
+
+// NewCluster returns a cluster member named self. With a nil connection it
+// only tracks reports it is given, for tests.
+func NewCluster(nc *nats.Conn, self string, now time.Time) *Cluster {
+	return &Cluster{nc: nc, self: self, started: now, peers: make(map[string]Report)}
+}
+
+// Observe records a peer's heartbeat
+func (c *Cluster) Observe(r Report) {
+	if r.Replica == c.self {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peers[r.Replica] = r
+}
+
+// Members returns this replica and the peers heard from within peerTTL, sorted
+func (c *Cluster) Members(now time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members := []string{c.self}
+	for name, r := range c.peers {
+		if now.Sub(r.At) < peerTTL {
+			members = append(members, name)
+		} else {
+			delete(c.peers, name)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Owns reports whether this replica evaluates a rule. Nothing is owned until
+// a replica has had time to hear from its peers.
+func (c *Cluster) Owns(ruleID string, now time.Time) bool {
+	if now.Sub(c.started) < peerTTL {
+		return false
+	}
+	members := c.Members(now)
+	h := fnv.New32a()
+	h.Write([]byte(ruleID))
+	return members[h.Sum32()%uint32(len(members))] == c.self
+}
+
+// PeerCount sums the live peers' window totals of a streaming rule
+func (c *Cluster) PeerCount(ruleID string, now time.Time) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total uint64
+	for _, r := range c.peers {
+		if now.Sub(r.At) < peerTTL {
+			total += r.Counts[ruleID]
+		}
+	}
+	return total
+}
+
+func (c *Cluster) publish(subject string, v interface{}) {
+	if c.nc == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode %s message: %v", subject, err)
+		return
+	}
+	if err := c.nc.Publish(subject, data); err != nil {
+		log.Printf("Failed to publish %s: %v", subject, err)
+	}
+}
+
+// Run feeds the engine from logs.live and exchanges heartbeats, transitions
+// and rule changes until ctx is cancelled
+func (c *Cluster) Run(ctx context.Context, engine *Engine, rules RuleStore) error {
+	subs := []struct {
+		subject string
+		handle  func(*nats.Msg)
+	}{
+		{heartbeatSubject, func(msg *nats.Msg) {
+			var r Report
+			if err := json.Unmarshal(msg.Data, &r); err == nil {
+				// Liveness goes by our clock, not the peer's
+				r.At = time.Now()
+				c.Observe(r)
+			}
+		}},
+		{alertSubject, func(msg *nats.Msg) {
+			var t Transition
+			if err := json.Unmarshal(msg.Data, &t); err == nil {
+				engine.Apply(t)
+			}
+		}},
+		{ruleSubject, func(msg *nats.Msg) {
+			var change ruleChange
+			if err := json.Unmarshal(msg.Data, &change); err == nil {
+				engine.Reload(ctx, rules, change.ID)
+			}
+		}},
+	}
+	var all []*nats.Subscription
+	defer func() {
+		for _, sub := range all {
+			sub.Unsubscribe()
+		}
+	}()
+	for _, s := range subs {
+		sub, err := c.nc.Subscribe(s.subject, s.handle)
+		if err != nil {
+			return err
+		}
+		all = append(all, sub)
+	}
+
+	feed, err := c.nc.QueueSubscribe(feedSubject, feedQueueGroup, func(msg *nats.Msg) {
+		var entry models.LogEntry
+		if err := json.Unmarshal(msg.Data, &entry); err != nil {
+			return
+		}
+		engine.Observe(&entry, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	all = append(all, feed)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			c.publish(heartbeatSubject, Report{Replica: c.self, At: now, Counts: engine.localCounts(now)})
+		}
+	}
+}
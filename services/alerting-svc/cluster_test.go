@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestClusterMembers(t *testing.T) {
+	c := NewCluster(nil, "b", now)
+	c.Observe(Report{Replica: "b", At: now}) // its own heartbeat
+	c.Observe(Report{Replica: "c", At: now, Counts: map[string]uint64{"r1": 3}})
+	c.Observe(Report{Replica: "a", At: now.Add(-peerTTL), Counts: map[string]uint64{"r1": 5}})
+
+	members := c.Members(now)
+	if fmt.Sprint(members) != "[b c]" {
+		t.Errorf("expected [b c], got %v", members)
+	}
+	if n := c.PeerCount("r1", now); n != 3 {
+		t.Errorf("expected a peer count of 3, got %d", n)
+	}
+	if n := c.PeerCount("r1", now.Add(peerTTL)); n != 0 {
+		t.Errorf("expected stale peers not to count, got %d", n)
+	}
+}
+
+func TestClusterOwns(t *testing.T) {
+	at := now.Add(peerTTL)
+	replicas := []*Cluster{NewCluster(nil, "a", now), NewCluster(nil, "b", now), NewCluster(nil, "c", now)}
+	for _, c := range replicas {
+		for _, peer := range replicas {
+			c.Observe(Report{Replica: peer.self, At: at})
+		}
+	}
+
+	// Nothing is owned during warmup
+	if replicas[0].Owns("r1", now) {
+		t.Errorf("expected no ownership before peers are heard from")
+	}
+
+	owned := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("rule-%d", i)
+		owners := 0
+		for _, c := range replicas {
+			if c.Owns(id, at) {
+				owners++
+				owned[c.self]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s: expected exactly one owner, got %d", id, owners)
+		}
+	}
+	if len(owned) != 3 {
+		t.Errorf("expected rules spread over all replicas, got %v", owned)
+	}
+
+	// A lone replica owns everything
+	alone := NewCluster(nil, "a", now)
+	if !alone.Owns("rule-1", at) {
+		t.Errorf("expected a lone replica to own every rule")
+	}
+}
+
+func TestEngineFollowsPeers(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "errors", Type: RuleThreshold, Level: "error", Window: Duration(time.Minute),
+		Threshold: 1, Interval: Duration(time.Minute), Enabled: true}
+	ctx := context.Background()
+	rules := NewMemoryRuleStore()
+	engine := NewEngine(logstore.NewMemoryStore(), rules, 0, nil)
+	engine.EnableStreaming(NewCluster(nil, "a", now), nil)
+
+	// Rule changes are read back from the store
+	rules.SaveRule(ctx, rule)
+	engine.Reload(ctx, rules, rule.ID)
+	if _, ok := engine.Alert(rule.ID); !ok {
+		t.Fatalf("expected the reloaded rule to be tracked")
+	}
+
+	engine.Apply(Transition{Rule: rule, Alert: Alert{RuleID: rule.ID, RuleName: rule.Name, State: StateFiring, Value: 4}, At: now})
+	if alert, _ := engine.Alert(rule.ID); alert.State != StateFiring || alert.Value != 4 {
+		t.Errorf("expected the owner's state to be applied, got %+v", alert)
+	}
+
+	rules.DeleteRule(ctx, rule.ID)
+	engine.Reload(ctx, rules, rule.ID)
+	if _, ok := engine.Alert(rule.ID); ok {
+		t.Errorf("expected the deleted rule to be dropped")
+	}
+
+	// Transitions of untracked rules are ignored
+	engine.Apply(Transition{Rule: rule, Alert: Alert{RuleID: rule.ID, State: StateFiring}})
+	if len(engine.Alerts()) != 0 {
+		t.Errorf("expected no alerts, got %+v", engine.Alerts())
+	}
+}
+
+func TestNotificationsFollowRuleOwner(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "errors", Type: RuleThreshold, Level: "error", Window: Duration(time.Minute),
+		Threshold: 0, Interval: Duration(time.Minute), Enabled: true, Channels: []string{"rec"}}
+	ctx := context.Background()
+	store := logstore.NewMemoryStore()
+	rules := NewMemoryRuleStore(rule)
+	config := DefaultDispatchConfig()
+
+	// Two replicas sharing the log and rule stores
+	recA, recB := &recorder{}, &recorder{}
+	dA := newTestDispatcher(t, config, store, rules, recA)
+	dB := newTestDispatcher(t, config, store, rules, recB)
+	a := NewEngine(store, rules, 0, dA.Dispatch)
+	a.EnableStreaming(NewCluster(nil, "a", now), dA)
+	b := NewEngine(store, rules, 0, dB.Dispatch)
+	b.EnableStreaming(NewCluster(nil, "b", now), dB)
+	for _, e := range []*Engine{a, b} {
+		if err := e.Load(ctx); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+
+	// handOver passes the last evaluation of from to to, as broadcast on
+	// alertSubject
+	handOver := func(from *Engine, d *Dispatcher, to *Engine) {
+		alert, _ := from.Alert(rule.ID)
+		data, err := json.Marshal(Transition{Rule: rule, Alert: alert, At: alert.EvaluatedAt, Notify: d.NotifyState(rule.ID)})
+		if err != nil {
+			t.Fatalf("Failed to encode transition: %v", err)
+		}
+		var tr Transition
+		json.Unmarshal(data, &tr)
+		to.Apply(tr)
+	}
+
+	// a fires, then the rule moves to b, which resolves it and only fires
+	// again once the dedup window since a's notification has passed
+	store.WriteBatch(ctx, []models.LogEntry{{Timestamp: now.Add(-time.Second), Level: "error", Message: "m", Service: "api"}})
+	a.Evaluate(ctx, rule, now)
+	handOver(a, dA, b)
+	b.Evaluate(ctx, rule, now.Add(time.Minute))
+	store.WriteBatch(ctx, []models.LogEntry{{Timestamp: now.Add(2*time.Minute - time.Second), Level: "error", Message: "m", Service: "api"}})
+	b.Evaluate(ctx, rule, now.Add(2*time.Minute))
+	store.WriteBatch(ctx, []models.LogEntry{{Timestamp: now.Add(config.DedupWindow - time.Second), Level: "error", Message: "m", Service: "api"}})
+	b.Evaluate(ctx, rule, now.Add(config.DedupWindow-time.Minute))
+	b.Evaluate(ctx, rule, now.Add(config.DedupWindow))
+
+	// The rule is deleted through a, which no longer owns it
+	handOver(b, dB, a)
+	a.Remove(ctx, rule.ID, "rule deleted")
+
+	dA.Stop(ctx)
+	dB.Stop(ctx)
+	if got := fmt.Sprint(recA.states()); got != "[firing resolved]" {
+		t.Errorf("expected a to notify firing and the deletion, got %s", got)
+	}
+	if got := fmt.Sprint(recB.states()); got != "[resolved firing]" {
+		t.Errorf("expected b to resolve a's alert and fire after the dedup window, got %s", got)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	defaultDedupWindow = 5 * time.Minute
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	maxBackoff         = time.Minute
+	defaultSamples     = 5
+	channelQueueSize   = 100
+)
+
+// DispatchConfig controls notification delivery. A firing notification is
+// not repeated on a channel within DedupWindow of the last one for the same
+// rule. Failed deliveries are retried up to MaxAttempts times, waiting Backoff
+// and doubling it after each attempt.
+type DispatchConfig struct {
+	DedupWindow time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+	Samples     int // matching entries attached to firing notifications
+}
+
+func DefaultDispatchConfig() DispatchConfig {
+	return DispatchConfig{
+		DedupWindow: defaultDedupWindow,
+		MaxAttempts: defaultMaxAttempts,
+		Backoff:     defaultBackoff,
+		Samples:     defaultSamples,
+	}
+}
+
+// LoadDispatchConfig reads NOTIFY_DEDUP_WINDOW, NOTIFY_MAX_ATTEMPTS,
+// NOTIFY_BACKOFF and NOTIFY_SAMPLES, keeping defaults for unset ones
+func LoadDispatchConfig(getenv func(string) string) (DispatchConfig, error) {
+	cfg := DefaultDispatchConfig()
+	if raw := getenv("NOTIFY_DEDUP_WINDOW"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid NOTIFY_DEDUP_WINDOW %q", raw)
+		}
+		cfg.DedupWindow = d
+	}
+	if raw := getenv("NOTIFY_BACKOFF"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid NOTIFY_BACKOFF %q", raw)
+		}
+		cfg.Backoff = d
+	}
+	if raw := getenv("NOTIFY_MAX_ATTEMPTS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid NOTIFY_MAX_ATTEMPTS %q", raw)
+		}
+		cfg.MaxAttempts = n
+	}
+	if raw := getenv("NOTIFY_SAMPLES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > logstore.MaxLimit {
+			return cfg, fmt.Errorf("invalid NOTIFY_SAMPLES %q", raw)
+		}
+		cfg.Samples = n
+	}
+	return cfg, nil
+}
+
+// ChannelStats holds delivery counters of a channel
+type ChannelStats struct {
+	Name       string      `json:"name"`
+	Type       ChannelType `json:"type"`
+	Queued     int         `json:"queued"`
+	Sent       uint64      `json:"sent"`
+	Failed     uint64      `json:"failed"`     // gave up after retries, or queue full
+	Suppressed uint64      `json:"suppressed"` // deduplicated
+	Silenced   uint64      `json:"silenced"`
+}
+
+// channelWorker delivers one channel's notifications in order, so a slow or
+// failing channel does not hold up the others
+type channelWorker struct {
+	channel  Channel
+	notifier Notifier
+	queue    chan Notification
+
+	sent       atomic.Uint64
+	failed     atomic.Uint64
+	suppressed atomic.Uint64
+	silenced   atomic.Uint64
+}
+
+type channelRule struct {
+	channel string
+	ruleID  string
+}
+
+// NotifyState is what a channel was last notified of for a rule
+type NotifyState struct {
+	FiredAt  time.Time `json:"fired_at,omitzero"`  // last firing notification
+	Notified bool      `json:"notified,omitempty"` // firing notified, resolved pending
+}
+
+// Dispatcher turns firing and resolved transitions into notifications on the
+// channels each rule lists. A resolved notification is only sent where the
+// firing one was, so deduplicated and silenced alerts stay quiet throughout.
+type Dispatcher struct {
+	config   DispatchConfig
+	logs     logstore.LogStore
+	rules    RuleStore
+	channels map[string]*channelWorker
+	names    []string
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	mu       sync.Mutex
+	firedAt  map[channelRule]time.Time // last firing notification
+	notified map[channelRule]bool      // firing notified, resolved pending
+	updated  map[string]time.Time      // by rule ID, time of the last claim or restore
+	stopped  bool                      // queues are closed
+}
+
+func NewDispatcher(config DispatchConfig, logs logstore.LogStore, rules RuleStore, channels []Channel) (*Dispatcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		config:   config,
+		logs:     logs,
+		rules:    rules,
+		channels: make(map[string]*channelWorker),
+		ctx:      ctx,
+		cancel:   cancel,
+		firedAt:  make(map[channelRule]time.Time),
+		notified: make(map[channelRule]bool),
+		updated:  make(map[string]time.Time),
+	}
+	for i, c := range channels {
+		notifier, err := NewNotifier(c)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("channel %d: %w", i, err)
+		}
+		if _, ok := d.channels[c.Name]; ok {
+			cancel()
+			return nil, fmt.Errorf("duplicate channel %q", c.Name)
+		}
+		w := &channelWorker{channel: c, notifier: notifier, queue: make(chan Notification, channelQueueSize)}
+		d.channels[c.Name] = w
+		d.names = append(d.names, c.Name)
+	}
+
+	for _, w := range d.channels {
+		d.workers.Add(1)
+		go d.run(w)
+	}
+	return d, nil
+}
+
+// HasChannel reports whether a channel is configured
+func (d *Dispatcher) HasChannel(name string) bool {
+	_, ok := d.channels[name]
+	return ok
+}
+
+// Dispatch queues notifications for a transition. Only firing and resolved
+// transitions notify.
+func (d *Dispatcher) Dispatch(ctx context.Context, t Transition) {
+	state := t.Alert.State
+	if (state != StateFiring && state != StateResolved) || len(t.Rule.Channels) == 0 {
+		return
+	}
+
+	silenced := d.silenced(ctx, t.Rule.ID, t.At)
+	n := Notification{Rule: t.Rule, Alert: t.Alert}
+	if state == StateFiring && !silenced {
+		n.Samples = d.samples(ctx, t)
+	}
+
+	for _, name := range t.Rule.Channels {
+		w, ok := d.channels[name]
+		if !ok {
+			continue
+		}
+		if silenced {
+			w.silenced.Add(1)
+			continue
+		}
+		if !d.claim(channelRule{name, t.Rule.ID}, state, t.At) {
+			w.suppressed.Add(1)
+			continue
+		}
+		d.enqueue(w, n)
+	}
+}
+
+// enqueue hands a notification to a channel worker without blocking. It holds
+// mu so that Stop cannot close the queue in between; a transition arriving
+// after Stop is dropped.
+func (d *Dispatcher) enqueue(w *channelWorker, n Notification) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		w.failed.Add(1)
+		log.Printf("Dispatcher is stopped, dropping %s notification for rule %s on channel %s", n.Alert.State, n.Rule.ID, w.channel.Name)
+		return
+	}
+	select {
+	case w.queue <- n:
+	default:
+		w.failed.Add(1)
+		log.Printf("Notification queue of channel %s is full, dropping %s notification for rule %s", w.channel.Name, n.Alert.State, n.Rule.ID)
+	}
+}
+
+// claim decides whether a notification goes out on a channel and records it
+func (d *Dispatcher) claim(key channelRule, state State, at time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if at.After(d.updated[key.ruleID]) {
+		d.updated[key.ruleID] = at
+	}
+	if state == StateResolved {
+		if !d.notified[key] {
+			return false
+		}
+		delete(d.notified, key)
+		return true
+	}
+
+	if last, ok := d.firedAt[key]; ok && at.Sub(last) < d.config.DedupWindow {
+		return false
+	}
+	d.firedAt[key] = at
+	d.notified[key] = true
+	return true
+}
+
+// NotifyState returns what each channel was last notified of for a rule, by
+// channel name. Channels never notified of it are left out.
+func (d *Dispatcher) NotifyState(ruleID string) map[string]NotifyState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var states map[string]NotifyState
+	for _, name := range d.names {
+		key := channelRule{name, ruleID}
+		firedAt, ok := d.firedAt[key]
+		if !ok {
+			continue
+		}
+		if states == nil {
+			states = make(map[string]NotifyState)
+		}
+		states[name] = NotifyState{FiredAt: firedAt, Notified: d.notified[key]}
+	}
+	return states
+}
+
+// RestoreNotifyState replaces what the channels were notified of for a rule
+// by the states another replica had at at, so that a replica taking over the
+// rule deduplicates and resolves its notifications like the one before. States
+// older than the last claim or restore for the rule are ignored.
+func (d *Dispatcher) RestoreNotifyState(ruleID string, at time.Time, states map[string]NotifyState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if at.Before(d.updated[ruleID]) {
+		return
+	}
+	d.updated[ruleID] = at
+	for _, name := range d.names {
+		key := channelRule{name, ruleID}
+		state, ok := states[name]
+		if !ok {
+			delete(d.firedAt, key)
+			delete(d.notified, key)
+			continue
+		}
+		d.firedAt[key] = state.FiredAt
+		if state.Notified {
+			d.notified[key] = true
+		} else {
+			delete(d.notified, key)
+		}
+	}
+}
+
+func (d *Dispatcher) silenced(ctx context.Context, ruleID string, at time.Time) bool {
+	silences, err := d.rules.ListSilences(ctx)
+	if err != nil {
+		// Better a notification too many than a missed one
+		log.Printf("Failed to load silences: %v", err)
+		return false
+	}
+	for _, s := range silences {
+		if s.Covers(ruleID, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// samples returns matching entries from the window that fired, newest first
+func (d *Dispatcher) samples(ctx context.Context, t Transition) []models.LogEntry {
+	if d.config.Samples == 0 || t.Rule.Type == RuleAbsence {
+		return nil
+	}
+	entries, err := d.logs.Search(ctx, logstore.Query{
+		Level:   t.Rule.Level,
+		Service: t.Rule.Service,
+		From:    t.From,
+		To:      t.To,
+		Limit:   d.config.Samples,
+	})
+	if err != nil {
+		log.Printf("Failed to load sample entries for rule %s: %v", t.Rule.ID, err)
+		return nil
+	}
+	return entries
+}
+
+func (d *Dispatcher) run(w *channelWorker) {
+	defer d.workers.Done()
+	for n := range w.queue {
+		if err := d.deliver(w, n); err != nil {
+			w.failed.Add(1)
+			log.Printf("Failed to notify channel %s of rule %s: %v", w.channel.Name, n.Rule.ID, err)
+			continue
+		}
+		w.sent.Add(1)
+	}
+}
+
+// deliver tries a notification until it is sent, fails permanently or runs
+// out of attempts
+func (d *Dispatcher) deliver(w *channelWorker, n Notification) error {
+	backoff := d.config.Backoff
+	var err error
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(d.ctx, notifyTimeout)
+		err = w.notifier.Notify(ctx, n)
+		cancel()
+		if err == nil || isPermanent(err) || attempt == d.config.MaxAttempts {
+			break
+		}
+
+		log.Printf("Notification to channel %s failed (attempt %d/%d), retrying in %v: %v",
+			w.channel.Name, attempt, d.config.MaxAttempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+	return err
+}
+
+// Channels returns the counters of every channel, in configuration order
+func (d *Dispatcher) Channels() []ChannelStats {
+	stats := make([]ChannelStats, 0, len(d.names))
+	for _, name := range d.names {
+		w := d.channels[name]
+		stats = append(stats, ChannelStats{
+			Name:       name,
+			Type:       w.channel.Type,
+			Queued:     len(w.queue),
+			Sent:       w.sent.Load(),
+			Failed:     w.failed.Load(),
+			Suppressed: w.suppressed.Load(),
+			Silenced:   w.silenced.Load(),
+		})
+	}
+	return stats
+}
+
+// Test sends a notification for rule to a channel right away, without
+// retries, deduplication or silences
+func (d *Dispatcher) Test(ctx context.Context, channel string, rule Rule) error {
+	w, ok := d.channels[channel]
+	if !ok {
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+	now := time.Now().UTC()
+	return w.notifier.Notify(ctx, Notification{
+		Rule: rule,
+		Alert: Alert{RuleID: rule.ID, RuleName: rule.Name, State: StateFiring, Message: "test notification",
+			ActiveSince: now, FiredAt: now, EvaluatedAt: now},
+	})
+}
+
+// Stop delivers queued notifications until ctx is done, then abandons the rest.
+// Later transitions are dropped.
+func (d *Dispatcher) Stop(ctx context.Context) {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	for _, w := range d.channels {
+		close(w.queue)
+	}
+	d.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
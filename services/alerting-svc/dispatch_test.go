@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func testDispatcher(t *testing.T) *Dispatcher {
+	d, err := NewDispatcher(DefaultDispatchConfig(), logstore.NewMemoryStore(), NewMemoryRuleStore(), nil)
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	return d
+}
+
+// recorder is a Notifier failing the first failures calls
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	got      []Notification
+}
+
+func (r *recorder) Notify(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return r.err
+	}
+	r.got = append(r.got, n)
+	return nil
+}
+
+func (r *recorder) states() []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var states []State
+	for _, n := range r.got {
+		states = append(states, n.Alert.State)
+	}
+	return states
+}
+
+// newTestDispatcher wires a recorder in place of the "rec" channel's notifier
+func newTestDispatcher(t *testing.T, config DispatchConfig, logs logstore.LogStore, rules RuleStore, rec *recorder) *Dispatcher {
+	d, err := NewDispatcher(config, logs, rules, []Channel{{Name: "rec", Type: ChannelSlack, URL: "http://localhost"}})
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	d.channels["rec"].notifier = rec
+	return d
+}
+
+func transitionAt(rule Rule, state State, at time.Time) Transition {
+	return Transition{Rule: rule, Alert: Alert{RuleID: rule.ID, State: state}, At: at,
+		From: at.Add(-time.Duration(rule.Window)), To: at}
+}
+
+func TestDispatcherDedupAndSamples(t *testing.T) {
+	logs := logstore.NewMemoryStore(
+		models.LogEntry{Timestamp: now.Add(-time.Second), Level: "error", Service: "api", Message: "in window"},
+		models.LogEntry{Timestamp: now.Add(-time.Hour), Level: "error", Service: "api", Message: "too old"},
+	)
+	rec := &recorder{}
+	config := DefaultDispatchConfig()
+	d := newTestDispatcher(t, config, logs, NewMemoryRuleStore(), rec)
+	rule := Rule{ID: "r1", Type: RuleThreshold, Level: "error", Window: Duration(time.Minute), Channels: []string{"rec", "unknown"}}
+
+	d.Dispatch(context.Background(), transitionAt(rule, StatePending, now))
+	d.Dispatch(context.Background(), transitionAt(rule, StateFiring, now))
+	d.Dispatch(context.Background(), transitionAt(rule, StateResolved, now.Add(time.Minute)))
+	// Flapping within the dedup window stays quiet, including the resolve
+	d.Dispatch(context.Background(), transitionAt(rule, StateFiring, now.Add(2*time.Minute)))
+	d.Dispatch(context.Background(), transitionAt(rule, StateResolved, now.Add(3*time.Minute)))
+	d.Dispatch(context.Background(), transitionAt(rule, StateFiring, now.Add(config.DedupWindow)))
+	d.Stop(context.Background())
+
+	states := rec.states()
+	if len(states) != 3 || states[0] != StateFiring || states[1] != StateResolved || states[2] != StateFiring {
+		t.Fatalf("expected firing, resolved, firing, got %v", states)
+	}
+	if samples := rec.got[0].Samples; len(samples) != 1 || samples[0].Message != "in window" {
+		t.Errorf("expected the sample from the evaluated window, got %+v", samples)
+	}
+	if len(rec.got[1].Samples) != 0 {
+		t.Errorf("expected no samples on resolve")
+	}
+	if stats := d.Channels()[0]; stats.Sent != 3 || stats.Suppressed != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestDispatcherAfterStop(t *testing.T) {
+	rec := &recorder{}
+	d := newTestDispatcher(t, DefaultDispatchConfig(), logstore.NewMemoryStore(), NewMemoryRuleStore(), rec)
+	d.Stop(context.Background())
+	d.Stop(context.Background())
+
+	// A transition racing shutdown is dropped instead of sent on a closed queue
+	rule := Rule{ID: "r1", Type: RuleAbsence, Window: Duration(time.Minute), Channels: []string{"rec"}}
+	d.Dispatch(context.Background(), transitionAt(rule, StateFiring, now))
+	if len(rec.got) != 0 {
+		t.Errorf("expected nothing sent after Stop, got %+v", rec.got)
+	}
+	if stats := d.Channels()[0]; stats.Failed != 1 {
+		t.Errorf("expected the dropped notification to count as failed, got %+v", stats)
+	}
+}
+
+func TestDispatcherSilences(t *testing.T) {
+	rules := NewMemoryRuleStore()
+	rules.SaveSilence(context.Background(), Silence{ID: "s1", RuleID: "r1", StartsAt: now, EndsAt: now.Add(time.Hour)})
+	rec := &recorder{}
+	d := newTestDispatcher(t, DefaultDispatchConfig(), logstore.NewMemoryStore(), rules, rec)
+
+	silenced := Rule{ID: "r1", Type: RuleAbsence, Window: Duration(time.Minute), Channels: []string{"rec"}}
+	other := Rule{ID: "r2", Type: RuleAbsence, Window: Duration(time.Minute), Channels: []string{"rec"}}
+	d.Dispatch(context.Background(), transitionAt(silenced, StateFiring, now.Add(time.Minute)))
+	d.Dispatch(context.Background(), transitionAt(other, StateFiring, now.Add(time.Minute)))
+	d.Dispatch(context.Background(), transitionAt(silenced, StateResolved, now.Add(2*time.Hour)))
+	d.Stop(context.Background())
+
+	if len(rec.got) != 1 || rec.got[0].Rule.ID != "r2" {
+		t.Errorf("expected only the unsilenced rule to notify, got %+v", rec.got)
+	}
+	if stats := d.Channels()[0]; stats.Silenced != 1 || stats.Suppressed != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	config := DefaultDispatchConfig()
+	config.Backoff = time.Millisecond
+	config.MaxAttempts = 3
+	rule := Rule{ID: "r1", Type: RuleAbsence, Window: Duration(time.Minute), Channels: []string{"rec"}}
+
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		sent     uint64
+	}{
+		{"recovers", 2, errors.New("connection refused"), 1},
+		{"gives up", 3, errors.New("connection refused"), 0},
+		{"permanent", 1, permanentError{errors.New("400 Bad Request")}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{failures: tt.failures, err: tt.err}
+			d := newTestDispatcher(t, config, logstore.NewMemoryStore(), NewMemoryRuleStore(), rec)
+			d.Dispatch(context.Background(), transitionAt(rule, StateFiring, now))
+			d.Stop(context.Background())
+
+			if stats := d.Channels()[0]; stats.Sent != tt.sent || stats.Failed != 1-tt.sent {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+			// Permanent errors are not retried
+			if tt.name == "permanent" && rec.failures != 0 {
+				t.Errorf("expected a single attempt")
+			}
+		})
+	}
+}
+
+func TestLoadDispatchConfig(t *testing.T) {
+	env := map[string]string{"NOTIFY_DEDUP_WINDOW": "0s", "NOTIFY_MAX_ATTEMPTS": "2", "NOTIFY_BACKOFF": "250ms"}
+	cfg, err := LoadDispatchConfig(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("LoadDispatchConfig failed: %v", err)
+	}
+	if cfg.DedupWindow != 0 || cfg.MaxAttempts != 2 || cfg.Backoff != 250*time.Millisecond || cfg.Samples != defaultSamples {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	for _, bad := range []map[string]string{{"NOTIFY_MAX_ATTEMPTS": "0"}, {"NOTIFY_BACKOFF": "soon"}, {"NOTIFY_SAMPLES": "-1"}} {
+		if _, err := LoadDispatchConfig(func(k string) string { return bad[k] }); err == nil {
+			t.Errorf("expected %v to be rejected", bad)
+		}
+	}
+}
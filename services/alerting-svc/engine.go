@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourusername/oglogstream-anomaly"
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+// State is the lifecycle stage of an alert
+type State string
+
+const (
+	StateInactive State = "inactive" // condition false
+	StatePending  State = "pending"  // condition true for less than the rule's For
+	StateFiring   State = "firing"   // condition true for at least the rule's For
+	StateResolved State = "resolved" // condition false again after firing
+)
+
+const (
+	tickInterval = time.Second
+	evalTimeout  = 30 * time.Second
+)
+
+// Alert is the current state of one rule
+type Alert struct {
+	RuleID      string    `json:"rule_id"`
+	RuleName    string    `json:"rule_name"`
+	State       State     `json:"state"`
+	Value       float64   `json:"value"`
+	Message     string    `json:"message,omitempty"`
+	ActiveSince time.Time `json:"active_since,omitzero"` // condition true since
+	FiredAt     time.Time `json:"fired_at,omitzero"`
+	ResolvedAt  time.Time `json:"resolved_at,omitzero"`
+	EvaluatedAt time.Time `json:"evaluated_at,omitzero"`
+	Error       string    `json:"error,omitempty"` // last evaluation error
+}
+
+// Transition is an alert changing state, as handed to notify
+type Transition struct {
+	Rule   Rule                   `json:"rule"`
+	Alert  Alert                  `json:"alert"` // state after the change
+	At     time.Time              `json:"at"`    // evaluation time
+	From   time.Time              `json:"from"`  // window that was evaluated
+	To     time.Time              `json:"to"`
+	Notify map[string]NotifyState `json:"notify,omitempty"` // by channel, as broadcast to other replicas
+}
+
+// notifyStates is the part of the Dispatcher replicas share through
+// transitions, so that notifications follow a rule from owner to owner
+type notifyStates interface {
+	NotifyState(ruleID string) map[string]NotifyState
+	RestoreNotifyState(ruleID string, at time.Time, states map[string]NotifyState)
+}
+
+// Engine evaluates enabled rules on their intervals against the log store
+// and records state changes. Windows end delay before the evaluation time,
+// so entries still in the processing pipeline are not mistaken for absence.
+// With streaming enabled, streaming rules are instead counted from the live
+// feed and evaluated every second.
+type Engine struct {
+	logs     logstore.LogStore
+	rules    RuleStore
+	delay    time.Duration
+	notify   func(context.Context, Transition)
+	cluster  *Cluster     // nil when running alone
+	notified notifyStates // nil when running alone
+
+	mu      sync.Mutex
+	active  map[string]Rule        // enabled rules by ID
+	alerts  map[string]*Alert      // by rule ID
+	next    map[string]time.Time   // next evaluation by rule ID
+	streams map[string]*streamRule // streaming rules by ID, nil when streaming is disabled
+}
+
+// NewEngine returns an engine calling notify, if not nil, after each
+// recorded state change
+func NewEngine(logs logstore.LogStore, rules RuleStore, delay time.Duration, notify func(context.Context, Transition)) *Engine {
+	return &Engine{
+		logs:   logs,
+		rules:  rules,
+		delay:  delay,
+		notify: notify,
+		active: make(map[string]Rule),
+		alerts: make(map[string]*Alert),
+		next:   make(map[string]time.Time),
+	}
+}
+
+// EnableStreaming accepts streaming rules and shares evaluation with the
+// other members of cluster, along with what notified, if not nil, recorded of
+// the notifications sent. Call it before Load.
+func (e *Engine) EnableStreaming(cluster *Cluster, notified notifyStates) {
+	e.cluster = cluster
+	e.notified = notified
+	e.streams = make(map[string]*streamRule)
+}
+
+// Streaming reports whether streaming rules are accepted
+func (e *Engine) Streaming() bool {
+	return e.streams != nil
+}
+
+// Load reads the stored rules and restores each alert from its latest event
+func (e *Engine) Load(ctx context.Context) error {
+	rules, err := e.rules.ListRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		alert := &Alert{RuleID: rule.ID, RuleName: rule.Name, State: StateInactive}
+		events, err := e.rules.Events(ctx, rule.ID, 1)
+		if err != nil {
+			return err
+		}
+		if len(events) == 1 {
+			ev := events[0]
+			alert.State, alert.Value, alert.Message = ev.State, ev.Value, ev.Message
+			switch ev.State {
+			case StatePending:
+				alert.ActiveSince = ev.At
+			case StateFiring:
+				alert.ActiveSince, alert.FiredAt = ev.At, ev.At
+			case StateResolved:
+				alert.ResolvedAt = ev.At
+			}
+		}
+
+		e.mu.Lock()
+		e.alerts[rule.ID] = alert
+		e.mu.Unlock()
+		e.sync(rule)
+	}
+	return nil
+}
+
+// Sync starts evaluating a created or updated rule on the next tick, or
+// stops evaluating it once disabled, and tells the other replicas
+func (e *Engine) Sync(ctx context.Context, rule Rule) {
+	if !rule.Enabled {
+		e.Remove(ctx, rule.ID, "rule disabled")
+		return
+	}
+	e.sync(rule)
+	e.announce(rule.ID)
+}
+
+func (e *Engine) sync(rule Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active[rule.ID] = rule
+	if alert, ok := e.alerts[rule.ID]; ok {
+		alert.RuleName = rule.Name
+	} else {
+		e.alerts[rule.ID] = &Alert{RuleID: rule.ID, RuleName: rule.Name, State: StateInactive}
+	}
+	delete(e.next, rule.ID)
+
+	// Updated streaming rules start counting afresh
+	delete(e.streams, rule.ID)
+	if rule.Streaming && e.streams != nil {
+		e.streams[rule.ID] = newStreamRule(rule)
+	}
+}
+
+// Remove stops evaluating a rule and tells the other replicas. A firing
+// alert is resolved with reason.
+func (e *Engine) Remove(ctx context.Context, id, reason string) {
+	rule, alert, ok := e.remove(id)
+	e.announce(id)
+
+	if ok && alert.State == StateFiring {
+		now := time.Now().UTC()
+		alert.State, alert.ResolvedAt, alert.Message = StateResolved, now, reason
+		e.record(ctx, Transition{Rule: rule, Alert: *alert, At: now})
+	}
+}
+
+func (e *Engine) remove(id string) (Rule, *Alert, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rule := e.active[id]
+	alert, ok := e.alerts[id]
+	delete(e.active, id)
+	delete(e.alerts, id)
+	delete(e.next, id)
+	delete(e.streams, id)
+	return rule, alert, ok
+}
+
+// Reload picks up a rule another replica created, changed or deleted
+func (e *Engine) Reload(ctx context.Context, rules RuleStore, id string) {
+	rule, err := rules.GetRule(ctx, id)
+	switch {
+	case err == nil && rule.Enabled:
+		e.sync(rule)
+	case err == nil || errors.Is(err, ErrRuleNotFound):
+		e.remove(id)
+	default:
+		log.Printf("Failed to reload rule %s: %v", id, err)
+	}
+}
+
+// Apply takes an evaluation from the replica owning the rule, or a rule
+// removed on another replica, and the notifications it recorded
+func (e *Engine) Apply(t Transition) {
+	if e.notified != nil {
+		e.notified.RestoreNotifyState(t.Rule.ID, t.At, t.Notify)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if alert, ok := e.alerts[t.Rule.ID]; ok {
+		*alert = t.Alert
+	}
+}
+
+// broadcast hands an evaluation to the other replicas
+func (e *Engine) broadcast(t Transition) {
+	if e.notified != nil {
+		t.Notify = e.notified.NotifyState(t.Rule.ID)
+	}
+	e.cluster.publish(alertSubject, t)
+}
+
+func (e *Engine) announce(id string) {
+	if e.cluster != nil {
+		e.cluster.publish(ruleSubject, ruleChange{ID: id})
+	}
+}
+
+// Alerts returns the state of every enabled rule, ordered by rule name
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		alerts = append(alerts, *a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].RuleName != alerts[j].RuleName {
+			return alerts[i].RuleName < alerts[j].RuleName
+		}
+		return alerts[i].RuleID < alerts[j].RuleID
+	})
+	return alerts
+}
+
+// Alert returns the state of one enabled rule
+func (e *Engine) Alert(id string) (Alert, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.alerts[id]
+	if !ok {
+		return Alert{}, false
+	}
+	return *a, true
+}
+
+// Run evaluates due rules until ctx is cancelled
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.evaluateDue(ctx, now)
+		}
+	}
+}
+
+func (e *Engine) evaluateDue(ctx context.Context, now time.Time) {
+	e.mu.Lock()
+	var due []Rule
+	for id, rule := range e.active {
+		if next, ok := e.next[id]; !ok || !now.Before(next) {
+			interval := time.Duration(rule.Interval)
+			if rule.Streaming {
+				interval = streamInterval
+			}
+			e.next[id] = now.Add(interval)
+			if e.cluster == nil || e.cluster.Owns(id, now) {
+				due = append(due, rule)
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, rule := range due {
+		evalCtx, cancel := context.WithTimeout(ctx, evalTimeout)
+		e.Evaluate(evalCtx, rule, now)
+		cancel()
+	}
+}
+
+// Evaluate measures rule at now and moves its alert to the next state
+func (e *Engine) Evaluate(ctx context.Context, rule Rule, now time.Time) {
+	end := now.Add(-e.delay)
+	if rule.Streaming {
+		end = now
+	}
+	if rule.Type == RuleAnomaly {
+		end = end.Truncate(time.Duration(rule.Window))
+	}
+	value, active, message, err := e.measure(ctx, rule, end)
+
+	e.mu.Lock()
+	alert, ok := e.alerts[rule.ID]
+	if !ok {
+		// Removed while being measured
+		e.mu.Unlock()
+		return
+	}
+	alert.EvaluatedAt = now
+	if err != nil {
+		alert.Error = err.Error()
+		e.mu.Unlock()
+		log.Printf("Failed to evaluate rule %s (%s): %v", rule.ID, rule.Name, err)
+		return
+	}
+	alert.Error = ""
+	alert.Value, alert.Message = value, message
+	changed := transition(alert, rule, active, now)
+	t := Transition{Rule: rule, Alert: *alert, At: now, From: end.Add(-time.Duration(rule.Window)), To: end}
+	e.mu.Unlock()
+
+	if changed {
+		log.Printf("Alert %s (%s) is %s: %s", rule.ID, rule.Name, t.Alert.State, message)
+		e.record(ctx, t)
+	} else if e.cluster != nil {
+		// Keep the other replicas' values current
+		e.broadcast(t)
+	}
+}
+
+// record stores a state change and hands it to notify
+func (e *Engine) record(ctx context.Context, t Transition) {
+	event := Event{RuleID: t.Rule.ID, State: t.Alert.State, Value: t.Alert.Value, At: t.At, Message: t.Alert.Message}
+	if err := e.rules.RecordEvent(ctx, event); err != nil {
+		log.Printf("Failed to record alert event for rule %s: %v", event.RuleID, err)
+	}
+	if e.notify != nil {
+		e.notify(ctx, t)
+	}
+	if e.cluster != nil {
+		e.broadcast(t)
+	}
+}
+
+// transition applies one evaluation result to alert and reports whether its
+// state changed
+func transition(alert *Alert, rule Rule, active bool, now time.Time) bool {
+	prev := alert.State
+	switch {
+	case active && (prev == StateInactive || prev == StateResolved):
+		alert.ActiveSince = now
+		alert.State = StatePending
+		if rule.For == 0 {
+			alert.State = StateFiring
+			alert.FiredAt = now
+		}
+	case active && prev == StatePending:
+		if now.Sub(alert.ActiveSince) >= time.Duration(rule.For) {
+			alert.State = StateFiring
+			alert.FiredAt = now
+		}
+	case !active && prev == StatePending:
+		alert.State = StateInactive
+		alert.ActiveSince = time.Time{}
+	case !active && prev == StateFiring:
+		alert.State = StateResolved
+		alert.ResolvedAt = now
+		alert.ActiveSince = time.Time{}
+	}
+	return alert.State != prev
+}
+
+// measure counts the rule's entries in the window ending at end and decides
+// whether its condition holds
+func (e *Engine) measure(ctx context.Context, rule Rule, end time.Time) (float64, bool, string, error) {
+	window := time.Duration(rule.Window)
+	if rule.Type == RuleAnomaly {
+		return e.measureAnomaly(ctx, rule, end)
+	}
+	var current uint64
+	if rule.Streaming {
+		current = e.streamCount(rule, end)
+	} else {
+		var err error
+		if current, err = e.count(ctx, rule, end.Add(-window), end); err != nil {
+			return 0, false, "", err
+		}
+	}
+
+	switch rule.Type {
+	case RuleThreshold:
+		msg := fmt.Sprintf("%d %s in %v, threshold %g", current, rule.describe(), window, rule.Threshold)
+		return float64(current), float64(current) > rule.Threshold, msg, nil
+
+	case RuleAbsence:
+		msg := fmt.Sprintf("%d %s in %v", current, rule.describe(), window)
+		return float64(current), current == 0, msg, nil
+
+	case RuleRateChange:
+		previous, err := e.count(ctx, rule, end.Add(-2*window), end.Add(-window))
+		if err != nil {
+			return 0, false, "", err
+		}
+		if previous == 0 {
+			// No baseline to compare against
+			msg := fmt.Sprintf("%d %s in %v, none in the previous %v", current, rule.describe(), window, window)
+			return 0, false, msg, nil
+		}
+		change := (float64(current) - float64(previous)) / float64(previous) * 100
+		msg := fmt.Sprintf("%d %s in %v, %+.1f%% against %d in the previous %v", current, rule.describe(), window, change, previous, window)
+		return change, exceeds(rule, change), msg, nil
+	}
+	return 0, false, "", fmt.Errorf("unknown rule type %q", rule.Type)
+}
+
+// measureAnomaly scores the count of the last whole window before end
+// against a baseline of the windows before it
+func (e *Engine) measureAnomaly(ctx context.Context, rule Rule, end time.Time) (float64, bool, string, error) {
+	c, err := rule.anomalyConfig()
+	if err != nil {
+		return 0, false, "", err
+	}
+	window := time.Duration(rule.Window)
+	end = end.Truncate(window)
+	points := int(rule.Baseline/rule.Window) + 1
+	start := end.Add(-time.Duration(points) * window)
+
+	buckets, err := e.logs.Aggregate(ctx, logstore.AggregateQuery{
+		Query:    logstore.Query{Level: rule.Level, Service: rule.Service, From: start, To: end},
+		Interval: window,
+	})
+	if err != nil {
+		return 0, false, "", err
+	}
+	series := anomaly.NewSeries(start, window, points)
+	for _, b := range buckets {
+		series.Add(b.Time, float64(b.Count))
+	}
+
+	score, ok := anomaly.Detect(series.Values, c)
+	if !ok {
+		return 0, false, "", fmt.Errorf("baseline of %d windows is too short", points-1)
+	}
+	msg := fmt.Sprintf("%g %s in %v, baseline %.1f ± %.1f, score %+.1f", score.Value, rule.describe(), window,
+		score.Baseline, score.Spread, score.Score)
+	return score.Score, exceeds(rule, score.Score), msg, nil
+}
+
+// exceeds reports whether a change or score passes the rule's threshold in
+// its direction
+func exceeds(rule Rule, value float64) bool {
+	switch rule.Direction {
+	case DirectionUp:
+		return value >= rule.Threshold
+	case DirectionDown:
+		return -value >= rule.Threshold
+	case DirectionAny:
+		return math.Abs(value) >= rule.Threshold
+	}
+	return false
+}
+
+// count returns the number of matching entries in [from, to), counting
+// collapsed bursts as their repeat count
+func (e *Engine) count(ctx context.Context, rule Rule, from, to time.Time) (uint64, error) {
+	buckets, err := e.logs.Aggregate(ctx, logstore.AggregateQuery{
+		Query: logstore.Query{Level: rule.Level, Service: rule.Service, From: from, To: to},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, b := range buckets {
+		total += b.Count
+	}
+	return total, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+var now = time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+
+// logsAt returns n entries of service at level spread over the minute before at
+func logsAt(at time.Time, n int, level, service string) []models.LogEntry {
+	entries := make([]models.LogEntry, n)
+	for i := range entries {
+		entries[i] = models.LogEntry{
+			Timestamp: at.Add(-time.Duration(i+1) * time.Second),
+			Level:     level, Message: "m", Service: service,
+		}
+	}
+	return entries
+}
+
+func TestEngineThresholdLifecycle(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "errors", Type: RuleThreshold, Level: "error", Window: Duration(time.Minute),
+		Threshold: 3, For: Duration(2 * time.Minute), Interval: Duration(time.Minute), Enabled: true}
+	store := logstore.NewMemoryStore()
+	rules := NewMemoryRuleStore(rule)
+	engine := NewEngine(store, rules, 0, nil)
+	if err := engine.Load(context.Background()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	ctx := context.Background()
+
+	// A burst counts by its repeat count; info entries don't match
+	store.WriteBatch(ctx, []models.LogEntry{{Timestamp: now.Add(-10 * time.Second), Level: "error", Message: "timeout", Service: "api", RepeatCount: 4}})
+	store.WriteBatch(ctx, logsAt(now, 5, "info", "api"))
+
+	steps := []struct {
+		at    time.Time
+		write int // error entries written in the minute before at
+		state State
+	}{
+		{now, 0, StatePending},
+		{now.Add(time.Minute), 4, StatePending},
+		{now.Add(2 * time.Minute), 4, StateFiring},
+		{now.Add(3 * time.Minute), 4, StateFiring},
+		{now.Add(4 * time.Minute), 0, StateResolved},
+		{now.Add(5 * time.Minute), 0, StateResolved},
+		{now.Add(6 * time.Minute), 4, StatePending},
+		{now.Add(7 * time.Minute), 0, StateInactive},
+	}
+	for i, s := range steps {
+		store.WriteBatch(ctx, logsAt(s.at, s.write, "error", "api"))
+		engine.Evaluate(ctx, rule, s.at)
+		alert, _ := engine.Alert(rule.ID)
+		if alert.State != s.state {
+			t.Fatalf("step %d: expected %s, got %s (%s)", i, s.state, alert.State, alert.Message)
+		}
+	}
+
+	events, _ := rules.Events(ctx, rule.ID, 10)
+	var states []State
+	for i := len(events) - 1; i >= 0; i-- {
+		states = append(states, events[i].State)
+	}
+	expected := []State{StatePending, StateFiring, StateResolved, StatePending, StateInactive}
+	if len(states) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, states)
+			break
+		}
+	}
+}
+
+func TestEngineMeasure(t *testing.T) {
+	var entries []models.LogEntry
+	entries = append(entries, logsAt(now.Add(-time.Minute), 2, "info", "billing")...) // previous window
+	entries = append(entries, logsAt(now, 6, "info", "billing")...)                   // current window
+	engine := NewEngine(logstore.NewMemoryStore(entries...), NewMemoryRuleStore(), 0, nil)
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		value  float64
+		active bool
+	}{
+		{"threshold above", Rule{Type: RuleThreshold, Service: "billing", Threshold: 5}, 6, true},
+		{"threshold equal", Rule{Type: RuleThreshold, Service: "billing", Threshold: 6}, 6, false},
+		{"absence present", Rule{Type: RuleAbsence, Service: "billing"}, 6, false},
+		{"absence missing", Rule{Type: RuleAbsence, Service: "shipping"}, 0, true},
+		{"rate up", Rule{Type: RuleRateChange, Service: "billing", Threshold: 200, Direction: DirectionUp}, 200, true},
+		{"rate down", Rule{Type: RuleRateChange, Service: "billing", Threshold: 50, Direction: DirectionDown}, 200, false},
+		{"rate any", Rule{Type: RuleRateChange, Service: "billing", Threshold: 250, Direction: DirectionAny}, 200, false},
+		{"rate without baseline", Rule{Type: RuleRateChange, Service: "shipping", Threshold: 10, Direction: DirectionAny}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Window = Duration(time.Minute)
+			value, active, msg, err := engine.measure(context.Background(), tt.rule, now)
+			if err != nil {
+				t.Fatalf("measure failed: %v", err)
+			}
+			if value != tt.value || active != tt.active {
+				t.Errorf("expected %v/%v, got %v/%v (%s)", tt.value, tt.active, value, active, msg)
+			}
+		})
+	}
+}
+
+func TestEngineMeasureAnomaly(t *testing.T) {
+	// Eight quiet hours of billing errors before a loud one
+	var entries []models.LogEntry
+	for i := 1; i <= 9; i++ {
+		n := 10 + i%3
+		if i == 1 {
+			n = 60
+		}
+		entries = append(entries, logsAt(now.Add(-time.Duration(i-1)*time.Hour), n, "error", "billing")...)
+	}
+	engine := NewEngine(logstore.NewMemoryStore(entries...), NewMemoryRuleStore(), 0, nil)
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		active bool
+	}{
+		{"up", Rule{Direction: DirectionUp}, true},
+		{"down", Rule{Direction: DirectionDown}, false},
+		{"seasonal", Rule{Direction: DirectionAny, Method: "seasonal", Season: Duration(2 * time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Name, rule.Type, rule.Level, rule.Service = "unusual", RuleAnomaly, "error", "billing"
+			rule.Window, rule.Baseline, rule.Threshold = Duration(time.Hour), Duration(8*time.Hour), 3
+			if err := rule.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			// An end within the hour scores the last whole one
+			score, active, msg, err := engine.measure(context.Background(), rule, now.Add(10*time.Minute))
+			if err != nil {
+				t.Fatalf("measure failed: %v", err)
+			}
+			if active != tt.active || score < 3 || !strings.Contains(msg, "60 error entries of billing in 1h0m0s") {
+				t.Errorf("expected active %v, got %v/%v (%s)", tt.active, score, active, msg)
+			}
+		})
+	}
+}
+
+func TestEngineRestoresAndRemoves(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "quiet", Type: RuleAbsence, Service: "billing", Window: Duration(time.Minute),
+		Interval: Duration(time.Minute), Enabled: true}
+	disabled := Rule{ID: "r2", Name: "off", Type: RuleAbsence, Service: "billing", Window: Duration(time.Minute)}
+	rules := NewMemoryRuleStore(rule, disabled)
+	rules.RecordEvent(context.Background(), Event{RuleID: "r1", State: StateFiring, At: now})
+
+	engine := NewEngine(logstore.NewMemoryStore(), rules, 0, nil)
+	if err := engine.Load(context.Background()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if alerts := engine.Alerts(); len(alerts) != 1 || alerts[0].State != StateFiring || !alerts[0].FiredAt.Equal(now) {
+		t.Fatalf("expected the firing alert to be restored, got %+v", alerts)
+	}
+
+	// Removing a firing alert resolves it
+	engine.Remove(context.Background(), "r1", "rule deleted")
+	events, _ := rules.Events(context.Background(), "r1", 1)
+	if len(engine.Alerts()) != 0 || len(events) != 1 || events[0].State != StateResolved {
+		t.Errorf("expected the alert to be resolved and removed, got %+v", events)
+	}
+}
+
+func TestEngineEvaluateDue(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "quiet", Type: RuleAbsence, Service: "billing", Window: Duration(time.Minute),
+		Interval: Duration(time.Minute), Enabled: true}
+	rules := NewMemoryRuleStore()
+	engine := NewEngine(logstore.NewMemoryStore(), rules, 0, nil)
+	engine.Sync(context.Background(), rule)
+
+	engine.evaluateDue(context.Background(), now)
+	engine.evaluateDue(context.Background(), now.Add(30*time.Second)) // not due yet
+	engine.evaluateDue(context.Background(), now.Add(time.Minute))
+
+	alert, _ := engine.Alert(rule.ID)
+	if alert.State != StateFiring || !alert.EvaluatedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected two evaluations ending in firing, got %+v", alert)
+	}
+	if events, _ := rules.Events(context.Background(), rule.ID, 10); len(events) != 1 {
+		t.Errorf("expected a single firing event, got %+v", events)
+	}
+}
+
+func TestEngineNotifiesTransitions(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "quiet", Type: RuleAbsence, Service: "billing", Window: Duration(time.Minute), Enabled: true}
+	var got []Transition
+	engine := NewEngine(logstore.NewMemoryStore(), NewMemoryRuleStore(), 30*time.Second, func(_ context.Context, t Transition) {
+		got = append(got, t)
+	})
+	engine.Sync(context.Background(), rule)
+
+	engine.Evaluate(context.Background(), rule, now)
+	engine.Evaluate(context.Background(), rule, now.Add(time.Minute)) // still firing
+	engine.Remove(context.Background(), rule.ID, "rule deleted")
+
+	if len(got) != 2 || got[0].Alert.State != StateFiring || got[1].Alert.State != StateResolved {
+		t.Fatalf("expected firing then resolved, got %+v", got)
+	}
+	if !got[0].To.Equal(now.Add(-30*time.Second)) || !got[0].From.Equal(now.Add(-90*time.Second)) {
+		t.Errorf("expected the delayed window, got %v to %v", got[0].From, got[0].To)
+	}
+	if got[1].Alert.Message != "rule deleted" || got[1].Rule.ID != rule.ID {
+		t.Errorf("unexpected resolve on removal: %+v", got[1])
+	}
+}
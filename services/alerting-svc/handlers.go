@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+	maxRuleBytes      = 64 << 10
+)
+
+// newRouter wires the rule CRUD, alert state and notification API
+func newRouter(rules RuleStore, engine *Engine, dispatcher *Dispatcher) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(corsMiddleware)
+
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":    "ok",
+			"service":   "alerting-svc",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		})
+	})
+
+	r.Get("/api/alerts", listAlertsHandler(engine))
+	r.Get("/api/alerts/rules", listRulesHandler(rules))
+	r.Post("/api/alerts/rules", createRuleHandler(rules, engine, dispatcher))
+	r.Get("/api/alerts/rules/{id}", getRuleHandler(rules))
+	r.Put("/api/alerts/rules/{id}", updateRuleHandler(rules, engine, dispatcher))
+	r.Delete("/api/alerts/rules/{id}", deleteRuleHandler(rules, engine))
+	r.Get("/api/alerts/rules/{id}/events", eventsHandler(rules))
+	r.Get("/api/alerts/silences", listSilencesHandler(rules))
+	r.Post("/api/alerts/silences", createSilenceHandler(rules))
+	r.Delete("/api/alerts/silences/{id}", deleteSilenceHandler(rules))
+	r.Get("/api/alerts/channels", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, dispatcher.Channels())
+	})
+	r.Post("/api/alerts/channels/{name}/test", testChannelHandler(dispatcher))
+	return r
+}
+
+// listAlertsHandler returns the state of every enabled rule, optionally
+// filtered by ?state=
+func listAlertsHandler(engine *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := State(r.URL.Query().Get("state"))
+		switch state {
+		case "", StateInactive, StatePending, StateFiring, StateResolved:
+		default:
+			http.Error(w, "invalid state, expected inactive, pending, firing or resolved", http.StatusBadRequest)
+			return
+		}
+
+		alerts := []Alert{}
+		for _, a := range engine.Alerts() {
+			if state == "" || a.State == state {
+				alerts = append(alerts, a)
+			}
+		}
+		writeJSON(w, http.StatusOK, alerts)
+	}
+}
+
+func listRulesHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := rules.ListRules(r.Context())
+		if err != nil {
+			log.Printf("DB error (list rules): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []Rule{}
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func createRuleHandler(rules RuleStore, engine *Engine, dispatcher *Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := decodeRule(w, r, engine, dispatcher)
+		if !ok {
+			return
+		}
+		rule.ID = uuid.Must(uuid.NewV7()).String()
+		rule.CreatedAt = time.Now().UTC()
+		rule.UpdatedAt = rule.CreatedAt
+
+		if err := rules.SaveRule(r.Context(), rule); err != nil {
+			log.Printf("DB error (create rule): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		engine.Sync(r.Context(), rule)
+		writeJSON(w, http.StatusCreated, rule)
+	}
+}
+
+func getRuleHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := loadRule(w, r, rules)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	}
+}
+
+// updateRuleHandler replaces a rule, keeping its ID and creation time
+func updateRuleHandler(rules RuleStore, engine *Engine, dispatcher *Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		existing, ok := loadRule(w, r, rules)
+		if !ok {
+			return
+		}
+		rule, ok := decodeRule(w, r, engine, dispatcher)
+		if !ok {
+			return
+		}
+		rule.ID = existing.ID
+		rule.CreatedAt = existing.CreatedAt
+		rule.UpdatedAt = time.Now().UTC()
+
+		if err := rules.SaveRule(r.Context(), rule); err != nil {
+			log.Printf("DB error (update rule): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		engine.Sync(r.Context(), rule)
+		writeJSON(w, http.StatusOK, rule)
+	}
+}
+
+func deleteRuleHandler(rules RuleStore, engine *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		err := rules.DeleteRule(r.Context(), id)
+		if errors.Is(err, ErrRuleNotFound) {
+			http.Error(w, "alert rule not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("DB error (delete rule): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		engine.Remove(r.Context(), id, "rule deleted")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// eventsHandler returns the state changes of a rule, newest first
+func eventsHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultEventLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxEventLimit {
+				http.Error(w, "invalid limit, expected 1 to 1000", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		id := chi.URLParam(r, "id")
+		events, err := rules.Events(r.Context(), id, limit)
+		if err != nil {
+			log.Printf("DB error (alert events): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if events == nil {
+			events = []Event{}
+		}
+		writeJSON(w, http.StatusOK, events)
+	}
+}
+
+// decodeRule reads and validates a rule from the request body. Rules are
+// enabled unless the body says otherwise.
+func decodeRule(w http.ResponseWriter, r *http.Request, engine *Engine, dispatcher *Dispatcher) (Rule, bool) {
+	rule := Rule{Enabled: true}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+		return rule, false
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+		return rule, false
+	}
+	if rule.Streaming && !engine.Streaming() {
+		http.Error(w, "invalid rule: streaming is not enabled", http.StatusBadRequest)
+		return rule, false
+	}
+	for _, c := range rule.Channels {
+		if !dispatcher.HasChannel(c) {
+			http.Error(w, fmt.Sprintf("invalid rule: unknown channel %q", c), http.StatusBadRequest)
+			return rule, false
+		}
+	}
+	return rule, true
+}
+
+// testChannelHandler sends a placeholder firing notification to a channel and
+// reports the delivery error if any
+func testChannelHandler(dispatcher *Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		if !dispatcher.HasChannel(name) {
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+		rule := Rule{ID: "test", Name: "Test notification", Type: RuleThreshold, Window: Duration(time.Minute)}
+		if err := dispatcher.Test(r.Context(), name, rule); err != nil {
+			http.Error(w, "delivery failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func loadRule(w http.ResponseWriter, r *http.Request, rules RuleStore) (Rule, bool) {
+	rule, err := rules.GetRule(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrRuleNotFound) {
+		http.Error(w, "alert rule not found", http.StatusNotFound)
+		return rule, false
+	}
+	if err != nil {
+		log.Printf("DB error (get rule): %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return rule, false
+	}
+	return rule, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// CORS middleware
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
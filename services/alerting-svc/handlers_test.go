@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+func TestRuleCRUD(t *testing.T) {
+	rules := NewMemoryRuleStore()
+	engine := NewEngine(logstore.NewMemoryStore(), rules, 0, nil)
+	router := newRouter(rules, engine, testDispatcher(t))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+
+	w := do("POST", "/api/alerts/rules", `{"name":"payment errors","type":"threshold","level":"error","service":"payment-api","window":"5m","threshold":100}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created Rule
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.ID == "" || !created.Enabled || created.CreatedAt.IsZero() {
+		t.Errorf("expected an enabled rule with an ID, got %+v", created)
+	}
+	if alerts := engine.Alerts(); len(alerts) != 1 || alerts[0].State != StateInactive {
+		t.Errorf("expected the engine to track the new rule, got %+v", alerts)
+	}
+
+	tests := []struct {
+		name           string
+		method, url    string
+		body           string
+		expectedStatus int
+	}{
+		{"get", "GET", "/api/alerts/rules/" + created.ID, "", http.StatusOK},
+		{"list", "GET", "/api/alerts/rules", "", http.StatusOK},
+		{"invalid", "POST", "/api/alerts/rules", `{"name":"x","type":"threshold"}`, http.StatusBadRequest},
+		{"streaming disabled", "POST", "/api/alerts/rules", `{"name":"x","type":"threshold","window":"1m","streaming":true}`, http.StatusBadRequest},
+		{"unknown field", "POST", "/api/alerts/rules", `{"name":"x","type":"absence","service":"a","window":"1m","query":"x"}`, http.StatusBadRequest},
+		{"get unknown", "GET", "/api/alerts/rules/nope", "", http.StatusNotFound},
+		{"update unknown", "PUT", "/api/alerts/rules/nope", `{"name":"x","type":"absence","service":"a","window":"1m"}`, http.StatusNotFound},
+		{"bad state", "GET", "/api/alerts?state=loud", "", http.StatusBadRequest},
+		{"bad events limit", "GET", "/api/alerts/rules/" + created.ID + "/events?limit=0", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.url, tt.body); w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Disabling keeps the rule but stops evaluating it
+	w = do("PUT", "/api/alerts/rules/"+created.ID, `{"name":"payment errors","type":"threshold","level":"error","window":"10m","threshold":50,"enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated Rule
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.ID != created.ID || !updated.CreatedAt.Equal(created.CreatedAt) || updated.Threshold != 50 {
+		t.Errorf("unexpected update: %+v", updated)
+	}
+	if len(engine.Alerts()) != 0 {
+		t.Errorf("expected disabled rules to be dropped from the engine")
+	}
+
+	if w := do("DELETE", "/api/alerts/rules/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	if w := do("DELETE", "/api/alerts/rules/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a deleted rule, got %d", w.Code)
+	}
+}
+
+func TestListAlerts(t *testing.T) {
+	rules := NewMemoryRuleStore()
+	engine := NewEngine(logstore.NewMemoryStore(), rules, 0, nil)
+	for _, id := range []string{"a", "b"} {
+		engine.Sync(t.Context(), Rule{ID: id, Name: id, Type: RuleAbsence, Service: id, Window: Duration(time.Minute), Enabled: true})
+	}
+	engine.Evaluate(t.Context(), Rule{ID: "a", Name: "a", Type: RuleAbsence, Service: "a", Window: Duration(time.Minute)}, now)
+
+	w := httptest.NewRecorder()
+	newRouter(rules, engine, testDispatcher(t)).ServeHTTP(w, httptest.NewRequest("GET", "/api/alerts?state=firing", nil))
+	var alerts []Alert
+	json.NewDecoder(w.Body).Decode(&alerts)
+	if len(alerts) != 1 || alerts[0].RuleID != "a" {
+		t.Errorf("expected only the firing alert, got %+v", alerts)
+	}
+}
+
+func TestSilencesAndChannels(t *testing.T) {
+	rules := NewMemoryRuleStore(Rule{ID: "r1", Name: "quiet", Type: RuleAbsence, Service: "a", Window: Duration(time.Minute)})
+	dispatcher, err := NewDispatcher(DefaultDispatchConfig(), logstore.NewMemoryStore(), rules,
+		[]Channel{{Name: "team", Type: ChannelSlack, URL: "http://127.0.0.1:1"}})
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	router := newRouter(rules, NewEngine(logstore.NewMemoryStore(), rules, 0, nil), dispatcher)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+	ends := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		method, url    string
+		body           string
+		expectedStatus int
+	}{
+		{"rule with channel", "POST", "/api/alerts/rules", `{"name":"x","type":"absence","service":"a","window":"1m","channels":["team"]}`, http.StatusCreated},
+		{"rule with unknown channel", "POST", "/api/alerts/rules", `{"name":"x","type":"absence","service":"a","window":"1m","channels":["pager"]}`, http.StatusBadRequest},
+		{"silence", "POST", "/api/alerts/silences", `{"rule_id":"r1","ends_at":"` + ends + `","comment":"maintenance"}`, http.StatusCreated},
+		{"silence everything", "POST", "/api/alerts/silences", `{"ends_at":"` + ends + `"}`, http.StatusCreated},
+		{"silence in the past", "POST", "/api/alerts/silences", `{"ends_at":"2020-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"silence unknown rule", "POST", "/api/alerts/silences", `{"rule_id":"nope","ends_at":"` + ends + `"}`, http.StatusBadRequest},
+		{"delete unknown silence", "DELETE", "/api/alerts/silences/nope", "", http.StatusNotFound},
+		{"test unknown channel", "POST", "/api/alerts/channels/pager/test", "", http.StatusNotFound},
+		{"test unreachable channel", "POST", "/api/alerts/channels/team/test", "", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.url, tt.body); w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	var silences []Silence
+	json.NewDecoder(do("GET", "/api/alerts/silences", "").Body).Decode(&silences)
+	if len(silences) != 2 {
+		t.Fatalf("expected 2 silences, got %+v", silences)
+	}
+	if w := do("DELETE", "/api/alerts/silences/"+silences[0].ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+
+	var channels []ChannelStats
+	json.NewDecoder(do("GET", "/api/alerts/channels", "").Body).Decode(&channels)
+	if len(channels) != 1 || channels[0].Name != "team" || channels[0].Type != ChannelSlack {
+		t.Errorf("unexpected channels: %+v", channels)
+	}
+}
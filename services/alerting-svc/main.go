@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/nats-io/nats.go"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+const defaultEvalDelay = 30 * time.Second
+
+func main() {
+	chDSN := os.Getenv("CLICKHOUSE_DSN")
+	if chDSN == "" {
+		chDSN = "clickhouse://default:@clickhouse:9000/default"
+	}
+	db, err := sql.Open("clickhouse", chDSN)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer db.Close()
+
+	// Windows end this far in the past to leave time for batching
+	evalDelay := defaultEvalDelay
+	if v := os.Getenv("ALERT_EVAL_DELAY"); v != "" {
+		evalDelay, err = time.ParseDuration(v)
+		if err != nil || evalDelay < 0 {
+			log.Fatalf("Invalid ALERT_EVAL_DELAY %q", v)
+		}
+	}
+
+	// Notification channels and delivery
+	var channels []Channel
+	if path := os.Getenv("NOTIFY_CHANNELS_FILE"); path != "" {
+		channels, err = LoadChannels(path)
+		if err != nil {
+			log.Fatalf("Failed to load notification channels: %v", err)
+		}
+	}
+	dispatchConfig, err := LoadDispatchConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid notification config: %v", err)
+	}
+	logs := logstore.NewClickHouseStore(db)
+	rules := NewClickHouseRuleStore(db)
+	dispatcher, err := NewDispatcher(dispatchConfig, logs, rules, channels)
+	if err != nil {
+		log.Fatalf("Invalid notification channels: %v", err)
+	}
+
+	engine := NewEngine(logs, rules, evalDelay, dispatcher.Dispatch)
+
+	// Streaming rules count the live feed; replicas share it through NATS
+	var cluster *Cluster
+	if os.Getenv("STREAMING_ENABLED") == "true" {
+		natsURL := os.Getenv("NATS_URL")
+		if natsURL == "" {
+			natsURL = "nats://nats:4222"
+		}
+		nc, err := nats.Connect(natsURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+		}
+		defer nc.Drain()
+
+		hostname, _ := os.Hostname()
+		cluster = NewCluster(nc, hostname, time.Now())
+		engine.EnableStreaming(cluster, dispatcher)
+	}
+
+	if err := engine.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load alert rules: %v", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	evaluated := make(chan struct{})
+	go func() {
+		defer close(evaluated)
+		engine.Run(ctx)
+	}()
+	clustered := make(chan struct{})
+	if cluster != nil {
+		go func() {
+			defer close(clustered)
+			if err := cluster.Run(ctx, engine, rules); err != nil {
+				log.Fatalf("Streaming evaluation failed: %v", err)
+			}
+		}()
+	} else {
+		close(clustered)
+	}
+
+	addr := ":8083"
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      newRouter(rules, engine, dispatcher),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	go func() {
+		log.Printf("Alerting service listening on %s, %d rules loaded, %d notification channels, evaluation delay %v, streaming %v",
+			addr, len(engine.Alerts()), len(channels), evalDelay, engine.Streaming())
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	log.Printf("Shutdown signal received, stopping gracefully...")
+
+	// Everything that dispatches transitions stops before the dispatcher:
+	// the HTTP server, the evaluation loop and the cluster subscriptions
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+	stop()
+	<-evaluated
+	<-clustered
+
+	dispatcher.Stop(shutdownCtx)
+	log.Printf("Alerting service stopped")
+}
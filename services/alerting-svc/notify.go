@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// ChannelType selects how a channel delivers notifications
+type ChannelType string
+
+const (
+	ChannelWebhook ChannelType = "webhook" // JSON POST signed with HMAC-SHA256
+	ChannelSlack   ChannelType = "slack"   // Slack-compatible incoming webhook
+	ChannelEmail   ChannelType = "email"   // plain text mail over SMTP
+)
+
+// Channel configures one notification destination. Rules refer to channels
+// by name.
+type Channel struct {
+	Name string      `json:"name"`
+	Type ChannelType `json:"type"`
+
+	// webhook and slack
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"` // webhook signing key
+
+	// email
+	SMTPAddr string   `json:"smtp_addr,omitempty"` // host:port
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+
+	// Go text/template overrides, executed with a Notification
+	TitleTemplate string `json:"title_template,omitempty"`
+	BodyTemplate  string `json:"body_template,omitempty"`
+}
+
+const (
+	defaultTitleTemplate = `[{{.Alert.State}}] {{.Rule.Name}}`
+	defaultBodyTemplate  = `{{.Alert.Message}}
+{{- if .Samples}}
+
+Sample entries:
+{{- range .Samples}}
+{{.Timestamp.UTC.Format "2006-01-02T15:04:05Z"}} [{{.Level}}] {{.Service}}: {{.Message}}
+{{- end}}
+{{- end}}`
+)
+
+// Notification is an alert state change as rendered for a channel
+type Notification struct {
+	Rule    Rule              `json:"rule"`
+	Alert   Alert             `json:"alert"`
+	Samples []models.LogEntry `json:"samples,omitempty"` // matching entries from the evaluated window
+}
+
+// Notifier delivers notifications to one channel
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// permanentError marks failures that retrying cannot fix, such as a rejected
+// payload or unknown recipient
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// LoadChannels reads a JSON array of channels from path
+func LoadChannels(path string) ([]Channel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var channels []Channel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return channels, nil
+}
+
+// NewNotifier validates c and returns its notifier
+func NewNotifier(c Channel) (Notifier, error) {
+	if c.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	tmpl, err := newMessageTemplate(c)
+	if err != nil {
+		return nil, fmt.Errorf("channel %q: %w", c.Name, err)
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+
+	switch c.Type {
+	case ChannelWebhook, ChannelSlack:
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return nil, fmt.Errorf("channel %q: url must be http or https", c.Name)
+		}
+		if c.Type == ChannelWebhook {
+			return &webhookNotifier{url: c.URL, secret: []byte(c.Secret), tmpl: tmpl, client: client}, nil
+		}
+		return &slackNotifier{url: c.URL, tmpl: tmpl, client: client}, nil
+	case ChannelEmail:
+		host, _, err := net.SplitHostPort(c.SMTPAddr)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: smtp_addr must be host:port", c.Name)
+		}
+		if c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("channel %q: from and to are required", c.Name)
+		}
+		var auth smtp.Auth
+		if c.Username != "" {
+			auth = smtp.PlainAuth("", c.Username, c.Password, host)
+		}
+		return &emailNotifier{addr: c.SMTPAddr, auth: auth, from: c.From, to: c.To, tmpl: tmpl}, nil
+	}
+	return nil, fmt.Errorf("channel %q: invalid type %q, expected webhook, slack or email", c.Name, c.Type)
+}
+
+type messageTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+func newMessageTemplate(c Channel) (*messageTemplate, error) {
+	title, body := c.TitleTemplate, c.BodyTemplate
+	if title == "" {
+		title = defaultTitleTemplate
+	}
+	if body == "" {
+		body = defaultBodyTemplate
+	}
+	t := &messageTemplate{}
+	var err error
+	if t.title, err = template.New("title").Parse(title); err != nil {
+		return nil, fmt.Errorf("title_template: %w", err)
+	}
+	if t.body, err = template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("body_template: %w", err)
+	}
+	return t, nil
+}
+
+// render returns the title, on a single line, and body of n
+func (t *messageTemplate) render(n Notification) (string, string, error) {
+	var title, body strings.Builder
+	if err := t.title.Execute(&title, n); err != nil {
+		return "", "", permanentError{fmt.Errorf("title_template: %w", err)}
+	}
+	if err := t.body.Execute(&body, n); err != nil {
+		return "", "", permanentError{fmt.Errorf("body_template: %w", err)}
+	}
+	return strings.Join(strings.Fields(title.String()), " "), body.String(), nil
+}
+
+// webhookNotifier posts the notification as JSON. The body is signed with
+// HMAC-SHA256 over "<timestamp>.<body>" so receivers can reject forged and
+// replayed requests.
+type webhookNotifier struct {
+	url    string
+	secret []byte
+	tmpl   *messageTemplate
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Notification
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	title, text, err := w.tmpl.render(n)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{Notification: n, Title: title, Text: text})
+	if err != nil {
+		return permanentError{err}
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if len(w.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set("X-OgLogStream-Timestamp", ts)
+		header.Set("X-OgLogStream-Signature", "sha256="+signWebhook(w.secret, ts, body))
+	}
+	return postJSON(ctx, w.client, w.url, header, body)
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// slackNotifier posts {"text": ...} as accepted by Slack, Mattermost and
+// Rocket.Chat incoming webhooks
+type slackNotifier struct {
+	url    string
+	tmpl   *messageTemplate
+	client *http.Client
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, n Notification) error {
+	title, text, err := s.tmpl.render(n)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": "*" + title + "*\n" + text})
+	if err != nil {
+		return permanentError{err}
+	}
+	return postJSON(ctx, s.client, s.url, http.Header{"Content-Type": {"application/json"}}, body)
+}
+
+// postJSON treats 2xx as delivered and other 4xx than 408 and 429 as permanent
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned %s", url, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// emailNotifier sends plain text mail, upgrading to STARTTLS when the server
+// offers it. PLAIN auth is refused without TLS unless the server is local.
+type emailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	tmpl *messageTemplate
+}
+
+func (e *emailNotifier) Notify(ctx context.Context, n Notification) error {
+	title, text, err := e.tmpl.render(n)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	err = e.send(ctx, msg.Bytes())
+	var proto *textproto.Error
+	if errors.As(err, &proto) && proto.Code >= 500 {
+		return permanentError{err}
+	}
+	return err
+}
+
+// send runs the SMTP exchange on a connection bound by ctx's deadline, or
+// notifyTimeout without one
+func (e *emailNotifier) send(ctx context.Context, msg []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(notifyTimeout)
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(e.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Rule: Rule{ID: "r1", Name: "Payment errors", Type: RuleThreshold, Level: "error", Window: Duration(5 * time.Minute), Threshold: 100},
+		Alert: Alert{RuleID: "r1", RuleName: "Payment errors", State: StateFiring, Value: 154,
+			Message: "154 error entries of payment-api in 5m0s, threshold 100"},
+		Samples: []models.LogEntry{
+			{Timestamp: now, Level: "error", Service: "payment-api", Message: "card declined"},
+		},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(Channel{Name: "hook", Type: ChannelWebhook, URL: srv.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	ts := got.Header.Get("X-OgLogStream-Timestamp")
+	if sig := got.Header.Get("X-OgLogStream-Signature"); sig != "sha256="+signWebhook([]byte("s3cret"), ts, body) {
+		t.Errorf("signature %q does not match the body", sig)
+	}
+	var payload struct {
+		Title   string            `json:"title"`
+		Text    string            `json:"text"`
+		Alert   Alert             `json:"alert"`
+		Samples []models.LogEntry `json:"samples"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.Title != "[firing] Payment errors" || payload.Alert.Value != 154 || len(payload.Samples) != 1 {
+		t.Errorf("unexpected payload: %s", body)
+	}
+	if !strings.Contains(payload.Text, "2025-07-24T16:00:00Z [error] payment-api: card declined") {
+		t.Errorf("expected sample lines in the text, got %q", payload.Text)
+	}
+}
+
+func TestSlackNotifierTemplates(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(Channel{Name: "slack", Type: ChannelSlack, URL: srv.URL,
+		TitleTemplate: "{{.Rule.Name}} is {{.Alert.State}}", BodyTemplate: "value {{.Alert.Value}}, {{len .Samples}} samples"})
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if payload["text"] != "*Payment errors is firing*\nvalue 154, 1 samples" {
+		t.Errorf("unexpected text %q", payload["text"])
+	}
+}
+
+func TestHTTPNotifierErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	n, _ := NewNotifier(Channel{Name: "slack", Type: ChannelSlack, URL: srv.URL})
+
+	if err := n.Notify(context.Background(), testNotification()); !isPermanent(err) {
+		t.Errorf("expected a permanent error for 400, got %v", err)
+	}
+	for _, status = range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		if err := n.Notify(context.Background(), testNotification()); err == nil || isPermanent(err) {
+			t.Errorf("expected a retryable error for %d, got %v", status, err)
+		}
+	}
+}
+
+func TestNewNotifierValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel Channel
+	}{
+		{"no name", Channel{Type: ChannelSlack, URL: "https://hooks.example.com"}},
+		{"bad type", Channel{Name: "x", Type: "pager"}},
+		{"bad url", Channel{Name: "x", Type: ChannelWebhook, URL: "ftp://example.com"}},
+		{"bad template", Channel{Name: "x", Type: ChannelSlack, URL: "https://hooks.example.com", BodyTemplate: "{{.Nope"}},
+		{"no smtp port", Channel{Name: "x", Type: ChannelEmail, SMTPAddr: "smtp", From: "a@example.com", To: []string{"b@example.com"}}},
+		{"no recipients", Channel{Name: "x", Type: ChannelEmail, SMTPAddr: "smtp:25", From: "a@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNotifier(tt.channel); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// smtpStandIn accepts mail on a local port and keeps the DATA of each message.
+// Recipients in reject get a permanent 550.
+type smtpStandIn struct {
+	ln       net.Listener
+	reject   string
+	mu       sync.Mutex
+	messages []string
+}
+
+func newSMTPStandIn(t *testing.T, reject string) *smtpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpStandIn{ln: ln, reject: reject}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT") && s.reject != "" && strings.Contains(cmd, strings.ToUpper(s.reject)):
+			reply("550 no such user")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"), strings.HasPrefix(cmd, "RSET"), strings.HasPrefix(cmd, "NOOP"):
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	smtpd := newSMTPStandIn(t, "nobody@example.com")
+	channel := Channel{Name: "ops", Type: ChannelEmail, SMTPAddr: smtpd.ln.Addr().String(),
+		From: "alerts@example.com", To: []string{"oncall@example.com"}}
+
+	n, err := NewNotifier(channel)
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if err := n.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(smtpd.messages) != 1 {
+		t.Fatalf("expected one message, got %d", len(smtpd.messages))
+	}
+	msg := smtpd.messages[0]
+	for _, want := range []string{"To: oncall@example.com", "Subject: [firing] Payment errors", "payment-api: card declined"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in message:\n%s", want, msg)
+		}
+	}
+
+	channel.To = []string{"nobody@example.com"}
+	n, _ = NewNotifier(channel)
+	if err := n.Notify(context.Background(), testNotification()); !isPermanent(err) {
+		t.Errorf("expected a permanent error for a rejected recipient, got %v", err)
+	}
+}
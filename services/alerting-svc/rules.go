@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourusername/oglogstream-anomaly"
+)
+
+const (
+	defaultInterval = time.Minute
+	minInterval     = 10 * time.Second
+	maxWindow       = 7 * 24 * time.Hour
+
+	defaultBaseline = 7 * 24 * time.Hour
+	defaultSeason   = 24 * time.Hour
+	maxBaseline     = 30 * 24 * time.Hour
+	maxBaselineSize = 7 * 24 * 60 // windows
+)
+
+// RuleType selects how a rule turns log counts into a firing condition
+type RuleType string
+
+const (
+	RuleThreshold  RuleType = "threshold"   // count over the window above threshold
+	RuleAbsence    RuleType = "absence"     // no entries over the window
+	RuleRateChange RuleType = "rate_change" // count changed by threshold percent against the previous window
+	RuleAnomaly    RuleType = "anomaly"     // count scored threshold deviations away from the baseline of past windows
+)
+
+// Direction selects which changes rate_change and anomaly rules fire on
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+	DirectionAny  Direction = "any"
+)
+
+// Rule is a user-defined alert over the entries matching Level and Service
+type Rule struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      RuleType  `json:"type"`
+	Level     string    `json:"level,omitempty"`   // exact level
+	Service   string    `json:"service,omitempty"` // case-insensitive substring, as in /api/logs
+	Window    Duration  `json:"window"`
+	Threshold float64   `json:"threshold,omitempty"` // count for threshold, percent for rate_change, score for anomaly
+	Direction Direction `json:"direction,omitempty"` // rate_change and anomaly only, default up
+	For       Duration  `json:"for,omitempty"`       // how long the condition holds before firing
+	Interval  Duration  `json:"interval,omitempty"`  // evaluation interval, default 1m
+	Baseline  Duration  `json:"baseline,omitempty"`  // anomaly only: history the baseline learns from, default 7d
+	Method    string    `json:"method,omitempty"`    // anomaly only: ewma (default) or seasonal
+	Season    Duration  `json:"season,omitempty"`    // seasonal anomaly only: cycle length, default 24h
+	Channels  []string  `json:"channels,omitempty"`  // notified when the alert fires and resolves
+	Streaming bool      `json:"streaming,omitempty"` // count the live feed instead of querying ClickHouse
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Duration is a time.Duration written as a Go duration string, e.g. "5m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("duration must be a string such as \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+var validLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true, "fatal": true}
+
+// Validate checks r and fills in defaults
+func (r *Rule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Level != "" && !validLevels[r.Level] {
+		return fmt.Errorf("invalid level %q", r.Level)
+	}
+	if r.Window <= 0 || time.Duration(r.Window) > maxWindow {
+		return fmt.Errorf("window must be between 1s and %v", maxWindow)
+	}
+	if r.For < 0 {
+		return errors.New("for must not be negative")
+	}
+	if r.Interval == 0 {
+		r.Interval = Duration(defaultInterval)
+	}
+	if time.Duration(r.Interval) < minInterval {
+		return fmt.Errorf("interval must be at least %v", minInterval)
+	}
+
+	switch r.Type {
+	case RuleThreshold:
+		if r.Threshold < 0 {
+			return errors.New("threshold must not be negative")
+		}
+	case RuleAbsence:
+		if r.Service == "" {
+			return errors.New("absence rules need a service")
+		}
+	case RuleRateChange:
+		if r.Threshold <= 0 {
+			return errors.New("threshold must be a positive percentage")
+		}
+		if err := r.validateDirection(); err != nil {
+			return err
+		}
+	case RuleAnomaly:
+		if r.Threshold <= 0 {
+			return errors.New("threshold must be a positive score")
+		}
+		if err := r.validateDirection(); err != nil {
+			return err
+		}
+		if err := r.validateBaseline(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid type %q, expected threshold, absence, rate_change or anomaly", r.Type)
+	}
+	if r.Type != RuleRateChange && r.Type != RuleAnomaly && r.Direction != "" {
+		return errors.New("direction only applies to rate_change and anomaly rules")
+	}
+	if r.Type != RuleAnomaly && (r.Baseline != 0 || r.Method != "" || r.Season != 0) {
+		return errors.New("baseline, method and season only apply to anomaly rules")
+	}
+	if r.Streaming {
+		if r.Type != RuleThreshold {
+			return errors.New("streaming rules must be threshold rules")
+		}
+		if time.Duration(r.Window) > maxStreamWindow || r.Window%Duration(time.Second) != 0 {
+			return fmt.Errorf("streaming windows must be whole seconds up to %v", maxStreamWindow)
+		}
+	}
+
+	seen := make(map[string]bool, len(r.Channels))
+	for _, c := range r.Channels {
+		if seen[c] {
+			return fmt.Errorf("channel %q is listed twice", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+func (r *Rule) validateDirection() error {
+	switch r.Direction {
+	case "":
+		r.Direction = DirectionUp
+	case DirectionUp, DirectionDown, DirectionAny:
+	default:
+		return fmt.Errorf("invalid direction %q, expected up, down or any", r.Direction)
+	}
+	return nil
+}
+
+// validateBaseline checks the windows an anomaly rule learns from. Windows
+// dividing a day start at the same times in ClickHouse and Go.
+func (r *Rule) validateBaseline() error {
+	window := time.Duration(r.Window)
+	if window%time.Minute != 0 || (24*time.Hour)%window != 0 {
+		return errors.New("anomaly windows must be whole minutes dividing a day, such as 5m or 1h")
+	}
+	if r.Baseline == 0 {
+		r.Baseline = Duration(defaultBaseline)
+	}
+	if r.Baseline < 0 || time.Duration(r.Baseline) > maxBaseline || r.Baseline%r.Window != 0 || int(r.Baseline/r.Window) > maxBaselineSize {
+		return fmt.Errorf("baseline must be a multiple of window up to %v and %d windows", maxBaseline, maxBaselineSize)
+	}
+	if r.Method == string(anomaly.MethodSeasonal) && r.Season == 0 {
+		r.Season = Duration(defaultSeason)
+	}
+	if r.Season < 0 || r.Season%r.Window != 0 {
+		return errors.New("season must be a multiple of window")
+	}
+
+	c, err := r.anomalyConfig()
+	if err != nil {
+		return err
+	}
+	r.Method = string(c.Method)
+	if int(r.Baseline/r.Window)+1 < c.MinPoints() {
+		return fmt.Errorf("baseline too short, it needs %d windows", c.MinPoints()-1)
+	}
+	return nil
+}
+
+// anomalyConfig is how an anomaly rule scores its windows
+func (r *Rule) anomalyConfig() (anomaly.Config, error) {
+	c := anomaly.Config{Method: anomaly.Method(r.Method)}
+	if r.Season > 0 {
+		c.Season = int(r.Season / r.Window)
+	}
+	err := c.Validate()
+	return c, err
+}
+
+// describe names the entries a rule counts, e.g. "error entries of payment-api"
+func (r *Rule) describe() string {
+	what := "entries"
+	if r.Level != "" {
+		what = r.Level + " entries"
+	}
+	if r.Service != "" {
+		what += " of " + r.Service
+	}
+	return what
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  string
+	}{
+		{"threshold", Rule{Name: "errors", Type: RuleThreshold, Level: "error", Window: Duration(5 * time.Minute), Threshold: 100}, ""},
+		{"absence", Rule{Name: "quiet", Type: RuleAbsence, Service: "billing", Window: Duration(10 * time.Minute)}, ""},
+		{"rate change", Rule{Name: "spike", Type: RuleRateChange, Window: Duration(time.Hour), Threshold: 200, Direction: DirectionAny}, ""},
+		{"no name", Rule{Name: " ", Type: RuleThreshold, Window: Duration(time.Minute)}, "name is required"},
+		{"bad type", Rule{Name: "x", Type: "ratio", Window: Duration(time.Minute)}, "invalid type"},
+		{"bad level", Rule{Name: "x", Type: RuleThreshold, Level: "critical", Window: Duration(time.Minute)}, "invalid level"},
+		{"no window", Rule{Name: "x", Type: RuleThreshold}, "window"},
+		{"fast interval", Rule{Name: "x", Type: RuleThreshold, Window: Duration(time.Minute), Interval: Duration(time.Second)}, "interval"},
+		{"absence without service", Rule{Name: "x", Type: RuleAbsence, Window: Duration(time.Minute)}, "need a service"},
+		{"rate change without threshold", Rule{Name: "x", Type: RuleRateChange, Window: Duration(time.Minute)}, "positive percentage"},
+		{"bad direction", Rule{Name: "x", Type: RuleRateChange, Window: Duration(time.Minute), Threshold: 50, Direction: "sideways"}, "invalid direction"},
+		{"direction on threshold", Rule{Name: "x", Type: RuleThreshold, Window: Duration(time.Minute), Direction: DirectionUp}, "only applies"},
+		{"anomaly", Rule{Name: "unusual", Type: RuleAnomaly, Service: "web", Window: Duration(time.Hour), Threshold: 3}, ""},
+		{"seasonal anomaly", Rule{Name: "unusual", Type: RuleAnomaly, Window: Duration(time.Hour), Threshold: 3, Method: "seasonal"}, ""},
+		{"anomaly without threshold", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(time.Hour)}, "positive score"},
+		{"anomaly window", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(7 * time.Minute), Threshold: 3}, "dividing a day"},
+		{"anomaly baseline", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(time.Hour), Threshold: 3, Baseline: Duration(90 * time.Minute)}, "multiple of window"},
+		{"short baseline", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(time.Hour), Threshold: 3, Baseline: Duration(2 * time.Hour)}, "too short"},
+		{"short seasonal baseline", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(time.Hour), Threshold: 3, Method: "seasonal", Baseline: Duration(48 * time.Hour)}, "too short"},
+		{"anomaly method", Rule{Name: "x", Type: RuleAnomaly, Window: Duration(time.Hour), Threshold: 3, Method: "magic"}, "invalid method"},
+		{"method on threshold", Rule{Name: "x", Type: RuleThreshold, Window: Duration(time.Minute), Method: "ewma"}, "only apply to anomaly"},
+		{"streaming", Rule{Name: "fatal", Type: RuleThreshold, Level: "fatal", Window: Duration(time.Minute), Streaming: true}, ""},
+		{"streaming absence", Rule{Name: "x", Type: RuleAbsence, Service: "a", Window: Duration(time.Minute), Streaming: true}, "must be threshold"},
+		{"streaming window", Rule{Name: "x", Type: RuleThreshold, Window: Duration(2 * time.Hour), Streaming: true}, "whole seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected valid rule, got %v", err)
+				}
+				if tt.rule.Interval != Duration(defaultInterval) {
+					t.Errorf("expected default interval, got %v", time.Duration(tt.rule.Interval))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	var rule Rule
+	if err := json.Unmarshal([]byte(`{"window":"5m","for":"90s"}`), &rule); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if rule.Window != Duration(5*time.Minute) || rule.For != Duration(90*time.Second) {
+		t.Errorf("unexpected durations: %v %v", rule.Window, rule.For)
+	}
+
+	data, _ := json.Marshal(rule)
+	if !strings.Contains(string(data), `"window":"5m0s"`) {
+		t.Errorf("expected window as a duration string, got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"window":300}`), &rule); err == nil {
+		t.Error("expected numeric durations to be rejected")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ErrSilenceNotFound is returned for unknown or deleted silences
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Silence mutes notifications of one rule, or of every rule, between
+// StartsAt and EndsAt. Alerts keep changing state while silenced.
+type Silence struct {
+	ID        string    `json:"id"`
+	RuleID    string    `json:"rule_id,omitempty"` // empty for every rule
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Covers reports whether s mutes ruleID at t
+func (s Silence) Covers(ruleID string, t time.Time) bool {
+	return (s.RuleID == "" || s.RuleID == ruleID) && !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+func listSilencesHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		silences, err := rules.ListSilences(r.Context())
+		if err != nil {
+			log.Printf("DB error (list silences): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if silences == nil {
+			silences = []Silence{}
+		}
+		writeJSON(w, http.StatusOK, silences)
+	}
+}
+
+// createSilenceHandler adds a silence starting now unless starts_at is given
+func createSilenceHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var s Silence
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			http.Error(w, "invalid silence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC()
+		if s.StartsAt.IsZero() {
+			s.StartsAt = now
+		}
+		if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+			http.Error(w, "invalid silence: ends_at must be after starts_at and in the future", http.StatusBadRequest)
+			return
+		}
+		if s.RuleID != "" {
+			_, err := rules.GetRule(r.Context(), s.RuleID)
+			if errors.Is(err, ErrRuleNotFound) {
+				http.Error(w, "invalid silence: unknown rule_id", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				log.Printf("DB error (get rule): %v", err)
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+		}
+		s.ID = uuid.Must(uuid.NewV7()).String()
+		s.CreatedAt = now
+
+		if err := rules.SaveSilence(r.Context(), s); err != nil {
+			log.Printf("DB error (create silence): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, s)
+	}
+}
+
+func deleteSilenceHandler(rules RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := rules.DeleteSilence(r.Context(), chi.URLParam(r, "id"))
+		if errors.Is(err, ErrSilenceNotFound) {
+			http.Error(w, "silence not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("DB error (delete silence): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
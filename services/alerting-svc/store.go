@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrRuleNotFound is returned for unknown or deleted rules
+var ErrRuleNotFound = errors.New("alert rule not found")
+
+// Event records an alert entering a state
+type Event struct {
+	RuleID  string    `json:"rule_id"`
+	State   State     `json:"state"`
+	Value   float64   `json:"value"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message,omitempty"`
+}
+
+// RuleStore keeps alert rules and the history of their state changes
+type RuleStore interface {
+	// ListRules returns every rule, ordered by name
+	ListRules(ctx context.Context) ([]Rule, error)
+
+	// GetRule returns the rule with the given ID or ErrRuleNotFound
+	GetRule(ctx context.Context, id string) (Rule, error)
+
+	// SaveRule creates or replaces a rule
+	SaveRule(ctx context.Context, rule Rule) error
+
+	// DeleteRule removes a rule; its events are kept
+	DeleteRule(ctx context.Context, id string) error
+
+	// RecordEvent appends a state change
+	RecordEvent(ctx context.Context, event Event) error
+
+	// Events returns up to limit state changes of a rule, newest first
+	Events(ctx context.Context, ruleID string, limit int) ([]Event, error)
+
+	// ListSilences returns every silence, ordered by start
+	ListSilences(ctx context.Context) ([]Silence, error)
+
+	// SaveSilence creates a silence
+	SaveSilence(ctx context.Context, s Silence) error
+
+	// DeleteSilence removes a silence or returns ErrSilenceNotFound
+	DeleteSilence(ctx context.Context, id string) error
+}
+
+// ClickHouseRuleStore keeps rules as JSON in alert_rules and silences in
+// alert_silences, ReplacingMergeTrees where the highest version of an ID
+// wins, and events in alert_events. The tables are created by processing-svc
+// migrations.
+type ClickHouseRuleStore struct {
+	db *sql.DB
+}
+
+func NewClickHouseRuleStore(db *sql.DB) *ClickHouseRuleStore {
+	return &ClickHouseRuleStore{db: db}
+}
+
+func (s *ClickHouseRuleStore) ListRules(ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT argMax(rule, version) AS latest_rule, argMax(deleted, version) AS is_deleted
+		FROM alert_rules
+		GROUP BY id
+		HAVING is_deleted = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var data string
+		var deleted uint8
+		if err := rows.Scan(&data, &deleted); err != nil {
+			return nil, err
+		}
+		var rule Rule
+		if err := json.Unmarshal([]byte(data), &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	sortRules(rules)
+	return rules, rows.Err()
+}
+
+func (s *ClickHouseRuleStore) GetRule(ctx context.Context, id string) (Rule, error) {
+	var data string
+	var deleted uint8
+	err := s.db.QueryRowContext(ctx, `
+		SELECT argMax(rule, version), argMax(deleted, version)
+		FROM alert_rules
+		WHERE id = ?
+		GROUP BY id`, id).Scan(&data, &deleted)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && deleted == 1) {
+		return Rule{}, ErrRuleNotFound
+	}
+	if err != nil {
+		return Rule{}, err
+	}
+	var rule Rule
+	err = json.Unmarshal([]byte(data), &rule)
+	return rule, err
+}
+
+func (s *ClickHouseRuleStore) SaveRule(ctx context.Context, rule Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO alert_rules (id, rule, version, deleted) VALUES (?, ?, ?, 0)`,
+		rule.ID, string(data), uint64(time.Now().UnixNano()))
+	return err
+}
+
+func (s *ClickHouseRuleStore) DeleteRule(ctx context.Context, id string) error {
+	if _, err := s.GetRule(ctx, id); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO alert_rules (id, rule, version, deleted) VALUES (?, '', ?, 1)`,
+		id, uint64(time.Now().UnixNano()))
+	return err
+}
+
+func (s *ClickHouseRuleStore) RecordEvent(ctx context.Context, e Event) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO alert_events (rule_id, state, value, at, message) VALUES (?, ?, ?, ?, ?)`,
+		e.RuleID, string(e.State), e.Value, e.At, e.Message)
+	return err
+}
+
+func (s *ClickHouseRuleStore) Events(ctx context.Context, ruleID string, limit int) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT rule_id, state, value, at, message
+		FROM alert_events
+		WHERE rule_id = ?
+		ORDER BY at DESC
+		LIMIT ?`, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var state string
+		if err := rows.Scan(&e.RuleID, &state, &e.Value, &e.At, &e.Message); err != nil {
+			return nil, err
+		}
+		e.State = State(state)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *ClickHouseRuleStore) ListSilences(ctx context.Context) ([]Silence, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT argMax(silence, version) AS latest_silence, argMax(deleted, version) AS is_deleted
+		FROM alert_silences
+		GROUP BY id
+		HAVING is_deleted = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var silences []Silence
+	for rows.Next() {
+		var data string
+		var deleted uint8
+		if err := rows.Scan(&data, &deleted); err != nil {
+			return nil, err
+		}
+		var silence Silence
+		if err := json.Unmarshal([]byte(data), &silence); err != nil {
+			return nil, err
+		}
+		silences = append(silences, silence)
+	}
+	sortSilences(silences)
+	return silences, rows.Err()
+}
+
+func (s *ClickHouseRuleStore) SaveSilence(ctx context.Context, silence Silence) error {
+	data, err := json.Marshal(silence)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO alert_silences (id, silence, ends_at, version, deleted) VALUES (?, ?, ?, ?, 0)`,
+		silence.ID, string(data), silence.EndsAt, uint64(time.Now().UnixNano()))
+	return err
+}
+
+func (s *ClickHouseRuleStore) DeleteSilence(ctx context.Context, id string) error {
+	var endsAt time.Time
+	var deleted uint8
+	err := s.db.QueryRowContext(ctx, `
+		SELECT argMax(ends_at, version), argMax(deleted, version)
+		FROM alert_silences
+		WHERE id = ?
+		GROUP BY id`, id).Scan(&endsAt, &deleted)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && deleted == 1) {
+		return ErrSilenceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// The tombstone keeps ends_at so it expires with the silence
+	_, err = s.db.ExecContext(ctx, `INSERT INTO alert_silences (id, silence, ends_at, version, deleted) VALUES (?, '', ?, ?, 1)`,
+		id, endsAt, uint64(time.Now().UnixNano()))
+	return err
+}
+
+// MemoryRuleStore is a RuleStore for tests and local development
+type MemoryRuleStore struct {
+	mu       sync.Mutex
+	rules    map[string]Rule
+	events   []Event
+	silences map[string]Silence
+}
+
+func NewMemoryRuleStore(rules ...Rule) *MemoryRuleStore {
+	s := &MemoryRuleStore{rules: make(map[string]Rule), silences: make(map[string]Silence)}
+	for _, r := range rules {
+		s.rules[r.ID] = r
+	}
+	return s
+}
+
+func (s *MemoryRuleStore) ListRules(ctx context.Context) ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := make([]Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		rules = append(rules, r)
+	}
+	sortRules(rules)
+	return rules, nil
+}
+
+func (s *MemoryRuleStore) GetRule(ctx context.Context, id string) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	return r, nil
+}
+
+func (s *MemoryRuleStore) SaveRule(ctx context.Context, rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[rule.ID] = rule
+	return nil
+}
+
+func (s *MemoryRuleStore) DeleteRule(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[id]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+func (s *MemoryRuleStore) RecordEvent(ctx context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *MemoryRuleStore) Events(ctx context.Context, ruleID string, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for i := len(s.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if s.events[i].RuleID == ruleID {
+			events = append(events, s.events[i])
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryRuleStore) ListSilences(ctx context.Context) ([]Silence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	silences := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+	sortSilences(silences)
+	return silences, nil
+}
+
+func (s *MemoryRuleStore) SaveSilence(ctx context.Context, silence Silence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silences[silence.ID] = silence
+	return nil
+}
+
+func (s *MemoryRuleStore) DeleteSilence(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	delete(s.silences, id)
+	return nil
+}
+
+func sortSilences(silences []Silence) {
+	sort.Slice(silences, func(i, j int) bool {
+		if !silences[i].StartsAt.Equal(silences[j].StartsAt) {
+			return silences[i].StartsAt.Before(silences[j].StartsAt)
+		}
+		return silences[i].ID < silences[j].ID
+	})
+}
+
+func sortRules(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	streamInterval  = time.Second // evaluation interval of streaming rules
+	maxStreamWindow = time.Hour
+)
+
+// slidingCounter counts events in one-second buckets over a window
+type slidingCounter struct {
+	counts  []uint64
+	seconds []int64 // unix second each bucket holds
+}
+
+func newSlidingCounter(window time.Duration) *slidingCounter {
+	n := int((window + time.Second - 1) / time.Second)
+	return &slidingCounter{counts: make([]uint64, n), seconds: make([]int64, n)}
+}
+
+func (c *slidingCounter) add(at time.Time, n uint64) {
+	sec := at.Unix()
+	i := int(sec % int64(len(c.counts)))
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.counts[i] = 0
+	}
+	c.counts[i] += n
+}
+
+// total returns the events of the window ending with the second of now
+func (c *slidingCounter) total(now time.Time) uint64 {
+	cur := now.Unix()
+	size := int64(len(c.counts))
+	var total uint64
+	for i, sec := range c.seconds {
+		if sec <= cur && cur-sec < size {
+			total += c.counts[i]
+		}
+	}
+	return total
+}
+
+// streamRule counts the feed entries matching a streaming rule as they arrive
+type streamRule struct {
+	level   string
+	service string // lower case
+	counter *slidingCounter
+}
+
+func newStreamRule(rule Rule) *streamRule {
+	return &streamRule{
+		level:   rule.Level,
+		service: strings.ToLower(rule.Service),
+		counter: newSlidingCounter(time.Duration(rule.Window)),
+	}
+}
+
+// matches mirrors the filters of /api/logs: exact level, case-insensitive
+// service substring
+func (r *streamRule) matches(e *models.LogEntry) bool {
+	if r.level != "" && e.Level != r.level {
+		return false
+	}
+	return r.service == "" || strings.Contains(strings.ToLower(e.Service), r.service)
+}
+
+// Observe counts an entry from the feed against every streaming rule it
+// matches. Entries are placed by arrival, not by their timestamp, so late
+// or backdated entries still count.
+func (e *Engine) Observe(entry *models.LogEntry, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.streams {
+		if r.matches(entry) {
+			r.counter.add(at, 1)
+		}
+	}
+}
+
+// localCounts returns this replica's window totals of every streaming rule
+func (e *Engine) localCounts(now time.Time) map[string]uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	counts := make(map[string]uint64, len(e.streams))
+	for id, r := range e.streams {
+		counts[id] = r.counter.total(now)
+	}
+	return counts
+}
+
+// streamCount returns the window total of a streaming rule across replicas
+func (e *Engine) streamCount(rule Rule, now time.Time) uint64 {
+	e.mu.Lock()
+	r, ok := e.streams[rule.ID]
+	var total uint64
+	if ok {
+		total = r.counter.total(now)
+	}
+	e.mu.Unlock()
+	if e.cluster != nil {
+		total += e.cluster.PeerCount(rule.ID, now)
+	}
+	return total
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestSlidingCounter(t *testing.T) {
+	c := newSlidingCounter(10 * time.Second)
+	c.add(now, 2)
+	c.add(now.Add(5*time.Second), 3)
+	c.add(now.Add(5*time.Second+500*time.Millisecond), 1)
+
+	tests := []struct {
+		at       time.Time
+		expected uint64
+	}{
+		{now.Add(-time.Second), 0}, // buckets ahead of now don't count
+		{now, 2},
+		{now.Add(9 * time.Second), 6},
+		{now.Add(10 * time.Second), 4},
+		{now.Add(15 * time.Second), 0},
+	}
+	for _, tt := range tests {
+		if got := c.total(tt.at); got != tt.expected {
+			t.Errorf("total at %v: expected %d, got %d", tt.at.Sub(now), tt.expected, got)
+		}
+	}
+
+	// A reused bucket starts from zero
+	c.add(now.Add(20*time.Second), 1)
+	if got := c.total(now.Add(20 * time.Second)); got != 1 {
+		t.Errorf("expected the stale bucket to be reset, got %d", got)
+	}
+}
+
+func TestStreamRuleMatches(t *testing.T) {
+	r := newStreamRule(Rule{Level: "fatal", Service: "Payment", Window: Duration(time.Minute)})
+	tests := []struct {
+		entry    models.LogEntry
+		expected bool
+	}{
+		{models.LogEntry{Level: "fatal", Service: "payment-api"}, true},
+		{models.LogEntry{Level: "error", Service: "payment-api"}, false},
+		{models.LogEntry{Level: "fatal", Service: "billing"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.matches(&tt.entry); got != tt.expected {
+			t.Errorf("%+v: expected %v, got %v", tt.entry, tt.expected, got)
+		}
+	}
+}
+
+func TestStreamingRuleFires(t *testing.T) {
+	rule := Rule{ID: "r1", Name: "payment fatals", Type: RuleThreshold, Level: "fatal", Service: "payment-api",
+		Window: Duration(time.Minute), Threshold: 1, Streaming: true, Enabled: true}
+	ctx := context.Background()
+	var fired []Transition
+	engine := NewEngine(logstore.NewMemoryStore(), NewMemoryRuleStore(rule), time.Hour,
+		func(_ context.Context, t Transition) { fired = append(fired, t) })
+	cluster := NewCluster(nil, "a", now.Add(-time.Minute))
+	engine.EnableStreaming(cluster, nil)
+	if err := engine.Load(ctx); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// The evaluation delay doesn't apply to what has just arrived
+	engine.Observe(&models.LogEntry{Level: "fatal", Service: "payment-api"}, now)
+	engine.Observe(&models.LogEntry{Level: "error", Service: "payment-api"}, now)
+	engine.Evaluate(ctx, rule, now)
+	if alert, _ := engine.Alert(rule.ID); alert.State != StateInactive {
+		t.Fatalf("expected one fatal to stay inactive, got %s", alert.State)
+	}
+
+	// Another replica saw the second one
+	cluster.Observe(Report{Replica: "b", At: now, Counts: map[string]uint64{rule.ID: 1}})
+	if counts := engine.localCounts(now); counts[rule.ID] != 1 {
+		t.Errorf("expected a local count of 1, got %v", counts)
+	}
+	engine.Evaluate(ctx, rule, now.Add(time.Second))
+	if alert, _ := engine.Alert(rule.ID); alert.State != StateFiring || alert.Value != 2 {
+		t.Fatalf("expected firing at 2, got %+v", alert)
+	}
+	if len(fired) != 1 {
+		t.Errorf("expected one notification, got %d", len(fired))
+	}
+
+	// Updating the rule starts counting afresh
+	engine.Sync(ctx, rule)
+	if counts := engine.localCounts(now); counts[rule.ID] != 0 {
+		t.Errorf("expected counts to reset on update, got %v", counts)
+	}
+}
@@ -4,6 +4,7 @@ go 1.24.5
 
 require (
 	github.com/go-chi/chi/v5 v5.2.2
+	github.com/google/uuid v1.6.0
 	github.com/nats-io/nats.go v1.43.0
 	github.com/yourusername/oglogstream-models v0.0.0-00010101000000-000000000000
 )
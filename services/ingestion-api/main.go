@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,6 +17,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
 	"github.com/yourusername/oglogstream-models"
@@ -22,9 +26,20 @@ import (
 const (
 	maxMessageSize = 10 * 1024     // 10KB max message
 	maxServiceSize = 100           // 100 chars max service name  
+	maxAttributes = 50             // 50 attributes max per entry
+	maxAttributeKeySize = 100      // 100 chars max attribute key
+	maxAttributeValueSize = 1024   // 1KB max attribute value
+	maxBatchEntries = 100          // 100 entries max per batch request
+	maxIdempotencyKeySize = 255    // 255 chars max Idempotency-Key
 	shutdownTimeout = 30 * time.Second
 )
 
+// apiKeyHeader identifies the client an Idempotency-Key belongs to
+const apiKeyHeader = "X-API-Key"
+
+// idempotencyNamespace derives entry IDs from Idempotency-Key headers
+var idempotencyNamespace = uuid.MustParse("6f1c2b0e-3d4a-4c8e-9b7f-5a2e1d0c9b8a")
+
 var validLevels = map[string]bool{
 	"debug": true,
 	"info":  true,
@@ -38,7 +53,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, Idempotency-Key, X-API-Key")
 		
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -87,6 +102,32 @@ func validateLogEntry(entry *models.LogEntry) error {
 		return fmt.Errorf("service name too long (max %d characters)", maxServiceSize)
 	}
 	
+	// Validate trace context
+	entry.TraceID = strings.ToLower(entry.TraceID)
+	entry.SpanID = strings.ToLower(entry.SpanID)
+	if entry.TraceID != "" && !isTraceHex(entry.TraceID, 32) {
+		return fmt.Errorf("trace_id must be 32 hex characters and not all zeros")
+	}
+	if entry.SpanID != "" && !isTraceHex(entry.SpanID, 16) {
+		return fmt.Errorf("span_id must be 16 hex characters and not all zeros")
+	}
+	if entry.SpanID != "" && entry.TraceID == "" {
+		return fmt.Errorf("span_id requires trace_id")
+	}
+	
+	// Validate attributes
+	if len(entry.Attributes) > maxAttributes {
+		return fmt.Errorf("too many attributes (max %d)", maxAttributes)
+	}
+	for key, value := range entry.Attributes {
+		if key == "" || len(key) > maxAttributeKeySize {
+			return fmt.Errorf("attribute key must be 1-%d characters", maxAttributeKeySize)
+		}
+		if len(value) > maxAttributeValueSize {
+			return fmt.Errorf("attribute '%s' too long (max %d characters)", key, maxAttributeValueSize)
+		}
+	}
+	
 	// Set timestamp if not provided or invalid
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now().UTC()
@@ -95,42 +136,212 @@ func validateLogEntry(entry *models.LogEntry) error {
 	return nil
 }
 
-func createLogHandler(nc *nats.Conn) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// isTraceHex reports whether s is a valid W3C trace or span ID of n lowercase
+// hex characters; all zeros is invalid
+func isTraceHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceparent extracts trace and span IDs from a W3C traceparent header
+// (version-traceid-parentid-flags)
+func parseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	// Version 00 has exactly four fields, later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false
+	}
+	if !isTraceHex(parts[1], 32) || !isTraceHex(parts[2], 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// clientIP returns the client address; RealIP middleware has already
+// replaced RemoteAddr with X-Forwarded-For / X-Real-IP when present
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// publisher is the part of nats.JetStreamContext the log handler uses. An
+// entry counts as accepted once the stream acknowledged it.
+type publisher interface {
+	PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error)
+}
+
+// acceptedEntry identifies an accepted entry in the 202 response
+type acceptedEntry struct {
+	Status    string `json:"status,omitempty"`
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+}
+
+// parseAPIKeys reads the comma-separated API_KEYS
+func parseAPIKeys(raw string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// entryID returns a fresh UUIDv7, or with an idempotency key a name-based ID
+// of the client's API key, the idempotency key and the position of the entry,
+// so that a retried request publishes its entries under the IDs of the first
+// attempt and clients picking the same key do not collide. Header values
+// cannot hold NUL, which keeps the two keys apart.
+func entryID(client, key string, i int) (string, error) {
+	if key == "" {
+		id, err := uuid.NewV7()
+		return id.String(), err
+	}
+	return uuid.NewSHA1(idempotencyNamespace, []byte(fmt.Sprintf("%s\x00%s/%d", client, key, i))).String(), nil
+}
+
+// decodeEntries reads either a single entry or a JSON array of entries
+func decodeEntries(body io.Reader) ([]models.LogEntry, bool, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false, err
+	}
+	
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() // Strict JSON parsing
+	
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
 		var entry models.LogEntry
-		
-		decoder := json.NewDecoder(r.Body)
-		decoder.DisallowUnknownFields() // Strict JSON parsing
-		
 		if err := decoder.Decode(&entry); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return nil, false, err
+		}
+		return []models.LogEntry{entry}, false, nil
+	}
+	
+	var entries []models.LogEntry
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, true, err
+	}
+	if len(entries) == 0 || len(entries) > maxBatchEntries {
+		return nil, true, fmt.Errorf("batch must hold 1-%d entries", maxBatchEntries)
+	}
+	return entries, true, nil
+}
+
+// createLogHandler publishes the entries of a request. An Idempotency-Key is
+// only taken together with one of apiKeys, which scopes it to the client.
+func createLogHandler(js publisher, hostname string, apiKeys map[string]bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if len(key) > maxIdempotencyKeySize {
+			http.Error(w, fmt.Sprintf("Idempotency-Key exceeds %d characters", maxIdempotencyKeySize), http.StatusBadRequest)
 			return
 		}
-		
-		// Validate the log entry
-		if err := validateLogEntry(&entry); err != nil {
-			http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		client := r.Header.Get(apiKeyHeader)
+		if key != "" && client == "" {
+			http.Error(w, "Idempotency-Key requires an X-API-Key", http.StatusBadRequest)
+			return
+		}
+		if key != "" && !apiKeys[client] {
+			http.Error(w, "Unknown API key", http.StatusUnauthorized)
 			return
 		}
 		
-		// Marshal to JSON
-		data, err := json.Marshal(entry)
+		entries, batch, err := decodeEntries(r.Body)
 		if err != nil {
-			log.Printf("Marshal error: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
 			return
 		}
 		
-		// Publish to NATS
-		if err := nc.Publish("logs.raw", data); err != nil {
-			log.Printf("NATS publish error: %v", err)
-			http.Error(w, "Message delivery failed", http.StatusServiceUnavailable)
-			return
+		// Entries without trace context inherit the request's traceparent
+		if traceID, spanID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			for i := range entries {
+				if entries[i].TraceID == "" && entries[i].SpanID == "" {
+					entries[i].TraceID, entries[i].SpanID = traceID, spanID
+				}
+			}
+		}
+		
+		// Validate every entry before publishing any of them
+		for i := range entries {
+			if err := validateLogEntry(&entries[i]); err != nil {
+				if batch {
+					err = fmt.Errorf("entry %d: %v", i, err)
+				}
+				http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		
+		receivedAt := time.Now().UTC().Format(time.RFC3339Nano)
+		accepted := make([]acceptedEntry, 0, len(entries))
+		for i := range entries {
+			entry := &entries[i]
+			
+			// IDs are always assigned here, whatever clients sent
+			entry.ID, err = entryID(client, key, i)
+			if err != nil {
+				log.Printf("ID generation error: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			
+			// Marshal to JSON
+			data, err := json.Marshal(entry)
+			if err != nil {
+				log.Printf("Marshal error: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			
+			// Publish to NATS with ingestion metadata for enrichment. The ID
+			// doubles as JetStream message ID, which drops the republished
+			// entries of a request retried with the same Idempotency-Key.
+			msg := nats.NewMsg("logs.raw")
+			msg.Data = data
+			msg.Header.Set(nats.MsgIdHdr, entry.ID)
+			msg.Header.Set(models.HeaderIngestHost, hostname)
+			msg.Header.Set(models.HeaderClientIP, clientIP(r))
+			msg.Header.Set(models.HeaderReceivedAt, receivedAt)
+			if _, err := js.PublishMsg(msg); err != nil {
+				log.Printf("JetStream publish error: %v", err)
+				if !batch || len(accepted) == 0 {
+					http.Error(w, "Message delivery failed", http.StatusServiceUnavailable)
+					return
+				}
+				// The entries before this one are stored in the stream and listed
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "partial", "error": "Message delivery failed", "items": accepted})
+				return
+			}
+			
+			accepted = append(accepted, acceptedEntry{ID: entry.ID, Timestamp: entry.Timestamp.Format(time.RFC3339)})
 		}
 		
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
-		w.Write([]byte(`{"status":"accepted","timestamp":"` + entry.Timestamp.Format(time.RFC3339) + `"}`))
+		if batch {
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "accepted", "items": accepted})
+			return
+		}
+		accepted[0].Status = "accepted"
+		json.NewEncoder(w).Encode(accepted[0])
 	}
 }
 
@@ -157,6 +368,14 @@ func main() {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
 	defer nc.Drain()
+	
+	// Publishing waits for the stream's acknowledgement, so an entry the stream
+	// did not take is reported instead of lost. The stream is set up by
+	// processing-svc; until then publishes fail.
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatalf("Failed to get JetStream context: %v", err)
+	}
 
 	// Setup router
 	r := chi.NewRouter()
@@ -184,8 +403,11 @@ func main() {
 		w.Write([]byte(response))
 	})
 
+	// Get hostname for ingestion metadata
+	hostname, _ := os.Hostname()
+
 	// Log ingestion endpoint
-	r.Post("/log", createLogHandler(nc))
+	r.Post("/log", createLogHandler(js, hostname, parseAPIKeys(os.Getenv("API_KEYS"))))
 
 	// Setup HTTP server
 	addr := ":8080"
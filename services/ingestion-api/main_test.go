@@ -3,13 +3,17 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/yourusername/logstream-models"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/yourusername/oglogstream-models"
 )
 
 func TestLogEntryUnmarshal(t *testing.T) {
@@ -53,4 +57,272 @@ func TestPostLogEndpoint(t *testing.T) {
 	if len(published) == 0 {
 		t.Error("log not published")
 	}
-} 
\ No newline at end of file
+}
+
+func TestValidateLogEntryAttributes(t *testing.T) {
+	entry := models.LogEntry{Level: "INFO", Message: "m", Service: "s", Attributes: map[string]string{"env": "prod"}}
+	if err := validateLogEntry(&entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Level != "info" {
+		t.Errorf("expected level to be normalized, got %s", entry.Level)
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxAttributes; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	invalid := []map[string]string{
+		tooMany,
+		{"": "empty key"},
+		{"big": strings.Repeat("x", maxAttributeValueSize+1)},
+	}
+	for _, attrs := range invalid {
+		entry := models.LogEntry{Level: "info", Message: "m", Service: "s", Attributes: attrs}
+		if err := validateLogEntry(&entry); err == nil {
+			t.Errorf("expected error for %d attributes", len(attrs))
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1:5555": "10.0.0.1",
+		"[::1]:8080":    "::1",
+		"203.0.113.7":   "203.0.113.7",
+	}
+	for remoteAddr, expected := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/log", nil)
+		req.RemoteAddr = remoteAddr
+		if got := clientIP(req); got != expected {
+			t.Errorf("clientIP(%q) = %q, expected %q", remoteAddr, got, expected)
+		}
+	}
+}
+
+// fakePublisher records published messages instead of sending them to NATS,
+// failing once failAt messages went out when failAt is set
+type fakePublisher struct {
+	msgs   []*nats.Msg
+	failAt int
+}
+
+func (p *fakePublisher) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if p.failAt > 0 && len(p.msgs) == p.failAt {
+		return nil, nats.ErrNoResponders
+	}
+	p.msgs = append(p.msgs, msg)
+	return &nats.PubAck{Stream: "LOGS", Sequence: uint64(len(p.msgs))}, nil
+}
+
+func TestCreateLogHandlerAssignsIDs(t *testing.T) {
+	pub := &fakePublisher{}
+	handler := createLogHandler(pub, "ingest-1", nil)
+
+	// Single entry: client supplied IDs are replaced
+	body := `{"id":"mine","level":"info","message":"Hello","service":"svc"}`
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var single acceptedEntry
+	if err := json.NewDecoder(w.Body).Decode(&single); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	id, err := uuid.Parse(single.ID)
+	if err != nil || id.Version() != 7 || single.Status != "accepted" {
+		t.Fatalf("expected a UUIDv7 in the response, got %+v", single)
+	}
+
+	var published models.LogEntry
+	json.Unmarshal(pub.msgs[0].Data, &published)
+	if published.ID != single.ID || pub.msgs[0].Header.Get(nats.MsgIdHdr) != single.ID {
+		t.Errorf("expected the ID in the payload and message ID header, got %q %q", published.ID, pub.msgs[0].Header.Get(nats.MsgIdHdr))
+	}
+
+	// Batch: one ID per item, in request order, sortable by generation
+	body = `[{"level":"info","message":"a","service":"svc"},{"level":"warn","message":"b","service":"svc"}]`
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var batch struct {
+		Items []acceptedEntry `json:"items"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&batch); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(batch.Items) != 2 || len(pub.msgs) != 3 || batch.Items[0].ID >= batch.Items[1].ID {
+		t.Errorf("expected two ordered IDs, got %+v", batch.Items)
+	}
+}
+
+func TestCreateLogHandlerIdempotencyKey(t *testing.T) {
+	pub := &fakePublisher{}
+	handler := createLogHandler(pub, "ingest-1", parseAPIKeys("team-a, team-b"))
+	body := `[{"level":"info","message":"a","service":"svc"},{"level":"warn","message":"b","service":"svc"}]`
+
+	post := func(client, key string) []acceptedEntry {
+		r := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		r.Header.Set(apiKeyHeader, client)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Items []acceptedEntry `json:"items"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Items
+	}
+
+	first, retry, other := post("team-a", "req-1"), post("team-a", "req-1"), post("team-a", "req-2")
+	if first[0].ID != retry[0].ID || first[1].ID != retry[1].ID {
+		t.Errorf("expected a retry to reuse the IDs, got %+v and %+v", first, retry)
+	}
+	if first[0].ID == first[1].ID || first[0].ID == other[0].ID {
+		t.Errorf("expected IDs to differ per entry and key, got %+v and %+v", first, other)
+	}
+	// Another client using the same key gets IDs of its own
+	if shared := post("team-b", "req-1"); shared[0].ID == first[0].ID || shared[1].ID == first[1].ID {
+		t.Errorf("expected IDs to differ per client, got %+v and %+v", first, shared)
+	}
+	if pub.msgs[0].Header.Get(nats.MsgIdHdr) != first[0].ID || pub.msgs[2].Header.Get(nats.MsgIdHdr) != first[0].ID {
+		t.Error("expected the retried entry to be published under the same message ID")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		client string
+		key    string
+		want   int
+	}{
+		{"oversized key", "team-a", strings.Repeat("k", maxIdempotencyKeySize+1), http.StatusBadRequest},
+		{"no API key", "", "req-1", http.StatusBadRequest},
+		{"unknown API key", "team-c", "req-1", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", tt.key)
+		r.Header.Set(apiKeyHeader, tt.client)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+	if len(pub.msgs) != 8 {
+		t.Errorf("expected rejected requests to publish nothing, got %d messages", len(pub.msgs))
+	}
+}
+
+func TestCreateLogHandlerPartialBatch(t *testing.T) {
+	pub := &fakePublisher{failAt: 1}
+	body := `[{"level":"info","message":"a","service":"svc"},{"level":"warn","message":"b","service":"svc"}]`
+	w := httptest.NewRecorder()
+	createLogHandler(pub, "ingest-1", nil)(w, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	var resp struct {
+		Status string          `json:"status"`
+		Items  []acceptedEntry `json:"items"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Status != "partial" || len(resp.Items) != 1 || len(pub.msgs) != 1 {
+		t.Errorf("expected the first entry reported as accepted, got %+v", resp)
+	}
+}
+
+func TestCreateLogHandlerRejectsInvalidBatch(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid item", `[{"level":"info","message":"a","service":"svc"},{"level":"loud","message":"b","service":"svc"}]`},
+		{"empty batch", `[]`},
+		{"too many", "[" + strings.Repeat(`{"level":"info","message":"a","service":"svc"},`, maxBatchEntries) + `{"level":"info","message":"a","service":"svc"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &fakePublisher{}
+			w := httptest.NewRecorder()
+			createLogHandler(pub, "ingest-1", nil)(w, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", w.Code)
+			}
+			if len(pub.msgs) != 0 {
+				t.Errorf("nothing may be published from a rejected batch, got %d", len(pub.msgs))
+			}
+		})
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header  string
+		traceID string
+		ok      bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		traceID, spanID, ok := parseTraceparent(tt.header)
+		if ok != tt.ok || traceID != tt.traceID {
+			t.Errorf("%q: expected %q %v, got %q %v", tt.header, tt.traceID, tt.ok, traceID, ok)
+		}
+		if ok && spanID != "00f067aa0ba902b7" {
+			t.Errorf("%q: unexpected span ID %q", tt.header, spanID)
+		}
+	}
+}
+
+func TestCreateLogHandlerTraceContext(t *testing.T) {
+	pub := &fakePublisher{}
+	handler := createLogHandler(pub, "ingest-1", nil)
+
+	body := `[{"level":"info","message":"a","service":"svc"},
+		{"level":"info","message":"b","service":"svc","trace_id":"0AF7651916CD43DD8448EB211C80319C","span_id":"b7ad6b7169203331"}]`
+	req := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var fromHeader, explicit models.LogEntry
+	json.Unmarshal(pub.msgs[0].Data, &fromHeader)
+	json.Unmarshal(pub.msgs[1].Data, &explicit)
+	if fromHeader.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || fromHeader.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected trace context from traceparent, got %q %q", fromHeader.TraceID, fromHeader.SpanID)
+	}
+	if explicit.TraceID != "0af7651916cd43dd8448eb211c80319c" || explicit.SpanID != "b7ad6b7169203331" {
+		t.Errorf("expected body fields to win and be normalised, got %q %q", explicit.TraceID, explicit.SpanID)
+	}
+
+	// Invalid IDs in the body are rejected
+	for _, body := range []string{
+		`{"level":"info","message":"a","service":"svc","trace_id":"xyz"}`,
+		`{"level":"info","message":"a","service":"svc","span_id":"b7ad6b7169203331"}`,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
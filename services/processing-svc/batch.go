@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// BatchConfig controls when the batch processor flushes and how many inserts
+// it runs at once. A batch is written as soon as it holds the current target
+// size or MaxBytes of estimated payload, whichever comes first, and at least
+// every FlushTimeout. The target starts at Size and moves between MinSize and
+// MaxSize to keep insert latency around TargetLatency.
+type BatchConfig struct {
+	Size         int
+	MinSize      int
+	MaxSize      int
+	MaxBytes     int
+	FlushTimeout time.Duration
+	MaxRetries   int
+
+	Workers          int           // concurrent inserts
+	MaxInFlightBytes int           // flushed but not yet inserted payload before AddEntry blocks
+	TargetLatency    time.Duration // insert latency the adaptive size aims for
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Size:             batchSize,
+		MinSize:          batchMinSize,
+		MaxSize:          batchMaxSize,
+		MaxBytes:         batchMaxBytes,
+		FlushTimeout:     flushTimeout,
+		MaxRetries:       maxRetries,
+		Workers:          insertWorkers,
+		MaxInFlightBytes: maxInFlightBytes,
+		TargetLatency:    targetLatency,
+	}
+}
+
+// LoadBatchConfig reads the BATCH_*, FLUSH_TIMEOUT, MAX_RETRIES, INSERT_WORKERS,
+// MAX_INFLIGHT_BYTES and INSERT_TARGET_LATENCY variables, keeping defaults for
+// unset ones
+func LoadBatchConfig(getenv func(string) string) (BatchConfig, error) {
+	cfg := DefaultBatchConfig()
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"BATCH_SIZE", &cfg.Size},
+		{"BATCH_MIN_SIZE", &cfg.MinSize},
+		{"BATCH_MAX_SIZE", &cfg.MaxSize},
+		{"BATCH_MAX_BYTES", &cfg.MaxBytes},
+		{"MAX_RETRIES", &cfg.MaxRetries},
+		{"INSERT_WORKERS", &cfg.Workers},
+		{"MAX_INFLIGHT_BYTES", &cfg.MaxInFlightBytes},
+	}
+	for _, v := range ints {
+		raw := getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+		}
+		*v.dest = n
+	}
+
+	durations := []struct {
+		name string
+		dest *time.Duration
+	}{
+		{"FLUSH_TIMEOUT", &cfg.FlushTimeout},
+		{"INSERT_TARGET_LATENCY", &cfg.TargetLatency},
+	}
+	for _, v := range durations {
+		raw := getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+		}
+		*v.dest = d
+	}
+
+	// Default bounds widen to include BATCH_SIZE, explicit ones must contain it
+	if getenv("BATCH_MIN_SIZE") == "" {
+		cfg.MinSize = min(cfg.MinSize, cfg.Size)
+	}
+	if getenv("BATCH_MAX_SIZE") == "" {
+		cfg.MaxSize = max(cfg.MaxSize, cfg.Size)
+	}
+	if cfg.Size < cfg.MinSize || cfg.Size > cfg.MaxSize {
+		return cfg, fmt.Errorf("BATCH_SIZE %d must be between BATCH_MIN_SIZE %d and BATCH_MAX_SIZE %d",
+			cfg.Size, cfg.MinSize, cfg.MaxSize)
+	}
+	return cfg, nil
+}
+
+// entrySize estimates the bytes an entry adds to an insert: string payloads
+// plus fixed-width columns. It only has to be proportional, not exact.
+func entrySize(e *models.LogEntry) int {
+	const fixed = 4 + 1 + 4 + 4 + 4 // timestamp, level, repeat_count, first_seen, last_seen
+	size := fixed + len(e.Message) + len(e.Service)
+	for k, v := range e.Attributes {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// inflightBudget bounds the payload handed to inserters but not yet written.
+// acquire blocks until enough has been released, which stalls AddEntry and in
+// turn the NATS handler instead of queueing batches without limit.
+type inflightBudget struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	max   int
+	used  int
+}
+
+func newInflightBudget(max int) *inflightBudget {
+	b := &inflightBudget{max: max}
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+}
+
+func (b *inflightBudget) acquire(n int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// A batch larger than the whole budget still goes through on its own
+	for b.used > 0 && b.used+n > b.max {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+func (b *inflightBudget) release(n int) {
+	b.mutex.Lock()
+	b.used -= n
+	b.mutex.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *inflightBudget) inUse() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.used
+}
+
+// batchSizer adapts the flush size to insert latency: it grows by a tenth
+// while inserts finish in under half the target and halves when they take
+// longer than the target or fail.
+type batchSizer struct {
+	mutex    sync.Mutex
+	min, max int
+	target   time.Duration
+	size     int
+}
+
+func newBatchSizer(cfg BatchConfig) *batchSizer {
+	return &batchSizer{min: cfg.MinSize, max: cfg.MaxSize, target: cfg.TargetLatency, size: cfg.Size}
+}
+
+func (s *batchSizer) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size
+}
+
+func (s *batchSizer) Observe(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case latency > s.target:
+		s.size = max(s.size/2, s.min)
+	case latency < s.target/2:
+		s.size = min(s.size+max(s.size/10, 1), s.max)
+	}
+}
+
+// Failed reacts to a failed insert like a slow one
+func (s *batchSizer) Failed() {
+	s.Observe(s.target + 1)
+}
+
+// BatchStats describes the batch processor for /batch/stats
+type BatchStats struct {
+	TargetSize    int    `json:"target_size"`
+	InFlightBytes int    `json:"inflight_bytes"`
+	QueuedBatches int    `json:"queued_batches"`
+	Inserted      uint64 `json:"inserted"`
+	Failed        uint64 `json:"failed"`
+	Skipped       uint64 `json:"skipped"`
+	BlockedTime   string `json:"blocked_time"`
+}
+
+// parseInsertMode validates INSERT_MODE, defaulting to the native columnar path
+func parseInsertMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return "native", nil
+	case "native", "sql":
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid INSERT_MODE %q, expected native or sql", mode)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestLoadBatchConfig(t *testing.T) {
+	env := map[string]string{
+		"BATCH_SIZE":      "500",
+		"BATCH_MAX_BYTES": "65536",
+		"FLUSH_TIMEOUT":   "500ms",
+	}
+	cfg, err := LoadBatchConfig(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("LoadBatchConfig failed: %v", err)
+	}
+	expected := DefaultBatchConfig()
+	expected.Size, expected.MaxBytes, expected.FlushTimeout = 500, 65536, 500*time.Millisecond
+	if cfg != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+
+	// Default bounds follow BATCH_SIZE outside of them
+	cfg, err = LoadBatchConfig(func(k string) string { return map[string]string{"BATCH_SIZE": "5"}[k] })
+	if err != nil || cfg.MinSize != 5 {
+		t.Errorf("expected min size to follow BATCH_SIZE, got %+v %v", cfg, err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"BATCH_SIZE": "0"},
+		{"BATCH_MAX_BYTES": "1MB"},
+		{"MAX_RETRIES": "-1"},
+		{"FLUSH_TIMEOUT": "2"},
+		{"INSERT_TARGET_LATENCY": "0s"},
+		{"BATCH_SIZE": "500", "BATCH_MAX_SIZE": "200"},
+	} {
+		if _, err := LoadBatchConfig(func(k string) string { return bad[k] }); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestParseInsertMode(t *testing.T) {
+	if mode, err := parseInsertMode(""); err != nil || mode != "native" {
+		t.Errorf("expected native default, got %q %v", mode, err)
+	}
+	if mode, err := parseInsertMode("sql"); err != nil || mode != "sql" {
+		t.Errorf("expected sql, got %q %v", mode, err)
+	}
+	if _, err := parseInsertMode("bulk"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestBatchProcessorFlushesOnBytes(t *testing.T) {
+	store := logstore.NewMemoryStore()
+	cfg := DefaultBatchConfig()
+	cfg.MaxBytes = 4096
+	cfg.FlushTimeout = time.Hour
+	bp := NewBatchProcessor(store, "test", cfg)
+	defer bp.Stop()
+
+	// Two 3KB entries cross the byte limit long before the entry limit
+	big := strings.Repeat("x", 3000)
+	bp.AddEntry(models.LogEntry{Timestamp: time.Now(), Level: "info", Message: big, Service: "svc"})
+	bp.AddEntry(models.LogEntry{Timestamp: time.Now(), Level: "info", Message: big, Service: "svc"})
+
+	deadline := time.Now().Add(time.Second)
+	for len(store.Entries()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a byte-triggered flush, got %d entries", len(store.Entries()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBatchSizer(t *testing.T) {
+	cfg := DefaultBatchConfig()
+	cfg.Size, cfg.MinSize, cfg.MaxSize, cfg.TargetLatency = 100, 20, 115, time.Second
+	s := newBatchSizer(cfg)
+
+	s.Observe(100 * time.Millisecond)
+	if s.Size() != 110 {
+		t.Errorf("expected fast inserts to grow the batch by 10%%, got %d", s.Size())
+	}
+	s.Observe(100 * time.Millisecond)
+	if s.Size() != 115 {
+		t.Errorf("expected growth capped at max size, got %d", s.Size())
+	}
+	s.Observe(700 * time.Millisecond)
+	if s.Size() != 115 {
+		t.Errorf("expected no change near the target, got %d", s.Size())
+	}
+	s.Observe(2 * time.Second)
+	s.Failed()
+	s.Failed()
+	if s.Size() != 20 {
+		t.Errorf("expected slow and failed inserts to halve down to min size, got %d", s.Size())
+	}
+}
+
+func TestInflightBudget(t *testing.T) {
+	b := newInflightBudget(100)
+	b.acquire(60)
+
+	acquired := make(chan bool)
+	go func() {
+		b.acquire(60)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire must block while the budget is exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(60)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire must resume after release")
+	}
+
+	// Oversized requests pass once nothing else is in flight
+	b.release(60)
+	b.acquire(500)
+	if b.inUse() != 500 {
+		t.Errorf("expected 500 bytes in use, got %d", b.inUse())
+	}
+}
+
+// blockingWriter holds every insert until release is closed
+type blockingWriter struct {
+	started chan int
+	release chan struct{}
+}
+
+func (w *blockingWriter) WriteBatch(ctx context.Context, entries []models.LogEntry) error {
+	w.started <- len(entries)
+	<-w.release
+	return nil
+}
+
+func TestBatchProcessorBackpressure(t *testing.T) {
+	writer := &blockingWriter{started: make(chan int, 10), release: make(chan struct{})}
+	cfg := DefaultBatchConfig()
+	cfg.Size, cfg.MinSize, cfg.Workers, cfg.MaxInFlightBytes = 1, 1, 1, 1
+	cfg.FlushTimeout = time.Hour
+	bp := NewBatchProcessor(writer, "test", cfg)
+
+	entry := models.LogEntry{Timestamp: time.Now(), Level: "info", Message: "m", Service: "svc"}
+	bp.AddEntry(entry) // taken by the only worker, holds the whole budget
+	<-writer.started
+
+	added := make(chan bool)
+	go func() {
+		bp.AddEntry(entry)
+		close(added)
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("AddEntry must block while the in-flight budget is used up")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if stats := bp.Stats(); stats.InFlightBytes == 0 || stats.Inserted != 0 {
+		t.Errorf("unexpected stats while blocked: %+v", stats)
+	}
+
+	close(writer.release)
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("AddEntry must resume once the insert completes")
+	}
+
+	bp.Stop()
+	if stats := bp.Stats(); stats.Inserted != 2 || stats.InFlightBytes != 0 {
+		t.Errorf("expected both entries inserted after stop, got %+v", stats)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const maxDedupGroups = 10000
+
+// maxCollapsedIDs bounds the IDs a burst row keeps for the entries it stands
+// for. IDs beyond it are counted in RepeatCount but resolve to nothing.
+const maxCollapsedIDs = 1000
+
+type dedupKey struct {
+	service string
+	level   string
+	message string
+	traceID string
+}
+
+type dedupGroup struct {
+	entry      models.LogEntry
+	deliveries []Delivery
+	opened     time.Time
+}
+
+// DedupCounts holds received vs emitted totals of the collapsing stage
+type DedupCounts struct {
+	Received  uint64 `json:"received"`
+	Emitted   uint64 `json:"emitted"`
+	Collapsed uint64 `json:"collapsed"`
+}
+
+// Deduper collapses identical (service, level, message, trace) entries arriving
+// within window into a single entry carrying a repeat count and first/last
+// seen timestamps. Collapsed entries are passed to emit together with the
+// deliveries of every entry they stand for.
+type Deduper struct {
+	window time.Duration
+	emit   func(models.LogEntry, ...Delivery)
+
+	mutex  sync.Mutex
+	groups map[dedupKey]*dedupGroup
+	counts DedupCounts
+	done   chan bool
+}
+
+func NewDeduper(window time.Duration, emit func(models.LogEntry, ...Delivery)) *Deduper {
+	d := &Deduper{
+		window: window,
+		emit:   emit,
+		groups: make(map[dedupKey]*dedupGroup),
+		done:   make(chan bool),
+	}
+
+	// Start flush timer
+	go d.flushTimer()
+
+	return d
+}
+
+// resetRepeat makes the entry stand for itself only. Processing is the
+// authority on repeat counts, whatever clients sent.
+func resetRepeat(entry *models.LogEntry) {
+	entry.RepeatCount = 1
+	entry.FirstSeen = entry.Timestamp
+	entry.LastSeen = entry.Timestamp
+	entry.CollapsedIDs = nil
+}
+
+func (d *Deduper) Add(entry models.LogEntry, deliveries ...Delivery) {
+	resetRepeat(&entry)
+	key := dedupKey{service: entry.Service, level: entry.Level, message: entry.Message, traceID: entry.TraceID}
+
+	d.mutex.Lock()
+	d.counts.Received++
+
+	if g, ok := d.groups[key]; ok {
+		g.entry.RepeatCount++
+		if entry.ID != "" && len(g.entry.CollapsedIDs) < maxCollapsedIDs {
+			g.entry.CollapsedIDs = append(g.entry.CollapsedIDs, entry.ID)
+		}
+		g.deliveries = append(g.deliveries, deliveries...)
+		if entry.Timestamp.Before(g.entry.FirstSeen) {
+			g.entry.FirstSeen = entry.Timestamp
+			g.entry.Timestamp = entry.Timestamp
+		}
+		if entry.Timestamp.After(g.entry.LastSeen) {
+			g.entry.LastSeen = entry.Timestamp
+		}
+		d.counts.Collapsed++
+		d.mutex.Unlock()
+		return
+	}
+
+	// Too many distinct messages in flight, pass through uncollapsed
+	if len(d.groups) >= maxDedupGroups {
+		d.counts.Emitted++
+		d.mutex.Unlock()
+		d.emit(entry, deliveries...)
+		return
+	}
+
+	d.groups[key] = &dedupGroup{entry: entry, deliveries: deliveries, opened: time.Now()}
+	d.mutex.Unlock()
+}
+
+func (d *Deduper) flushTimer() {
+	ticker := time.NewTicker(d.window / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flush(time.Now().Add(-d.window))
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// flush emits every group opened before cutoff
+func (d *Deduper) flush(cutoff time.Time) {
+	d.mutex.Lock()
+	var ready []*dedupGroup
+	for key, g := range d.groups {
+		if g.opened.Before(cutoff) {
+			ready = append(ready, g)
+			delete(d.groups, key)
+		}
+	}
+	d.counts.Emitted += uint64(len(ready))
+	d.mutex.Unlock()
+
+	for _, g := range ready {
+		d.emit(g.entry, g.deliveries...)
+	}
+}
+
+// Counts returns a snapshot of the stage counters
+func (d *Deduper) Counts() DedupCounts {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.counts
+}
+
+// Stop emits all open groups
+func (d *Deduper) Stop() {
+	close(d.done)
+	d.flush(time.Now().Add(time.Hour))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestDeduperCollapsesBursts(t *testing.T) {
+	var mu sync.Mutex
+	var emitted []models.LogEntry
+	seqs := map[string][]uint64{}
+	d := NewDeduper(time.Hour, func(e models.LogEntry, deliveries ...Delivery) {
+		mu.Lock()
+		emitted = append(emitted, e)
+		for _, d := range deliveries {
+			seqs[e.Level] = append(seqs[e.Level], d.Seq)
+		}
+		mu.Unlock()
+	})
+
+	base := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		d.Add(models.LogEntry{Timestamp: base.Add(time.Duration(i) * time.Second), Level: "fatal", Message: "panic: nil map", Service: "worker"},
+			Delivery{Seq: uint64(i + 1)})
+	}
+	// Client supplied counts are ignored
+	d.Add(models.LogEntry{Timestamp: base, Level: "info", Message: "started", Service: "worker", RepeatCount: 99},
+		Delivery{Seq: 6})
+	d.Stop()
+
+	if len(emitted) != 2 {
+		t.Fatalf("expected 2 collapsed entries, got %d", len(emitted))
+	}
+
+	for _, e := range emitted {
+		switch e.Level {
+		case "fatal":
+			if e.RepeatCount != 5 {
+				t.Errorf("expected repeat count 5, got %d", e.RepeatCount)
+			}
+			if !e.FirstSeen.Equal(base) || !e.LastSeen.Equal(base.Add(4*time.Second)) || !e.Timestamp.Equal(base) {
+				t.Errorf("unexpected burst timestamps: %+v", e)
+			}
+		case "info":
+			if e.RepeatCount != 1 || !e.FirstSeen.Equal(base) || !e.LastSeen.Equal(base) {
+				t.Errorf("unexpected single entry: %+v", e)
+			}
+		}
+	}
+
+	// Every collapsed message is acknowledged with the emitted entry
+	if len(seqs["fatal"]) != 5 || len(seqs["info"]) != 1 {
+		t.Errorf("expected deliveries of all collapsed messages, got %v", seqs)
+	}
+
+	counts := d.Counts()
+	if counts.Received != 6 || counts.Emitted != 2 || counts.Collapsed != 4 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+}
+
+func TestDeduperFlushesAfterWindow(t *testing.T) {
+	done := make(chan models.LogEntry, 1)
+	d := NewDeduper(50*time.Millisecond, func(e models.LogEntry, _ ...Delivery) { done <- e })
+	defer d.Stop()
+
+	d.Add(models.LogEntry{Timestamp: time.Now(), Level: "error", Message: "timeout", Service: "api"})
+
+	select {
+	case e := <-done:
+		if e.RepeatCount != 1 {
+			t.Errorf("expected repeat count 1, got %d", e.RepeatCount)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("entry was not flushed after the window")
+	}
+}
+
+func TestDeduperKeepsTracesApart(t *testing.T) {
+	var mu sync.Mutex
+	var emitted []models.LogEntry
+	d := NewDeduper(time.Hour, func(e models.LogEntry, _ ...Delivery) {
+		mu.Lock()
+		emitted = append(emitted, e)
+		mu.Unlock()
+	})
+
+	for _, trace := range []string{"4bf92f3577b34da6a3ce929d0e0e4736", "0af7651916cd43dd8448eb211c80319c", ""} {
+		d.Add(models.LogEntry{Timestamp: time.Now(), Level: "error", Message: "timeout", Service: "api", TraceID: trace})
+	}
+	d.Stop()
+
+	// Collapsing across traces would drop all but one trace ID
+	if len(emitted) != 3 {
+		t.Errorf("expected one entry per trace, got %d", len(emitted))
+	}
+}
+
+func TestDeduperKeepsCollapsedIDs(t *testing.T) {
+	var emitted []models.LogEntry
+	d := NewDeduper(time.Hour, func(e models.LogEntry, _ ...Delivery) {
+		emitted = append(emitted, e)
+	})
+
+	base := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	for i := 0; i < maxCollapsedIDs+3; i++ {
+		d.Add(models.LogEntry{ID: fmt.Sprintf("id-%d", i), Timestamp: base, Level: "error", Message: "timeout", Service: "api"})
+	}
+	// Client supplied IDs are ignored
+	d.Add(models.LogEntry{ID: "single", Timestamp: base, Level: "info", Message: "started", Service: "api", CollapsedIDs: []string{"forged"}})
+	d.Stop()
+
+	for _, e := range emitted {
+		switch e.Level {
+		case "error":
+			if e.ID != "id-0" || len(e.CollapsedIDs) != maxCollapsedIDs || e.CollapsedIDs[0] != "id-1" {
+				t.Errorf("unexpected collapsed IDs of %s: %d, first %v", e.ID, len(e.CollapsedIDs), e.CollapsedIDs[:1])
+			}
+		case "info":
+			if len(e.CollapsedIDs) != 0 {
+				t.Errorf("expected no collapsed IDs, got %v", e.CollapsedIDs)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/oschwald/geoip2-golang"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// Attribute keys written by the enrichment stage
+const (
+	AttrIngestHost     = "ingest_host"
+	AttrClientIP       = "client_ip"
+	AttrReceivedAt     = "received_at"
+	AttrProcessingHost = "processing_host"
+	AttrGeoCountry     = "geo_country"
+	AttrGeoCity        = "geo_city"
+)
+
+// GeoLookup resolves an IP address to a country ISO code and city name
+type GeoLookup interface {
+	Lookup(ip net.IP) (country, city string, err error)
+}
+
+// MaxMindGeo reads a local GeoIP2/GeoLite2 City database
+type MaxMindGeo struct {
+	db *geoip2.Reader
+}
+
+func OpenMaxMindGeo(path string) (*MaxMindGeo, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindGeo{db: db}, nil
+}
+
+func (g *MaxMindGeo) Lookup(ip net.IP) (string, string, error) {
+	record, err := g.db.City(ip)
+	if err != nil {
+		return "", "", err
+	}
+	return record.Country.IsoCode, record.City.Names["en"], nil
+}
+
+func (g *MaxMindGeo) Close() error {
+	return g.db.Close()
+}
+
+// Enricher attaches ingestion metadata, static labels and GeoIP data to entries
+type Enricher struct {
+	hostname string
+	labels   map[string]string
+	geo      GeoLookup // optional
+}
+
+func NewEnricher(hostname string, labels map[string]string, geo GeoLookup) *Enricher {
+	return &Enricher{hostname: hostname, labels: labels, geo: geo}
+}
+
+// ParseLabels parses "key=value,key=value" into a map
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// Enrich adds metadata to the entry. Values set here override attributes
+// sent by the client, so stored metadata can be trusted.
+func (e *Enricher) Enrich(entry *models.LogEntry, header nats.Header) {
+	if entry.Attributes == nil {
+		entry.Attributes = make(map[string]string, len(e.labels)+6)
+	}
+	attrs := entry.Attributes
+
+	for key, value := range e.labels {
+		attrs[key] = value
+	}
+	attrs[AttrProcessingHost] = e.hostname
+
+	setIfPresent(attrs, AttrIngestHost, header.Get(models.HeaderIngestHost))
+	setIfPresent(attrs, AttrReceivedAt, header.Get(models.HeaderReceivedAt))
+
+	clientIP := header.Get(models.HeaderClientIP)
+	setIfPresent(attrs, AttrClientIP, clientIP)
+
+	if e.geo == nil || clientIP == "" {
+		return
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() {
+		return
+	}
+	country, city, err := e.geo.Lookup(ip)
+	if err != nil {
+		return
+	}
+	setIfPresent(attrs, AttrGeoCountry, country)
+	setIfPresent(attrs, AttrGeoCity, city)
+}
+
+func setIfPresent(attrs map[string]string, key, value string) {
+	if value != "" {
+		attrs[key] = value
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+type fakeGeo struct {
+	calls int
+}
+
+func (g *fakeGeo) Lookup(ip net.IP) (string, string, error) {
+	g.calls++
+	if ip.String() == "203.0.113.9" {
+		return "DE", "Berlin", nil
+	}
+	return "", "", errors.New("not found")
+}
+
+func TestEnricherAddsMetadata(t *testing.T) {
+	geo := &fakeGeo{}
+	enricher := NewEnricher("proc-1", map[string]string{"env": "prod", "region": "eu-west-1"}, geo)
+
+	header := nats.Header{}
+	header.Set(models.HeaderIngestHost, "ingest-2")
+	header.Set(models.HeaderClientIP, "203.0.113.9")
+	header.Set(models.HeaderReceivedAt, "2025-07-24T16:00:00Z")
+
+	entry := models.LogEntry{Message: "m", Attributes: map[string]string{"env": "spoofed", "user_id": "42"}}
+	enricher.Enrich(&entry, header)
+
+	expected := map[string]string{
+		"env":              "prod",
+		"region":           "eu-west-1",
+		"user_id":          "42",
+		AttrProcessingHost: "proc-1",
+		AttrIngestHost:     "ingest-2",
+		AttrClientIP:       "203.0.113.9",
+		AttrReceivedAt:     "2025-07-24T16:00:00Z",
+		AttrGeoCountry:     "DE",
+		AttrGeoCity:        "Berlin",
+	}
+	for key, value := range expected {
+		if entry.Attributes[key] != value {
+			t.Errorf("attribute %s = %q, expected %q", key, entry.Attributes[key], value)
+		}
+	}
+}
+
+func TestEnricherSkipsPrivateAndMissing(t *testing.T) {
+	geo := &fakeGeo{}
+	enricher := NewEnricher("proc-1", nil, geo)
+
+	header := nats.Header{}
+	header.Set(models.HeaderClientIP, "10.0.0.5")
+	entry := models.LogEntry{Message: "m"}
+	enricher.Enrich(&entry, header)
+	if geo.calls != 0 {
+		t.Error("private addresses must not be looked up")
+	}
+
+	// Messages published without headers still get the processing host
+	bare := models.LogEntry{Message: "m"}
+	enricher.Enrich(&bare, nil)
+	if bare.Attributes[AttrProcessingHost] != "proc-1" || len(bare.Attributes) != 1 {
+		t.Errorf("unexpected attributes: %v", bare.Attributes)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(" env=prod , cluster=eu-1,,region=")
+	if err != nil {
+		t.Fatalf("ParseLabels failed: %v", err)
+	}
+	if len(labels) != 3 || labels["env"] != "prod" || labels["cluster"] != "eu-1" || labels["region"] != "" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	if _, err := ParseLabels("env"); err == nil {
+		t.Error("expected error for label without value")
+	}
+}
@@ -10,58 +10,105 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
+	"github.com/yourusername/oglogstream-logstore"
 	"github.com/yourusername/oglogstream-models"
 )
 
 const (
-	batchSize    = 100
-	flushTimeout = 2 * time.Second
-	maxRetries   = 3
+	batchSize        = 100
+	batchMinSize     = 10
+	batchMaxSize     = 10000
+	batchMaxBytes    = 1 << 20 // 1MB
+	flushTimeout     = 2 * time.Second
+	maxRetries       = 3
+	insertWorkers    = 4
+	maxInFlightBytes = 64 << 20 // 64MB
+	targetLatency    = time.Second
 )
 
+type pendingBatch struct {
+	id         string
+	entries    []models.LogEntry
+	deliveries []Delivery
+	bytes      int
+}
+
 type BatchProcessor struct {
-	db       *sql.DB
-	hostname string
-	batch    []models.LogEntry
-	mutex    sync.Mutex
-	done     chan bool
+	store      logstore.BatchWriter
+	hostname   string
+	config     BatchConfig
+	batch      []models.LogEntry
+	deliveries []Delivery
+	batchBytes int
+	mutex      sync.Mutex
+	done       chan bool
+	
+	// Flushed batches go to a fixed pool of inserters
+	queue    chan pendingBatch
+	inflight *inflightBudget
+	sizer    *batchSizer
+	timer    sync.WaitGroup
+	workers  sync.WaitGroup
+	inserted atomic.Uint64
+	failed   atomic.Uint64
+	skipped  atomic.Uint64 // redelivered entries already stored
+	blocked  atomic.Int64 // nanoseconds AddEntry spent waiting for the budget
 }
 
-func NewBatchProcessor(db *sql.DB, hostname string) *BatchProcessor {
+func NewBatchProcessor(store logstore.BatchWriter, hostname string, config BatchConfig) *BatchProcessor {
 	bp := &BatchProcessor{
-		db:       db,
+		store:    store,
 		hostname: hostname,
-		batch:    make([]models.LogEntry, 0, batchSize),
+		config:   config,
+		batch:    make([]models.LogEntry, 0, config.Size),
 		done:     make(chan bool),
+		queue:    make(chan pendingBatch, config.Workers),
+		inflight: newInflightBudget(config.MaxInFlightBytes),
+		sizer:    newBatchSizer(config),
+	}
+	
+	// Start inserters
+	for i := 0; i < config.Workers; i++ {
+		bp.workers.Add(1)
+		go bp.insertWorker()
 	}
 	
 	// Start flush timer
+	bp.timer.Add(1)
 	go bp.flushTimer()
 	
 	return bp
 }
 
-func (bp *BatchProcessor) AddEntry(entry models.LogEntry) {
+// AddEntry blocks while the in-flight budget is exhausted, so a slow
+// ClickHouse slows down consumption instead of growing memory. The stream
+// messages the entry was built from are acknowledged once it is stored.
+func (bp *BatchProcessor) AddEntry(entry models.LogEntry, deliveries ...Delivery) {
 	bp.mutex.Lock()
 	defer bp.mutex.Unlock()
 	
 	bp.batch = append(bp.batch, entry)
+	bp.deliveries = append(bp.deliveries, deliveries...)
+	bp.batchBytes += entrySize(&entry)
 	
-	if len(bp.batch) >= batchSize {
+	if len(bp.batch) >= bp.sizer.Size() || bp.batchBytes >= bp.config.MaxBytes {
 		bp.flushBatch()
 	}
 }
 
 func (bp *BatchProcessor) flushTimer() {
-	ticker := time.NewTicker(flushTimeout)
+	defer bp.timer.Done()
+	ticker := time.NewTicker(bp.config.FlushTimeout)
 	defer ticker.Stop()
 	
 	for {
@@ -78,77 +125,142 @@ func (bp *BatchProcessor) flushTimer() {
 	}
 }
 
+// flushBatch hands the current batch to the inserters. Called with mutex held.
 func (bp *BatchProcessor) flushBatch() {
 	if len(bp.batch) == 0 {
 		return
 	}
 	
-	batch := make([]models.LogEntry, len(bp.batch))
-	copy(batch, bp.batch)
+	pending := pendingBatch{
+		entries:    make([]models.LogEntry, len(bp.batch)),
+		deliveries: bp.deliveries,
+		bytes:      bp.batchBytes,
+	}
+	copy(pending.entries, bp.batch)
+	pending.id = batchID(pending.deliveries)
 	bp.batch = bp.batch[:0] // reset slice
+	bp.deliveries = nil
+	bp.batchBytes = 0
 	
-	// Insert batch with retries
-	go bp.insertBatchWithRetry(batch)
+	start := time.Now()
+	bp.inflight.acquire(pending.bytes)
+	bp.queue <- pending
+	if waited := time.Since(start); waited > time.Millisecond {
+		bp.blocked.Add(int64(waited))
+	}
 }
 
-func (bp *BatchProcessor) insertBatchWithRetry(batch []models.LogEntry) {
-	for attempt := 1; attempt <= maxRetries; attempt++ {
+func (bp *BatchProcessor) insertWorker() {
+	defer bp.workers.Done()
+	for pending := range bp.queue {
+		bp.insertBatchWithRetry(pending)
+		bp.inflight.release(pending.bytes)
+	}
+}
+
+// insertBatchWithRetry retries with the batch ID as deduplication token, so
+// an attempt that timed out after ClickHouse committed isn't stored twice
+func (bp *BatchProcessor) insertBatchWithRetry(batch pendingBatch) {
+	for attempt := 1; attempt <= bp.config.MaxRetries; attempt++ {
+		start := time.Now()
 		err := bp.insertBatch(batch)
 		if err == nil {
-			log.Printf("[%s] Successfully inserted batch of %d logs", bp.hostname, len(batch))
+			bp.sizer.Observe(time.Since(start))
+			bp.inserted.Add(uint64(len(batch.entries)))
+			for _, d := range batch.deliveries {
+				d.Ack()
+			}
+			log.Printf("[%s] Successfully inserted batch %s of %d logs", bp.hostname, batch.id, len(batch.entries))
 			return
 		}
 		
+		bp.sizer.Failed()
 		log.Printf("[%s] Batch insert attempt %d failed: %v", bp.hostname, attempt, err)
-		if attempt < maxRetries {
+		if attempt < bp.config.MaxRetries {
 			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 	}
 	
-	log.Printf("[%s] Failed to insert batch after %d attempts, dropping %d logs", bp.hostname, maxRetries, len(batch))
+	// Unacknowledged messages come back from the stream in a later batch
+	bp.failed.Add(uint64(len(batch.entries)))
+	for _, d := range batch.deliveries {
+		d.Nak()
+	}
+	log.Printf("[%s] Failed to insert batch %s after %d attempts, returning %d logs to the stream", bp.hostname, batch.id, bp.config.MaxRetries, len(batch.entries))
 }
 
-func (bp *BatchProcessor) insertBatch(batch []models.LogEntry) error {
-	if len(batch) == 0 {
+func (bp *BatchProcessor) insertBatch(batch pendingBatch) error {
+	if len(batch.entries) == 0 {
 		return nil
 	}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	
-	tx, err := bp.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	if batch.id != "" {
+		ctx = logstore.WithInsertToken(ctx, batch.id)
 	}
-	defer tx.Rollback()
 	
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO logs (timestamp, level, message, service) VALUES (?, ?, ?, ?)`)
+	entries, err := bp.unstored(ctx, batch.entries)
 	if err != nil {
-		return err
+		return fmt.Errorf("looking up stored IDs: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return bp.store.WriteBatch(ctx, entries)
+}
+
+// unstored leaves out the entries whose event ID is already stored. The insert
+// token only covers a batch retried as is, while an entry redelivered after
+// AckWait comes back in a batch made up of other messages.
+func (bp *BatchProcessor) unstored(ctx context.Context, entries []models.LogEntry) ([]models.LogEntry, error) {
+	lookup, ok := bp.store.(logstore.IDLookup)
+	if !ok {
+		return entries, nil
+	}
+	stored, err := lookup.StoredIDs(ctx, entries)
+	if err != nil || len(stored) == 0 {
+		return entries, err
 	}
-	defer stmt.Close()
 	
-	for _, entry := range batch {
-		_, err = stmt.ExecContext(ctx, entry.Timestamp, entry.Level, entry.Message, entry.Service)
-		if err != nil {
-			return err
+	fresh := make([]models.LogEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.ID == "" || !stored[e.ID] {
+			fresh = append(fresh, e)
 		}
 	}
-	
-	return tx.Commit()
+	bp.skipped.Add(uint64(len(entries) - len(fresh)))
+	return fresh, nil
 }
 
+// Stats doesn't take the batch mutex, which is held while AddEntry is blocked
+func (bp *BatchProcessor) Stats() BatchStats {
+	return BatchStats{
+		TargetSize:    bp.sizer.Size(),
+		InFlightBytes: bp.inflight.inUse(),
+		QueuedBatches: len(bp.queue),
+		Inserted:      bp.inserted.Load(),
+		Failed:        bp.failed.Load(),
+		Skipped:       bp.skipped.Load(),
+		BlockedTime:   time.Duration(bp.blocked.Load()).String(),
+	}
+}
+
+// Stop flushes the remaining entries and waits for all inserts to finish
 func (bp *BatchProcessor) Stop() {
 	close(bp.done)
+	bp.timer.Wait()
 	
 	// Flush remaining entries
 	bp.mutex.Lock()
-	defer bp.mutex.Unlock()
-	
 	if len(bp.batch) > 0 {
 		log.Printf("[%s] Flushing remaining %d logs before shutdown", bp.hostname, len(bp.batch))
-		bp.insertBatchWithRetry(bp.batch)
+		bp.flushBatch()
 	}
+	bp.mutex.Unlock()
+	
+	close(bp.queue)
+	bp.workers.Wait()
 }
 
 func main() {
@@ -161,12 +273,8 @@ func main() {
 		chDSN = "clickhouse://default:@localhost:9000/default"
 	}
 
-	// Connect to NATS
-	nc, err := nats.Connect(natsURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to NATS: %v", err)
-	}
-	defer nc.Drain()
+	// "processing-svc migrate" applies schema migrations and exits
+	migrateOnly := len(os.Args) > 1 && os.Args[1] == "migrate"
 
 	// Connect to ClickHouse with connection pool
 	db, err := sql.Open("clickhouse", chDSN+"?max_open_conns=5&max_idle_conns=2&conn_max_lifetime=300s")
@@ -183,8 +291,122 @@ func main() {
 	// Get hostname for logging
 	hostname, _ := os.Hostname()
 	
-	// Initialize batch processor
-	processor := NewBatchProcessor(db, hostname)
+	// Apply pending schema migrations before consuming
+	if migrateOnly || os.Getenv("SKIP_MIGRATIONS") != "true" {
+		migrations, err := LoadMigrations(migrationFiles, "migrations")
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+		
+		// Retention is applied with the schema so replicas don't race on TTL changes
+		var hooks []func(context.Context) error
+		if path := os.Getenv("RETENTION_POLICY_FILE"); path != "" {
+			policy, err := LoadRetentionPolicy(path)
+			if err != nil {
+				log.Fatalf("Invalid retention policy: %v", err)
+			}
+			hooks = append(hooks, func(ctx context.Context) error {
+				changed, err := policy.Apply(ctx, db, owner)
+				if changed {
+					log.Printf("[%s] Applied retention TTL: %s", hostname, policy.TTLExpression())
+				}
+				return err
+			})
+		}
+		
+		migrator := NewMigrator(db, owner, migrations)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		err = migrator.Up(ctx, hooks...)
+		cancel()
+		if err != nil {
+			log.Fatalf("Schema migration failed: %v", err)
+		}
+		log.Printf("[%s] Schema is up to date (%d migrations)", hostname, len(migrations))
+	}
+	if migrateOnly {
+		return
+	}
+	
+	// Connect to NATS
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Drain()
+	
+	// Setup enrichment with static labels and optional GeoIP lookup
+	labels, err := ParseLabels(os.Getenv("ENRICH_LABELS"))
+	if err != nil {
+		log.Fatalf("Invalid ENRICH_LABELS: %v", err)
+	}
+	var geo GeoLookup
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		maxmind, err := OpenMaxMindGeo(path)
+		if err != nil {
+			log.Fatalf("Failed to open GeoIP database: %v", err)
+		}
+		defer maxmind.Close()
+		geo = maxmind
+	}
+	enricher := NewEnricher(hostname, labels, geo)
+	
+	// Setup PII redaction so sensitive values never reach storage
+	redactRules := DefaultRedactRules()
+	if path := os.Getenv("REDACTION_RULES_FILE"); path != "" {
+		redactRules, err = LoadRedactRules(path)
+		if err != nil {
+			log.Fatalf("Failed to load redaction rules: %v", err)
+		}
+	}
+	redactor, err := NewRedactor(redactRules, []byte(os.Getenv("REDACTION_HMAC_KEY")))
+	if err != nil {
+		log.Fatalf("Invalid redaction rules: %v", err)
+	}
+	
+	// Setup drop and sampling rules to control stored volume
+	var sampleRules []SampleRule
+	if path := os.Getenv("SAMPLING_RULES_FILE"); path != "" {
+		sampleRules, err = LoadSampleRules(path)
+		if err != nil {
+			log.Fatalf("Failed to load sampling rules: %v", err)
+		}
+	}
+	sampler, err := NewSampler(sampleRules)
+	if err != nil {
+		log.Fatalf("Invalid sampling rules: %v", err)
+	}
+	
+	// Initialize batch processor with the configured insert path
+	batchConfig, err := LoadBatchConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid batch config: %v", err)
+	}
+	insertMode, err := parseInsertMode(os.Getenv("INSERT_MODE"))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	var writer logstore.BatchWriter = logstore.NewClickHouseStore(db)
+	if insertMode == "native" {
+		conn, err := logstore.OpenNativeConn(chDSN)
+		if err != nil {
+			log.Fatalf("Failed to open native ClickHouse connection: %v", err)
+		}
+		defer conn.Close()
+		writer = logstore.NewNativeWriter(conn, os.Getenv("INSERT_ASYNC") == "true")
+	}
+	processor := NewBatchProcessor(writer, hostname, batchConfig)
+	
+	// Optionally collapse identical bursts before batching
+	var deduper *Deduper
+	if v := os.Getenv("DEDUP_WINDOW"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			log.Fatalf("Invalid DEDUP_WINDOW %q", v)
+		}
+		deduper = NewDeduper(window, processor.AddEntry)
+		log.Printf("[%s] Collapsing identical log bursts within %v", hostname, window)
+	}
 	
 	// Setup HTTP server for health checks
 	r := chi.NewRouter()
@@ -215,6 +437,34 @@ func main() {
 		w.Write([]byte(response))
 	})
 	
+	// Redaction counters per rule
+	r.Get("/redaction/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"redactions": redactor.Counts()})
+	})
+	
+	// Sampling counters per rule
+	r.Get("/sampling/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"rules": sampler.Counts()})
+	})
+	
+	// Batching and backpressure state
+	r.Get("/batch/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(processor.Stats())
+	})
+	
+	// Burst collapsing counters
+	r.Get("/dedup/stats", func(w http.ResponseWriter, r *http.Request) {
+		var counts DedupCounts
+		if deduper != nil {
+			counts = deduper.Counts()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": deduper != nil, "counts": counts})
+	})
+	
 	// Setup HTTP server
 	addr := ":8082"
 	srv := &http.Server{
@@ -238,28 +488,77 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	
-	// Subscribe to NATS
-	sub, err := nc.QueueSubscribe("logs.raw", "processing-group", func(msg *nats.Msg) {
-		var entry models.LogEntry
-		if err := json.Unmarshal(msg.Data, &entry); err != nil {
-			log.Printf("[%s] Invalid log entry: %v", hostname, err)
-			return
-		}
-		
-		processor.AddEntry(entry)
-	})
+	// Consume from a JetStream work queue so entries are acknowledged only once stored
+	streamConfig, err := LoadStreamConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid JetStream config: %v", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatalf("Failed to get JetStream context: %v", err)
+	}
+	if err := EnsureStream(js, streamConfig); err != nil {
+		log.Fatalf("Failed to set up JetStream stream: %v", err)
+	}
+	// Bound subscriptions leave the shared durable consumer in place on shutdown
+	sub, err := js.PullSubscribe("", streamConfig.Consumer, nats.Bind(streamConfig.Stream, streamConfig.Consumer))
 	if err != nil {
 		log.Fatalf("Failed to subscribe to NATS: %v", err)
 	}
-	defer sub.Unsubscribe()
+	
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		Consume(consumeCtx, sub, func(msg *nats.Msg) {
+			delivery := NewDelivery(msg)
+			
+			var entry models.LogEntry
+			if err := json.Unmarshal(msg.Data, &entry); err != nil {
+				log.Printf("[%s] Invalid log entry: %v", hostname, err)
+				delivery.Term()
+				return
+			}
+			// Entries published before ingestion assigned IDs get one here
+			if entry.ID == "" {
+				entry.ID = uuid.Must(uuid.NewV7()).String()
+			}
+			
+			if !sampler.Keep(&entry) {
+				delivery.Ack()
+				return
+			}
+			
+			enricher.Enrich(&entry, msg.Header)
+			redactor.Redact(&entry)
+			publishLive(nc, &entry)
+			
+			if deduper != nil {
+				deduper.Add(entry, delivery)
+				return
+			}
+			resetRepeat(&entry)
+			processor.AddEntry(entry, delivery)
+		})
+	}()
 
-	log.Printf("[%s] Processing service started in queue group 'processing-group'. Batch size: %d, flush timeout: %v", 
-		hostname, batchSize, flushTimeout)
+	log.Printf("[%s] Processing service consuming stream %s as '%s'. Batch size: %d (%d-%d), max bytes: %d, flush timeout: %v, insert mode: %s, workers: %d", 
+		hostname, streamConfig.Stream, streamConfig.Consumer, batchConfig.Size, batchConfig.MinSize, batchConfig.MaxSize, batchConfig.MaxBytes, batchConfig.FlushTimeout, insertMode, batchConfig.Workers)
 	
 	// Wait for shutdown signal
 	<-sigChan
 	log.Printf("[%s] Shutdown signal received, stopping gracefully...", hostname)
 	
+	// Stop consuming before draining the pipeline
+	stopConsuming()
+	<-consumed
+	sub.Unsubscribe()
+	
+	// Stop collapsing stage first so its open groups reach the batch
+	if deduper != nil {
+		deduper.Stop()
+	}
+	
 	// Stop batch processor
 	processor.Stop()
 	
@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"testing"
+	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/yourusername/oglogstream-logstore"
 	"github.com/yourusername/oglogstream-models"
 )
 
@@ -49,4 +51,28 @@ func TestInsertLogToClickHouse(t *testing.T) {
 	if mdb.lastQuery == "" || len(mdb.lastArgs) != 4 {
 		t.Errorf("unexpected query or args: %v %v", mdb.lastQuery, mdb.lastArgs)
 	}
-} 
\ No newline at end of file
+}
+
+func TestBatchProcessorWritesToStore(t *testing.T) {
+	store := logstore.NewMemoryStore()
+	bp := NewBatchProcessor(store, "test", DefaultBatchConfig())
+
+	for i := 0; i < batchSize+5; i++ {
+		bp.AddEntry(models.LogEntry{Timestamp: time.Now(), Level: "info", Message: "m", Service: "svc"})
+	}
+
+	// A full batch is flushed asynchronously as soon as it fills up
+	deadline := time.Now().Add(time.Second)
+	for len(store.Entries()) < batchSize {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a full batch of %d, got %d entries", batchSize, len(store.Entries()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stop flushes the remainder synchronously
+	bp.Stop()
+	if got := len(store.Entries()); got != batchSize+5 {
+		t.Errorf("expected %d stored entries after stop, got %d", batchSize+5, got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	migrationLockTTL    = 5 * time.Minute
+	migrationLockSettle = time.Second
+	migrationLockWait   = 2 * time.Minute
+)
+
+// Migration is a numbered set of SQL statements applied exactly once.
+// Statements should be idempotent (IF NOT EXISTS, MODIFY COLUMN) so that a
+// migration interrupted half way can simply be applied again.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// LoadMigrations reads NNNN_name.sql files from fsys in version order
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: file name must look like 0001_name.sql", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migration %s: version %d already used by %s", file, version, other)
+		}
+		seen[version] = file
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		statements := splitStatements(string(data))
+		if len(statements) == 0 {
+			return nil, fmt.Errorf("migration %s: no statements", file)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, Statements: statements})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits a script on ';' and drops "--" comment lines.
+// Semicolons inside string literals are not supported.
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var statements []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+// Migrator applies pending migrations and records them in schema_migrations.
+// Replicas starting together serialise on a lease row in
+// schema_migrations_lock, so only one of them runs DDL at a time.
+type Migrator struct {
+	db         *sql.DB
+	owner      string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, owner string, migrations []Migration) *Migrator {
+	return &Migrator{db: db, owner: owner, migrations: migrations}
+}
+
+// Up applies every migration newer than the recorded versions, then runs
+// hooks while still holding the lock
+func (m *Migrator) Up(ctx context.Context, hooks ...func(context.Context) error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return fmt.Errorf("create migration tables: %w", err)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("read applied migrations: %w", err)
+	}
+
+	for _, migration := range m.migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		log.Printf("[%s] Applying migration %04d_%s", m.owner, migration.Version, migration.Name)
+		for i, stmt := range migration.Statements {
+			if _, err := m.db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %04d_%s statement %d: %w", migration.Version, migration.Name, i+1, err)
+			}
+		}
+		if _, err := m.db.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_by) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, m.owner); err != nil {
+			return fmt.Errorf("record migration %04d: %w", migration.Version, err)
+		}
+	}
+
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version UInt32,
+			name String,
+			applied_by String,
+			applied_at DateTime64(3) DEFAULT now64(3)
+		) ENGINE = ReplacingMergeTree(applied_at)
+		ORDER BY version`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id UInt8,
+			owner String,
+			expires_at DateTime64(3),
+			acquired_at DateTime64(3) DEFAULT now64(3)
+		) ENGINE = ReplacingMergeTree(acquired_at)
+		ORDER BY id`,
+	}
+	for _, stmt := range statements {
+		if _, err := m.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int]bool, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT DISTINCT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version uint32
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[int(version)] = true
+	}
+	return applied, rows.Err()
+}
+
+// lockOwner returns the current lease holder, or "" when the lease is free
+func (m *Migrator) lockOwner(ctx context.Context) (string, error) {
+	var owner string
+	err := m.db.QueryRowContext(ctx,
+		`SELECT owner FROM schema_migrations_lock FINAL WHERE id = 1 AND expires_at > now64(3)`).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return owner, err
+}
+
+// lock takes the lease: claim it when free, wait for concurrent claims to
+// land, then check that ours is the latest. Every replica reads the same
+// latest row, so exactly one of them wins.
+func (m *Migrator) lock(ctx context.Context) error {
+	deadline := time.Now().Add(migrationLockWait)
+	for {
+		owner, err := m.lockOwner(ctx)
+		if err != nil {
+			return fmt.Errorf("read migration lock: %w", err)
+		}
+
+		if owner == "" {
+			_, err := m.db.ExecContext(ctx,
+				`INSERT INTO schema_migrations_lock (id, owner, expires_at) VALUES (1, ?, ?)`,
+				m.owner, leaseExpiry(ctx, time.Now()))
+			if err != nil {
+				return fmt.Errorf("claim migration lock: %w", err)
+			}
+			time.Sleep(migrationLockSettle)
+			if owner, err = m.lockOwner(ctx); err != nil {
+				return fmt.Errorf("read migration lock: %w", err)
+			}
+		}
+
+		if owner == m.owner {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("migration lock held by %s", owner)
+		}
+		log.Printf("[%s] Waiting for migrations running on %s", m.owner, owner)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * migrationLockSettle):
+		}
+	}
+}
+
+// leaseExpiry outlives the deadline of ctx by migrationLockTTL. The driver
+// bounds each statement by that deadline, so a replica that dies mid-migration
+// holds the lease until the server has stopped running its statements too,
+// and a restart cannot run the same migration alongside them.
+func leaseExpiry(ctx context.Context, now time.Time) time.Time {
+	if deadline, ok := ctx.Deadline(); ok && deadline.After(now) {
+		return deadline.Add(migrationLockTTL)
+	}
+	return now.Add(migrationLockTTL)
+}
+
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx,
+		`INSERT INTO schema_migrations_lock (id, owner, expires_at) VALUES (1, ?, ?)`,
+		m.owner, time.Unix(0, 0))
+	if err != nil {
+		log.Printf("[%s] Failed to release migration lock: %v", m.owner, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, expected %d (versions must be contiguous)", m.Name, m.Version, i+1)
+		}
+	}
+
+	// Debug entries must be storable once migrations are applied
+	found := false
+	for _, m := range migrations {
+		for _, stmt := range m.Statements {
+			if strings.Contains(stmt, "'debug'") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("no migration adds the debug level")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.sql": {Data: []byte("-- comment; with semicolon\nALTER TABLE t ADD COLUMN a UInt8;\n\nALTER TABLE t ADD COLUMN b UInt8;\n")},
+		"m/0001_first.sql":  {Data: []byte("CREATE TABLE t (x UInt8) ENGINE = Memory")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 2 {
+		t.Fatalf("unexpected migrations: %+v", migrations)
+	}
+	if len(migrations[1].Statements) != 2 || migrations[1].Statements[1] != "ALTER TABLE t ADD COLUMN b UInt8" {
+		t.Errorf("unexpected statements: %q", migrations[1].Statements)
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":  {"m/first.sql": {Data: []byte("SELECT 1")}},
+		"duplicate": {"m/0001_a.sql": {Data: []byte("SELECT 1")}, "m/01_b.sql": {Data: []byte("SELECT 1")}},
+		"empty":     {"m/0001_a.sql": {Data: []byte("-- nothing\n")}},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadMigrations(fsys, "m"); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	now := time.Now()
+	if got := leaseExpiry(context.Background(), now); !got.Equal(now.Add(migrationLockTTL)) {
+		t.Errorf("expected the TTL without a deadline, got %v", got.Sub(now))
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(10*time.Minute))
+	defer cancel()
+	if got := leaseExpiry(ctx, now); !got.Equal(now.Add(10*time.Minute + migrationLockTTL)) {
+		t.Errorf("expected the lease to outlive the deadline, got %v", got.Sub(now))
+	}
+}
@@ -1,3 +1,4 @@
+-- Initial schema, as previously created by clickhouse-init.sql
 CREATE TABLE IF NOT EXISTS logs (
     timestamp DateTime,
     level Enum8('info'=1, 'warn'=2, 'error'=3, 'fatal'=4),
@@ -5,4 +6,4 @@ CREATE TABLE IF NOT EXISTS logs (
     service String
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMM(timestamp)
-ORDER BY (service, timestamp); 
\ No newline at end of file
+ORDER BY (service, timestamp);
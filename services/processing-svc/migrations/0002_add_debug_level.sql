@@ -0,0 +1,2 @@
+-- ingestion-api accepts debug, the original enum rejected it at insert time
+ALTER TABLE logs MODIFY COLUMN level Enum8('debug'=0, 'info'=1, 'warn'=2, 'error'=3, 'fatal'=4);
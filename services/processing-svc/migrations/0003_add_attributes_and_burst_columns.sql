@@ -0,0 +1,5 @@
+-- Enrichment attributes and burst collapsing counters
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS attributes Map(String, String) AFTER service;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS repeat_count UInt32 DEFAULT 1;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS first_seen DateTime DEFAULT timestamp;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS last_seen DateTime DEFAULT timestamp;
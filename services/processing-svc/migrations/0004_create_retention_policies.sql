@@ -0,0 +1,8 @@
+-- History of applied retention policies, read by query-api
+CREATE TABLE IF NOT EXISTS retention_policies (
+    applied_at DateTime64(3) DEFAULT now64(3),
+    applied_by String,
+    policy String,
+    ttl_expression String
+) ENGINE = MergeTree()
+ORDER BY applied_at;
@@ -0,0 +1,3 @@
+-- Keep hashes of recent inserts so retried batches with the same
+-- insert_deduplication_token are dropped instead of stored twice
+ALTER TABLE logs MODIFY SETTING non_replicated_deduplication_window = 1000;
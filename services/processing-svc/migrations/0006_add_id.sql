@@ -0,0 +1,3 @@
+-- Event IDs assigned by ingestion-api; rows stored before have an empty ID
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS id String DEFAULT '' FIRST;
+ALTER TABLE logs ADD INDEX IF NOT EXISTS idx_id id TYPE bloom_filter(0.01) GRANULARITY 4;
@@ -0,0 +1,4 @@
+-- W3C trace context, indexed for trace lookups across services
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS trace_id String DEFAULT '';
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS span_id String DEFAULT '';
+ALTER TABLE logs ADD INDEX IF NOT EXISTS idx_trace_id trace_id TYPE bloom_filter(0.01) GRANULARITY 4;
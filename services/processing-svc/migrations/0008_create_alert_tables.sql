@@ -0,0 +1,18 @@
+-- Alert rules managed by alerting-svc as JSON; the highest version of an ID wins
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id String,
+    rule String,
+    version UInt64,
+    deleted UInt8 DEFAULT 0
+) ENGINE = ReplacingMergeTree(version)
+ORDER BY id;
+
+-- Alert state changes recorded by alerting-svc
+CREATE TABLE IF NOT EXISTS alert_events (
+    rule_id String,
+    state LowCardinality(String),
+    value Float64,
+    at DateTime64(3),
+    message String
+) ENGINE = MergeTree()
+ORDER BY (rule_id, at);
@@ -0,0 +1,11 @@
+-- Notification silences managed by alerting-svc as JSON; the highest version
+-- of an ID wins and expired silences are dropped after 30 days
+CREATE TABLE IF NOT EXISTS alert_silences (
+    id String,
+    silence String,
+    ends_at DateTime64(3),
+    version UInt64,
+    deleted UInt8 DEFAULT 0
+) ENGINE = ReplacingMergeTree(version)
+ORDER BY id
+TTL toDateTime(ends_at) + INTERVAL 30 DAY;
@@ -0,0 +1,9 @@
+-- Saved searches managed by query-api as JSON; the highest version of an ID wins
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id String,
+    owner String,
+    search String,
+    version UInt64,
+    deleted UInt8 DEFAULT 0
+) ENGINE = ReplacingMergeTree(version)
+ORDER BY id;
@@ -0,0 +1,20 @@
+-- Async query jobs managed by query-api as JSON; the highest version of an ID
+-- wins. Jobs and their results are dropped after a day.
+CREATE TABLE IF NOT EXISTS query_jobs (
+    id String,
+    job String,
+    version UInt64,
+    created_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(version)
+ORDER BY id
+TTL created_at + INTERVAL 1 DAY;
+
+-- Entries found by a job, as JSON in result order
+CREATE TABLE IF NOT EXISTS query_job_results (
+    job_id String,
+    seq UInt64,
+    entry String,
+    created_at DateTime DEFAULT now()
+) ENGINE = MergeTree()
+ORDER BY (job_id, seq)
+TTL created_at + INTERVAL 1 DAY;
@@ -0,0 +1,34 @@
+-- Hourly entry counts by service and level, kept up to date by a
+-- materialized view so aggregations over whole hours don't scan logs.
+-- Counts outlive the entries they count when retention deletes them.
+CREATE TABLE IF NOT EXISTS logs_hourly (
+    hour DateTime,
+    service LowCardinality(String),
+    level LowCardinality(String),
+    count SimpleAggregateFunction(sum, UInt64)
+) ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(hour)
+ORDER BY (hour, service, level);
+
+-- The view is recreated and the table emptied on every run, so that a run
+-- interrupted after the backfill below can be applied again.
+DROP VIEW IF EXISTS logs_hourly_mv;
+
+TRUNCATE TABLE logs_hourly;
+
+CREATE MATERIALIZED VIEW logs_hourly_mv TO logs_hourly AS
+SELECT toStartOfHour(timestamp) AS hour, service, toString(level) AS level, sum(toUInt64(repeat_count)) AS count
+FROM logs
+GROUP BY hour, service, level;
+
+-- Count entries stored before the view existed, up to its creation time, as
+-- the view counts the rest. Entries inserted in the seconds after it with an
+-- earlier timestamp are counted by both.
+INSERT INTO logs_hourly
+SELECT toStartOfHour(timestamp) AS hour, service, toString(level) AS level, sum(toUInt64(repeat_count)) AS count
+FROM logs
+WHERE timestamp < (
+    SELECT metadata_modification_time FROM system.tables
+    WHERE database = currentDatabase() AND name = 'logs_hourly_mv'
+)
+GROUP BY hour, service, level;
@@ -0,0 +1,33 @@
+-- Per-minute entry counts by service and level for the last 31 days, kept
+-- like logs_hourly. query-api reads the last 30 days from it and older
+-- minutes from logs.
+CREATE TABLE IF NOT EXISTS logs_minutely (
+    minute DateTime,
+    service LowCardinality(String),
+    level LowCardinality(String),
+    count SimpleAggregateFunction(sum, UInt64)
+) ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMMDD(minute)
+ORDER BY (minute, service, level)
+TTL minute + INTERVAL 31 DAY;
+
+-- Rerunnable like logs_hourly: the view is recreated and the table emptied
+DROP VIEW IF EXISTS logs_minutely_mv;
+
+TRUNCATE TABLE logs_minutely;
+
+CREATE MATERIALIZED VIEW logs_minutely_mv TO logs_minutely AS
+SELECT toStartOfMinute(timestamp) AS minute, service, toString(level) AS level, sum(toUInt64(repeat_count)) AS count
+FROM logs
+GROUP BY minute, service, level;
+
+-- Count recent entries stored before the view existed, up to its creation
+-- time, with the same caveat as for logs_hourly
+INSERT INTO logs_minutely
+SELECT toStartOfMinute(timestamp) AS minute, service, toString(level) AS level, sum(toUInt64(repeat_count)) AS count
+FROM logs
+WHERE timestamp >= now() - INTERVAL 31 DAY AND timestamp < (
+    SELECT metadata_modification_time FROM system.tables
+    WHERE database = currentDatabase() AND name = 'logs_minutely_mv'
+)
+GROUP BY minute, service, level;
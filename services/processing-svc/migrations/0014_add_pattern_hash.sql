@@ -0,0 +1,4 @@
+-- Hash of the message template with variable tokens masked, written by
+-- logstore so patterns are grouped without reading messages. Entries
+-- stored before keep 0 and belong to no pattern.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS pattern_hash UInt64 DEFAULT 0;
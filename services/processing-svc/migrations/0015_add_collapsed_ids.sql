@@ -0,0 +1,4 @@
+-- IDs of the entries a burst row stands for besides its own, so each of them
+-- still resolves to the row. Rows stored before keep an empty array.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS collapsed_ids Array(String) DEFAULT [];
+ALTER TABLE logs ADD INDEX IF NOT EXISTS idx_collapsed_ids collapsed_ids TYPE bloom_filter(0.01) GRANULARITY 4;
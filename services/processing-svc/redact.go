@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// RedactAction defines what happens to a matched value
+type RedactAction string
+
+const (
+	ActionMask RedactAction = "mask" // replace the value with a placeholder
+	ActionHash RedactAction = "hash" // replace the value with a keyed HMAC
+	ActionDrop RedactAction = "drop" // clear the whole field
+)
+
+// RedactRule describes either a built-in detector or a custom regex rule.
+// When the pattern has a capture group only the first group is redacted,
+// which keeps prefixes like "Bearer " readable.
+type RedactRule struct {
+	Name     string       `json:"name"`
+	Detector string       `json:"detector,omitempty"` // built-in detector name
+	Pattern  string       `json:"pattern,omitempty"`  // custom regex
+	Action   RedactAction `json:"action"`
+	Fields   []string     `json:"fields,omitempty"` // message, service, attributes; defaults to message and attributes
+}
+
+type detector struct {
+	pattern  string
+	validate func(string) bool
+}
+
+// Built-in detectors, keyed by name
+var builtinDetectors = map[string]detector{
+	"email":       {pattern: `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`},
+	"credit_card": {pattern: `\b(?:\d[ \-]?){12,18}\d\b`, validate: luhnValid},
+	"jwt":         {pattern: `\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`},
+	"bearer":      {pattern: `(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`},
+	"ipv4":        {pattern: `\b(?:\d{1,3}\.){3}\d{1,3}\b`, validate: isIPv4},
+	"ipv6":        {pattern: `(?:^|[^0-9A-Za-z_:.])([0-9A-Za-z_:.]*:[0-9A-Za-z_:.]*[0-9A-Za-z_:])`, validate: isIPv6},
+}
+
+// Detectors are applied in this order when no rules are configured.
+// Tokens go first so that their contents are not partially matched by others.
+var defaultDetectorOrder = []string{"jwt", "bearer", "email", "credit_card", "ipv6", "ipv4"}
+
+type compiledRule struct {
+	RedactRule
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+// Redactor removes sensitive values from log entries before they are stored
+type Redactor struct {
+	rules   []compiledRule
+	hashKey []byte
+
+	mutex  sync.Mutex
+	counts map[string]uint64
+}
+
+// DefaultRedactRules masks every built-in detector in the message and attributes
+func DefaultRedactRules() []RedactRule {
+	rules := make([]RedactRule, 0, len(defaultDetectorOrder))
+	for _, name := range defaultDetectorOrder {
+		rules = append(rules, RedactRule{Name: name, Detector: name, Action: ActionMask})
+	}
+	return rules
+}
+
+// LoadRedactRules reads a JSON array of rules from path
+func LoadRedactRules(path string) ([]RedactRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedactRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func NewRedactor(rules []RedactRule, hashKey []byte) (*Redactor, error) {
+	r := &Redactor{
+		hashKey: hashKey,
+		counts:  make(map[string]uint64),
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = rule.Detector
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if len(rule.Fields) == 0 {
+			rule.Fields = []string{"message", "attributes"}
+		}
+		for _, field := range rule.Fields {
+			if field != "message" && field != "service" && field != "attributes" {
+				return nil, fmt.Errorf("rule %q: unsupported field %q", rule.Name, field)
+			}
+		}
+
+		switch rule.Action {
+		case ActionMask, ActionDrop:
+		case ActionHash:
+			if len(hashKey) == 0 {
+				return nil, fmt.Errorf("rule %q: hash action requires REDACTION_HMAC_KEY", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %q: invalid action %q", rule.Name, rule.Action)
+		}
+
+		pattern := rule.Pattern
+		var validate func(string) bool
+		if rule.Detector != "" {
+			d, ok := builtinDetectors[rule.Detector]
+			if !ok {
+				return nil, fmt.Errorf("rule %q: unknown detector %q", rule.Name, rule.Detector)
+			}
+			pattern, validate = d.pattern, d.validate
+		}
+		if pattern == "" {
+			return nil, fmt.Errorf("rule %q: detector or pattern is required", rule.Name)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		r.rules = append(r.rules, compiledRule{RedactRule: rule, re: re, validate: validate})
+	}
+
+	return r, nil
+}
+
+// Redact applies all rules to the entry in place
+func (r *Redactor) Redact(entry *models.LogEntry) {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		for _, field := range rule.Fields {
+			switch field {
+			case "message":
+				entry.Message = r.apply(rule, entry.Message)
+			case "service":
+				entry.Service = r.apply(rule, entry.Service)
+			case "attributes":
+				for key, value := range entry.Attributes {
+					redacted := r.apply(rule, value)
+					if redacted == "" && value != "" {
+						// Dropped attributes are removed entirely
+						delete(entry.Attributes, key)
+					} else {
+						entry.Attributes[key] = redacted
+					}
+				}
+			}
+		}
+	}
+}
+
+func (r *Redactor) apply(rule *compiledRule, value string) string {
+	if value == "" {
+		return value
+	}
+
+	matches := rule.re.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+
+	var out []byte
+	last, hits := 0, 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		secret := value[start:end]
+		if rule.validate != nil && !rule.validate(secret) {
+			continue
+		}
+		hits++
+		if rule.Action == ActionDrop {
+			break
+		}
+		out = append(out, value[last:start]...)
+		out = append(out, r.replacement(rule, secret)...)
+		last = end
+	}
+
+	if hits == 0 {
+		return value
+	}
+	r.count(rule.Name, hits)
+
+	if rule.Action == ActionDrop {
+		return ""
+	}
+	out = append(out, value[last:]...)
+	return string(out)
+}
+
+func (r *Redactor) replacement(rule *compiledRule, secret string) string {
+	if rule.Action == ActionHash {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(secret))
+		return "[" + rule.Name + ":" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+	}
+	return "[REDACTED:" + rule.Name + "]"
+}
+
+func (r *Redactor) count(name string, n int) {
+	r.mutex.Lock()
+	r.counts[name] += uint64(n)
+	r.mutex.Unlock()
+}
+
+// Counts returns a snapshot of redactions performed per rule
+func (r *Redactor) Counts() map[string]uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := make(map[string]uint64, len(r.rules))
+	for _, rule := range r.rules {
+		counts[rule.Name] = r.counts[rule.Name]
+	}
+	return counts
+}
+
+// luhnValid checks a card number candidate, ignoring spaces and dashes
+func luhnValid(s string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+// isIPv6 takes whole words, so that scope operators such as std::vector or
+// Foo::Bar are not cut into addresses, and wants two groups at least, which
+// leaves out :: and ::1. Names made of hex letters, like A::B or
+// Cafe::Beef, have no digit.
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil || !strings.ContainsAny(s, "0123456789") {
+		return false
+	}
+	groups := 0
+	for _, g := range strings.Split(s, ":") {
+		if g != "" {
+			groups++
+		}
+	}
+	return groups >= 2
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// logLevels are the values of the level Enum8 of logs, as of migration 0002.
+// A policy naming any other level would only fail when its TTL is applied.
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true, "fatal": true}
+
+// RetentionOverride keeps matching entries for Days. Empty fields match
+// anything; tenant matches the "tenant" attribute.
+type RetentionOverride struct {
+	Service string `json:"service,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	Days    int    `json:"days"`
+}
+
+// RetentionPolicy maps entries to a number of days they are kept.
+// Overrides are checked in order, then per-level days, then DefaultDays.
+type RetentionPolicy struct {
+	DefaultDays int                 `json:"default_days"`
+	Levels      map[string]int      `json:"levels,omitempty"`
+	Overrides   []RetentionOverride `json:"overrides,omitempty"`
+}
+
+// LoadRetentionPolicy reads and validates a JSON policy from path
+func LoadRetentionPolicy(path string) (*RetentionPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy RetentionPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *RetentionPolicy) Validate() error {
+	if p.DefaultDays <= 0 {
+		return errors.New("default_days must be positive")
+	}
+	for level, days := range p.Levels {
+		if !logLevels[level] {
+			return fmt.Errorf("level %q: unknown level", level)
+		}
+		if days <= 0 {
+			return fmt.Errorf("level %q: days must be positive", level)
+		}
+	}
+	for i, o := range p.Overrides {
+		if o.Days <= 0 {
+			return fmt.Errorf("override %d: days must be positive", i)
+		}
+		if o.Service == "" && o.Level == "" && o.Tenant == "" {
+			return fmt.Errorf("override %d: service, level or tenant is required", i)
+		}
+		if o.Level != "" && !logLevels[o.Level] {
+			return fmt.Errorf("override %d: unknown level %q", i, o.Level)
+		}
+	}
+	return nil
+}
+
+// TTLExpression renders the policy as a ClickHouse TTL expression for logs
+func (p *RetentionPolicy) TTLExpression() string {
+	var args []string
+
+	for _, o := range p.Overrides {
+		var conds []string
+		if o.Service != "" {
+			conds = append(conds, "service = "+quoteString(o.Service))
+		}
+		if o.Level != "" {
+			conds = append(conds, "level = "+quoteString(o.Level))
+		}
+		if o.Tenant != "" {
+			conds = append(conds, "attributes['tenant'] = "+quoteString(o.Tenant))
+		}
+		args = append(args, strings.Join(conds, " AND "), fmt.Sprint(o.Days))
+	}
+
+	levels := make([]string, 0, len(p.Levels))
+	for level := range p.Levels {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		args = append(args, "level = "+quoteString(level), fmt.Sprint(p.Levels[level]))
+	}
+
+	days := fmt.Sprint(p.DefaultDays)
+	if len(args) > 0 {
+		days = "multiIf(" + strings.Join(append(args, days), ", ") + ")"
+	}
+	return "timestamp + toIntervalDay(" + days + ")"
+}
+
+// Apply sets the table TTL and records the policy when it changed since the
+// last application. Run it under the migration lock.
+func (p *RetentionPolicy) Apply(ctx context.Context, db *sql.DB, owner string) (bool, error) {
+	expr := p.TTLExpression()
+
+	var current string
+	err := db.QueryRowContext(ctx,
+		`SELECT ttl_expression FROM retention_policies ORDER BY applied_at DESC LIMIT 1`).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("read retention policy: %w", err)
+	}
+	if current == expr {
+		return false, nil
+	}
+
+	if _, err := db.ExecContext(ctx, "ALTER TABLE logs MODIFY TTL "+expr); err != nil {
+		return false, fmt.Errorf("modify TTL: %w", err)
+	}
+
+	policy, err := json.Marshal(p)
+	if err != nil {
+		return false, err
+	}
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO retention_policies (applied_by, policy, ttl_expression) VALUES (?, ?, ?)`,
+		owner, string(policy), expr); err != nil {
+		return false, fmt.Errorf("record retention policy: %w", err)
+	}
+	return true, nil
+}
+
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
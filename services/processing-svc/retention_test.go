@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRetentionTTLExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected string
+	}{
+		{
+			name:     "default only",
+			policy:   RetentionPolicy{DefaultDays: 30},
+			expected: "timestamp + toIntervalDay(30)",
+		},
+		{
+			name: "levels and overrides",
+			policy: RetentionPolicy{
+				DefaultDays: 14,
+				Levels:      map[string]int{"error": 90, "debug": 3},
+				Overrides: []RetentionOverride{
+					{Service: "payment-api", Level: "error", Days: 365},
+					{Tenant: "o'neil", Days: 7},
+				},
+			},
+			expected: "timestamp + toIntervalDay(multiIf(" +
+				"service = 'payment-api' AND level = 'error', 365, " +
+				`attributes['tenant'] = 'o\'neil', 7, ` +
+				"level = 'debug', 3, level = 'error', 90, 14))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.TTLExpression(); got != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLogLevelsMatchMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	// The last definition of the level column is the one in effect
+	var enum string
+	for _, m := range migrations {
+		for _, stmt := range m.Statements {
+			if i := strings.Index(stmt, "level Enum8("); i >= 0 {
+				enum = stmt[i:]
+			}
+		}
+	}
+	levels := regexp.MustCompile(`'(\w+)'\s*=`).FindAllStringSubmatch(enum, -1)
+	if len(levels) != len(logLevels) {
+		t.Fatalf("expected %d levels in the migrations, got %q", len(logLevels), levels)
+	}
+	for _, m := range levels {
+		if !logLevels[m[1]] {
+			t.Errorf("level %q of the migrations is missing from logLevels", m[1])
+		}
+	}
+}
+
+func TestLoadRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	policy, err := LoadRetentionPolicy(write("ok.json", `{"default_days": 14, "levels": {"debug": 3}}`))
+	if err != nil {
+		t.Fatalf("LoadRetentionPolicy failed: %v", err)
+	}
+	if policy.DefaultDays != 14 || policy.Levels["debug"] != 3 {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	invalid := []string{
+		`{"levels": {"debug": 3}}`,
+		`{"default_days": 14, "levels": {"debug": 0}}`,
+		`{"default_days": 14, "overrides": [{"days": 5}]}`,
+		`{"default_days": 14, "overrides": [{"service": "x", "days": -1}]}`,
+		`{"default_days": 14, "levels": {"degub": 3}}`,
+		`{"default_days": 14, "overrides": [{"level": "Error", "days": 5}]}`,
+	}
+	for i, data := range invalid {
+		if _, err := LoadRetentionPolicy(write("bad.json", data)); err == nil {
+			t.Errorf("policy %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// SampleAction defines what happens to entries matching a sampling rule
+type SampleAction string
+
+const (
+	SampleDrop SampleAction = "drop"   // drop every matching entry
+	SampleKeep SampleAction = "sample" // keep a fraction of matching entries
+)
+
+// SampleRule selects entries by level, service and message and either drops
+// them or keeps a fraction. With an empty key the decision is random,
+// otherwise it is a hash of the key fields so equal keys are always kept
+// or dropped together.
+type SampleRule struct {
+	Name    string       `json:"name"`
+	Levels  []string     `json:"levels,omitempty"`  // any of these levels
+	Service string       `json:"service,omitempty"` // regex on service
+	Message string       `json:"message,omitempty"` // regex on message
+	Action  SampleAction `json:"action"`
+	Rate    float64      `json:"rate,omitempty"` // fraction kept by "sample", e.g. 0.01 keeps 1 in 100
+	Key     []string     `json:"key,omitempty"`  // fields hashed for deterministic sampling
+}
+
+// SampleCounts holds per-rule decision counters
+type SampleCounts struct {
+	Kept    uint64 `json:"kept"`
+	Dropped uint64 `json:"dropped"`
+}
+
+type compiledSampleRule struct {
+	SampleRule
+	levels    map[string]bool
+	service   *regexp.Regexp
+	message   *regexp.Regexp
+	threshold uint64
+
+	kept    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// Sampler evaluates drop and sampling rules; the first matching rule wins
+type Sampler struct {
+	rules []*compiledSampleRule
+}
+
+// LoadSampleRules reads a JSON array of rules from path
+func LoadSampleRules(path string) ([]SampleRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []SampleRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func NewSampler(rules []SampleRule) (*Sampler, error) {
+	s := &Sampler{}
+
+	// Counters are reported by name, so names must be unique
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		cr := &compiledSampleRule{SampleRule: rule}
+		switch rule.Action {
+		case SampleDrop:
+		case SampleKeep:
+			// A missing rate reads as 0, which would drop everything
+			if rule.Rate <= 0 || rule.Rate > 1 {
+				return nil, fmt.Errorf("rule %q: rate must be greater than 0 and at most 1, use drop to discard every entry", rule.Name)
+			}
+			cr.threshold = uint64(rule.Rate * float64(1<<32))
+		default:
+			return nil, fmt.Errorf("rule %q: invalid action %q", rule.Name, rule.Action)
+		}
+
+		for _, field := range rule.Key {
+			if field != "level" && field != "service" && field != "message" {
+				return nil, fmt.Errorf("rule %q: unsupported key field %q", rule.Name, field)
+			}
+		}
+
+		if len(rule.Levels) > 0 {
+			cr.levels = make(map[string]bool, len(rule.Levels))
+			for _, level := range rule.Levels {
+				cr.levels[level] = true
+			}
+		}
+
+		var err error
+		if rule.Service != "" {
+			if cr.service, err = regexp.Compile(rule.Service); err != nil {
+				return nil, fmt.Errorf("rule %q: service: %w", rule.Name, err)
+			}
+		}
+		if rule.Message != "" {
+			if cr.message, err = regexp.Compile(rule.Message); err != nil {
+				return nil, fmt.Errorf("rule %q: message: %w", rule.Name, err)
+			}
+		}
+
+		s.rules = append(s.rules, cr)
+	}
+
+	return s, nil
+}
+
+// Keep reports whether the entry should be stored
+func (s *Sampler) Keep(entry *models.LogEntry) bool {
+	for _, rule := range s.rules {
+		if !rule.matches(entry) {
+			continue
+		}
+		if rule.decide(entry) {
+			rule.kept.Add(1)
+			return true
+		}
+		rule.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+func (r *compiledSampleRule) matches(entry *models.LogEntry) bool {
+	if r.levels != nil && !r.levels[entry.Level] {
+		return false
+	}
+	if r.service != nil && !r.service.MatchString(entry.Service) {
+		return false
+	}
+	if r.message != nil && !r.message.MatchString(entry.Message) {
+		return false
+	}
+	return true
+}
+
+func (r *compiledSampleRule) decide(entry *models.LogEntry) bool {
+	if r.Action == SampleDrop {
+		return false
+	}
+	if len(r.Key) == 0 {
+		return rand.Float64() < r.Rate
+	}
+
+	h := fnv.New64a()
+	for _, field := range r.Key {
+		switch field {
+		case "level":
+			h.Write([]byte(entry.Level))
+		case "service":
+			h.Write([]byte(entry.Service))
+		case "message":
+			h.Write([]byte(entry.Message))
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum64()&(1<<32-1) < r.threshold
+}
+
+// Counts returns a snapshot of kept and dropped entries per rule
+func (s *Sampler) Counts() map[string]SampleCounts {
+	counts := make(map[string]SampleCounts, len(s.rules))
+	for _, rule := range s.rules {
+		counts[rule.Name] = SampleCounts{Kept: rule.kept.Load(), Dropped: rule.dropped.Load()}
+	}
+	return counts
+}
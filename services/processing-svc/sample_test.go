@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestSamplerDropRule(t *testing.T) {
+	sampler, err := NewSampler([]SampleRule{
+		{Name: "no-health", Service: "^gateway$", Message: "health check", Action: SampleDrop},
+	})
+	if err != nil {
+		t.Fatalf("NewSampler failed: %v", err)
+	}
+
+	tests := []struct {
+		entry models.LogEntry
+		keep  bool
+	}{
+		{models.LogEntry{Level: "info", Service: "gateway", Message: "GET /health check ok"}, false},
+		{models.LogEntry{Level: "info", Service: "gateway", Message: "GET /orders"}, true},
+		{models.LogEntry{Level: "info", Service: "gateway-2", Message: "health check"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := sampler.Keep(&tt.entry); got != tt.keep {
+			t.Errorf("Keep(%+v) = %v, expected %v", tt.entry, got, tt.keep)
+		}
+	}
+
+	counts := sampler.Counts()["no-health"]
+	if counts.Dropped != 1 || counts.Kept != 0 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+}
+
+func TestSamplerDeterministicSampling(t *testing.T) {
+	sampler, err := NewSampler([]SampleRule{
+		{Name: "debug-x", Levels: []string{"debug"}, Service: "^x$", Action: SampleKeep, Rate: 0.01, Key: []string{"message"}},
+	})
+	if err != nil {
+		t.Fatalf("NewSampler failed: %v", err)
+	}
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		entry := models.LogEntry{Level: "debug", Service: "x", Message: fmt.Sprintf("request %d", i)}
+		first := sampler.Keep(&entry)
+		if second := sampler.Keep(&entry); first != second {
+			t.Fatalf("decision for %q is not deterministic", entry.Message)
+		}
+		if first {
+			kept++
+		}
+	}
+
+	// 1% of 10000 keys, with generous tolerance for hash distribution
+	if kept < 50 || kept > 150 {
+		t.Errorf("expected about 100 kept keys, got %d", kept)
+	}
+
+	counts := sampler.Counts()["debug-x"]
+	if counts.Kept+counts.Dropped != 20000 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+
+	other := models.LogEntry{Level: "info", Service: "x", Message: "request 1"}
+	if !sampler.Keep(&other) {
+		t.Error("entries not matching any rule must be kept")
+	}
+}
+
+func TestNewSamplerValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule SampleRule
+	}{
+		{"missing name", SampleRule{Action: SampleDrop}},
+		{"bad action", SampleRule{Name: "x", Action: "skip"}},
+		{"bad rate", SampleRule{Name: "x", Action: SampleKeep, Rate: 2}},
+		{"missing rate", SampleRule{Name: "x", Action: SampleKeep}},
+		{"negative rate", SampleRule{Name: "x", Action: SampleKeep, Rate: -0.5}},
+		{"bad key", SampleRule{Name: "x", Action: SampleKeep, Rate: 0.5, Key: []string{"host"}}},
+		{"bad regex", SampleRule{Name: "x", Action: SampleDrop, Message: "("}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSampler([]SampleRule{tt.rule}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	duplicate := []SampleRule{{Name: "x", Action: SampleDrop}, {Name: "x", Action: SampleKeep, Rate: 0.5}}
+	if _, err := NewSampler(duplicate); err == nil {
+		t.Error("expected an error for duplicate rule names")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	streamName      = "LOGS"
+	streamSubject   = "logs.raw"
+	liveSubject     = "logs.live"
+	consumerName    = "processing-group"
+	streamMaxAge    = 24 * time.Hour
+	ackWait         = 2 * time.Minute
+	maxAckPending   = 20000
+	fetchBatch      = 100
+	fetchWait       = time.Second
+	maxDeliver      = 10
+	redeliveryDelay = 5 * time.Second
+)
+
+// StreamConfig describes the JetStream stream entries are consumed from and
+// the durable pull consumer shared by all processing replicas
+type StreamConfig struct {
+	Stream        string
+	Consumer      string
+	MaxAge        time.Duration
+	AckWait       time.Duration
+	MaxAckPending int
+}
+
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		Stream:        streamName,
+		Consumer:      consumerName,
+		MaxAge:        streamMaxAge,
+		AckWait:       ackWait,
+		MaxAckPending: maxAckPending,
+	}
+}
+
+// LoadStreamConfig reads JETSTREAM_STREAM, JETSTREAM_CONSUMER,
+// JETSTREAM_MAX_AGE, JETSTREAM_ACK_WAIT and JETSTREAM_MAX_ACK_PENDING
+func LoadStreamConfig(getenv func(string) string) (StreamConfig, error) {
+	cfg := DefaultStreamConfig()
+	if v := getenv("JETSTREAM_STREAM"); v != "" {
+		cfg.Stream = v
+	}
+	if v := getenv("JETSTREAM_CONSUMER"); v != "" {
+		cfg.Consumer = v
+	}
+
+	durations := []struct {
+		name string
+		dest *time.Duration
+	}{
+		{"JETSTREAM_MAX_AGE", &cfg.MaxAge},
+		{"JETSTREAM_ACK_WAIT", &cfg.AckWait},
+	}
+	for _, v := range durations {
+		raw := getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+		}
+		*v.dest = d
+	}
+
+	if raw := getenv("JETSTREAM_MAX_ACK_PENDING"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid JETSTREAM_MAX_ACK_PENDING %q", raw)
+		}
+		cfg.MaxAckPending = n
+	}
+	return cfg, nil
+}
+
+// EnsureStream creates the stream and durable consumer, or updates them to
+// cfg. ingestion-api publishes to logs.raw through JetStream and waits for the
+// stream to acknowledge each entry; the stream keeps them until a replica has
+// stored and acknowledged them.
+func EnsureStream(js nats.JetStreamContext, cfg StreamConfig) error {
+	stream := &nats.StreamConfig{
+		Name:      cfg.Stream,
+		Subjects:  []string{streamSubject},
+		Retention: nats.WorkQueuePolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    cfg.MaxAge,
+	}
+	if _, err := js.StreamInfo(cfg.Stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(stream)
+		if err != nil {
+			return fmt.Errorf("create stream: %w", err)
+		}
+	} else if err != nil {
+		return err
+	} else if _, err := js.UpdateStream(stream); err != nil {
+		return fmt.Errorf("update stream: %w", err)
+	}
+
+	consumer := &nats.ConsumerConfig{
+		Durable:       cfg.Consumer,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxAckPending: cfg.MaxAckPending,
+		MaxDeliver:    maxDeliver,
+	}
+	if _, err := js.ConsumerInfo(cfg.Stream, cfg.Consumer); errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(cfg.Stream, consumer)
+		if err != nil {
+			return fmt.Errorf("create consumer: %w", err)
+		}
+	} else if err != nil {
+		return err
+	} else if _, err := js.UpdateConsumer(cfg.Stream, consumer); err != nil {
+		return fmt.Errorf("update consumer: %w", err)
+	}
+	return nil
+}
+
+// Consume fetches messages from the bound pull subscription and passes them
+// to handle until ctx is cancelled. Fetching only as fast as handle returns
+// lets batch backpressure reach the stream.
+func Consume(ctx context.Context, sub *nats.Subscription, handle func(*nats.Msg)) {
+	for ctx.Err() == nil {
+		msgs, err := sub.Fetch(fetchBatch, nats.MaxWait(fetchWait))
+		if err != nil && !errors.Is(err, nats.ErrTimeout) {
+			if ctx.Err() != nil || errors.Is(err, nats.ErrBadSubscription) || errors.Is(err, nats.ErrConnectionClosed) {
+				return
+			}
+			log.Printf("Fetch from stream failed: %v", err)
+			time.Sleep(fetchWait)
+			continue
+		}
+		for _, msg := range msgs {
+			handle(msg)
+		}
+	}
+}
+
+// Delivery is the stream message an entry was read from. It is acknowledged
+// once the entry is stored, so unstored entries are redelivered.
+type Delivery struct {
+	Seq uint64
+	msg *nats.Msg
+}
+
+func NewDelivery(msg *nats.Msg) Delivery {
+	d := Delivery{msg: msg}
+	if meta, err := msg.Metadata(); err == nil {
+		d.Seq = meta.Sequence.Stream
+	}
+	return d
+}
+
+// Ack marks the message as processed, whether stored or intentionally dropped
+func (d Delivery) Ack() {
+	if d.msg != nil {
+		d.msg.Ack()
+	}
+}
+
+// Nak asks for redelivery after a delay
+func (d Delivery) Nak() {
+	if d.msg != nil {
+		d.msg.NakWithDelay(redeliveryDelay)
+	}
+}
+
+// Term stops redelivery of a message that can never be processed
+func (d Delivery) Term() {
+	if d.msg != nil {
+		d.msg.Term()
+	}
+}
+
+// batchID derives a deterministic batch identifier from the stream sequence
+// numbers of its entries. The same messages give the same ID in any order,
+// so retries of a batch share one ClickHouse insert_deduplication_token.
+// Batches without sequence numbers get no ID.
+func batchID(deliveries []Delivery) string {
+	seqs := make([]uint64, 0, len(deliveries))
+	for _, d := range deliveries {
+		if d.Seq != 0 {
+			seqs = append(seqs, d.Seq)
+		}
+	}
+	if len(seqs) == 0 {
+		return ""
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	h := sha256.New()
+	var buf [8]byte
+	for _, seq := range seqs {
+		binary.BigEndian.PutUint64(buf[:], seq)
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// livePublisher is the part of a NATS connection publishLive uses
+type livePublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// publishLive sends an entry that went through enrichment and redaction to
+// liveSubject, which feeds the live tail of query-api and the streaming rules
+// of alerting-svc, so neither sees what redaction masks. The feed is plain
+// NATS and best effort: failures are logged and the entry is still stored.
+func publishLive(nc livePublisher, entry *models.LogEntry) {
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = nc.Publish(liveSubject, data)
+	}
+	if err != nil {
+		log.Printf("Failed to publish entry %s to %s: %v", entry.ID, liveSubject, err)
+	}
+}
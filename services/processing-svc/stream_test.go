@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestBatchID(t *testing.T) {
+	a := batchID([]Delivery{{Seq: 3}, {Seq: 1}, {Seq: 2}})
+	b := batchID([]Delivery{{Seq: 1}, {Seq: 2}, {Seq: 3}})
+	if a == "" || a != b {
+		t.Errorf("expected the same ID regardless of order, got %q and %q", a, b)
+	}
+	if len(a) != 32 {
+		t.Errorf("expected 32 hex characters, got %q", a)
+	}
+	if c := batchID([]Delivery{{Seq: 1}, {Seq: 2}, {Seq: 4}}); c == a {
+		t.Error("expected different sequences to give a different ID")
+	}
+	if id := batchID([]Delivery{{}, {}}); id != "" {
+		t.Errorf("expected no ID without sequence numbers, got %q", id)
+	}
+}
+
+func TestLoadStreamConfig(t *testing.T) {
+	env := map[string]string{"JETSTREAM_ACK_WAIT": "30s", "JETSTREAM_MAX_ACK_PENDING": "500"}
+	cfg, err := LoadStreamConfig(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("LoadStreamConfig failed: %v", err)
+	}
+	if cfg.Stream != streamName || cfg.Consumer != consumerName || cfg.AckWait != 30*time.Second || cfg.MaxAckPending != 500 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	for _, bad := range []map[string]string{
+		{"JETSTREAM_ACK_WAIT": "soon"},
+		{"JETSTREAM_MAX_AGE": "-1h"},
+		{"JETSTREAM_MAX_ACK_PENDING": "0"},
+	} {
+		if _, err := LoadStreamConfig(func(k string) string { return bad[k] }); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+// commitThenFail stores the first batch but reports a timeout, like an
+// insert whose response was lost after ClickHouse committed it
+type commitThenFail struct {
+	store  *logstore.MemoryStore
+	tokens []string
+}
+
+func (w *commitThenFail) WriteBatch(ctx context.Context, entries []models.LogEntry) error {
+	w.tokens = append(w.tokens, logstore.InsertToken(ctx))
+	if err := w.store.WriteBatch(ctx, entries); err != nil {
+		return err
+	}
+	if len(w.tokens) == 1 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestBatchProcessorRetryIsIdempotent(t *testing.T) {
+	writer := &commitThenFail{store: logstore.NewMemoryStore()}
+	cfg := DefaultBatchConfig()
+	cfg.Size, cfg.MinSize, cfg.Workers, cfg.FlushTimeout = 2, 2, 1, time.Hour
+	bp := NewBatchProcessor(writer, "test", cfg)
+
+	entry := models.LogEntry{Timestamp: time.Now(), Level: "info", Message: "m", Service: "svc"}
+	bp.AddEntry(entry, Delivery{Seq: 41})
+	bp.AddEntry(entry, Delivery{Seq: 42})
+	bp.Stop()
+
+	if len(writer.tokens) != 2 || writer.tokens[0] == "" || writer.tokens[0] != writer.tokens[1] {
+		t.Fatalf("expected both attempts to carry the same token, got %q", writer.tokens)
+	}
+	if writer.tokens[0] != batchID([]Delivery{{Seq: 41}, {Seq: 42}}) {
+		t.Errorf("expected the token to be the batch ID, got %q", writer.tokens[0])
+	}
+	if got := len(writer.store.Entries()); got != 2 {
+		t.Errorf("expected the retried batch to be stored once, got %d entries", got)
+	}
+	if stats := bp.Stats(); stats.Inserted != 2 || stats.Failed != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestBatchProcessorSkipsRedeliveredIDs(t *testing.T) {
+	store := logstore.NewMemoryStore()
+	cfg := DefaultBatchConfig()
+	cfg.Size, cfg.MinSize, cfg.Workers, cfg.FlushTimeout = 2, 2, 1, time.Hour
+	bp := NewBatchProcessor(store, "test", cfg)
+
+	entry := func(id string) models.LogEntry {
+		return models.LogEntry{ID: id, Timestamp: time.Now(), Level: "info", Message: id, Service: "svc"}
+	}
+	// b is redelivered after its ack was lost, next to a message it was not
+	// batched with, so the batch ID and its insert token differ
+	bp.AddEntry(entry("a"), Delivery{Seq: 1})
+	bp.AddEntry(entry("b"), Delivery{Seq: 2})
+	bp.AddEntry(entry("b"), Delivery{Seq: 2})
+	bp.AddEntry(entry("c"), Delivery{Seq: 3})
+	bp.Stop()
+
+	seen := make(map[string]int)
+	for _, e := range store.Entries() {
+		seen[e.ID]++
+	}
+	if len(seen) != 3 || seen["a"] != 1 || seen["b"] != 1 || seen["c"] != 1 {
+		t.Errorf("expected a, b and c stored once, got %v", seen)
+	}
+	if stats := bp.Stats(); stats.Skipped != 1 {
+		t.Errorf("expected one skipped entry, got %+v", stats)
+	}
+}
+
+func TestDeliveryWithoutMessage(t *testing.T) {
+	// Entries added outside the stream, e.g. in tests, have nothing to acknowledge
+	d := Delivery{}
+	d.Ack()
+	d.Nak()
+	d.Term()
+}
+
+// fakeLive records what publishLive sends, failing when err is set
+type fakeLive struct {
+	subjects []string
+	data     [][]byte
+	err      error
+}
+
+func (p *fakeLive) Publish(subject string, data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.subjects = append(p.subjects, subject)
+	p.data = append(p.data, data)
+	return nil
+}
+
+func TestPublishLiveIsRedacted(t *testing.T) {
+	redactor, err := NewRedactor(DefaultRedactRules(), nil)
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+	entry := models.LogEntry{ID: "e1", Level: "info", Service: "svc", Message: "user john.doe@example.com logged in"}
+	redactor.Redact(&entry)
+
+	pub := &fakeLive{}
+	publishLive(pub, &entry)
+	if len(pub.subjects) != 1 || pub.subjects[0] != liveSubject {
+		t.Fatalf("expected one message on %s, got %v", liveSubject, pub.subjects)
+	}
+	var published models.LogEntry
+	if err := json.Unmarshal(pub.data[0], &published); err != nil {
+		t.Fatalf("Failed to decode live entry: %v", err)
+	}
+	if published.ID != "e1" || strings.Contains(published.Message, "john.doe") {
+		t.Errorf("expected the redacted entry, got %+v", published)
+	}
+
+	// The live feed is best effort
+	publishLive(&fakeLive{err: errors.New("disconnected")}, &entry)
+}
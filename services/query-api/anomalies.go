@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/oglogstream-anomaly"
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+const (
+	defaultAnomalyStep      = time.Hour
+	defaultAnomalyHistory   = 7 * 24 * time.Hour
+	defaultAnomalySeason    = 24 * time.Hour
+	defaultAnomalyThreshold = 3
+	maxAnomalyPoints        = 7 * 24 * 60
+)
+
+// Anomaly is a (service, level) series whose last step is far from its
+// baseline
+type Anomaly struct {
+	Service string `json:"service"`
+	Level   string `json:"level"`
+	anomaly.Score
+}
+
+// AnomalyReport lists the anomalies of the last complete step
+type AnomalyReport struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Step      string         `json:"step"`
+	Method    anomaly.Method `json:"method"`
+	Threshold float64        `json:"threshold"`
+	Series    int            `json:"series"` // series scored
+	Anomalies []Anomaly      `json:"anomalies"`
+}
+
+// anomalyQuery selects the series of /api/anomalies and how they are scored
+type anomalyQuery struct {
+	Level, Service string
+	Step, History  time.Duration
+	Config         anomaly.Config
+	Threshold      float64
+}
+
+func parseAnomalyParams(params url.Values) (anomalyQuery, error) {
+	q := anomalyQuery{Level: params.Get("level"), Service: params.Get("service"), Threshold: defaultAnomalyThreshold}
+	duration := func(name string, def time.Duration) (time.Duration, error) {
+		v := params.Get(name)
+		if v == "" {
+			return def, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid %s, expected a duration such as 1h", name)
+		}
+		return d, nil
+	}
+
+	var err error
+	if q.Step, err = duration("step", defaultAnomalyStep); err != nil {
+		return q, err
+	}
+	// Steps dividing a day start at the same times in ClickHouse and Go
+	if q.Step%time.Minute != 0 || (24*time.Hour)%q.Step != 0 {
+		return q, fmt.Errorf("step must be whole minutes dividing a day, such as 5m or 1h")
+	}
+	if q.History, err = duration("history", defaultAnomalyHistory); err != nil {
+		return q, err
+	}
+	if q.History%q.Step != 0 || q.History/q.Step > maxAnomalyPoints {
+		return q, fmt.Errorf("history must be a multiple of step, of at most %d steps", maxAnomalyPoints)
+	}
+
+	q.Config.Method = anomaly.Method(params.Get("method"))
+	if v := params.Get("alpha"); v != "" {
+		if q.Config.Alpha, err = strconv.ParseFloat(v, 64); err != nil {
+			return q, fmt.Errorf("invalid alpha: %v", err)
+		}
+	}
+	if q.Config.Method == anomaly.MethodSeasonal {
+		season, err := duration("season", defaultAnomalySeason)
+		if err != nil {
+			return q, err
+		}
+		if season%q.Step != 0 {
+			return q, fmt.Errorf("season must be a multiple of step")
+		}
+		q.Config.Season = int(season / q.Step)
+	}
+	if err := q.Config.Validate(); err != nil {
+		return q, err
+	}
+	if int(q.History/q.Step)+1 < q.Config.MinPoints() {
+		return q, fmt.Errorf("history too short, the baseline needs %d steps", q.Config.MinPoints()-1)
+	}
+
+	if v := params.Get("threshold"); v != "" {
+		if q.Threshold, err = strconv.ParseFloat(v, 64); err != nil || q.Threshold <= 0 {
+			return q, fmt.Errorf("invalid threshold, expected a positive score")
+		}
+	}
+	return q, nil
+}
+
+// anomaliesHandler scores the last complete step of every (service, level)
+// series against a baseline of the steps before it, and lists those scoring
+// at least ?threshold= either way, the furthest first. ?level= and
+// ?service= narrow the series as in /api/logs.
+func anomaliesHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAnomalyParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		end := time.Now().UTC().Truncate(q.Step)
+		points := int(q.History/q.Step) + 1
+		start := end.Add(-time.Duration(points) * q.Step)
+		buckets, err := store.Aggregate(r.Context(), logstore.AggregateQuery{
+			Query:    logstore.Query{Level: q.Level, Service: q.Service, From: start, To: end},
+			GroupBy:  []string{"service", "level"},
+			Interval: q.Step,
+		})
+		if err != nil {
+			dbError(w, r, "anomalies", err)
+			return
+		}
+
+		type key struct{ service, level string }
+		series := make(map[key]*anomaly.Series)
+		for _, b := range buckets {
+			k := key{b.Keys["service"], b.Keys["level"]}
+			s, ok := series[k]
+			if !ok {
+				s = anomaly.NewSeries(start, q.Step, points)
+				series[k] = s
+			}
+			s.Add(b.Time, float64(b.Count))
+		}
+
+		report := AnomalyReport{
+			From: end.Add(-q.Step), To: end, Step: q.Step.String(), Method: q.Config.Method,
+			Threshold: q.Threshold, Series: len(series), Anomalies: []Anomaly{},
+		}
+		for k, s := range series {
+			if score, ok := anomaly.Detect(s.Values, q.Config); ok && math.Abs(score.Score) >= q.Threshold {
+				report.Anomalies = append(report.Anomalies, Anomaly{Service: k.service, Level: k.level, Score: score})
+			}
+		}
+		sort.Slice(report.Anomalies, func(i, j int) bool {
+			return math.Abs(report.Anomalies[i].Score.Score) > math.Abs(report.Anomalies[j].Score.Score)
+		})
+		writeJSON(w, http.StatusOK, report)
+	}
+}
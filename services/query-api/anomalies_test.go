@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestAnomaliesEndpoint(t *testing.T) {
+	// Eight steady hours, then a spike in web errors and a drop in api volume
+	store := logstore.NewMemoryStore()
+	end := time.Now().UTC().Truncate(time.Hour)
+	for i := 1; i <= 9; i++ {
+		at := end.Add(-time.Duration(i)*time.Hour + time.Minute)
+		web, api := 10+i%3, 100+i%5
+		if i == 1 {
+			web, api = 80, 5
+		}
+		store.WriteBatch(context.Background(), []models.LogEntry{
+			{Timestamp: at, Level: "error", Message: "boom", Service: "web", RepeatCount: uint32(web)},
+			{Timestamp: at, Level: "info", Message: "ok", Service: "api", RepeatCount: uint32(api)},
+			{Timestamp: at, Level: "info", Message: "ok", Service: "worker", RepeatCount: 20},
+		})
+	}
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expected       []string // services, furthest first
+	}{
+		{"spike and drop", "/api/anomalies?history=8h", http.StatusOK, []string{"web", "api"}},
+		{"filtered", "/api/anomalies?history=8h&level=info", http.StatusOK, []string{"api"}},
+		{"high threshold", "/api/anomalies?history=8h&threshold=100", http.StatusOK, []string{}},
+		{"seasonal", "/api/anomalies?history=8h&method=seasonal&season=2h", http.StatusOK, []string{"web", "api"}},
+		{"history too short", "/api/anomalies?history=4h", http.StatusBadRequest, nil},
+		{"step not dividing a day", "/api/anomalies?step=7m", http.StatusBadRequest, nil},
+		{"history not whole steps", "/api/anomalies?history=90m", http.StatusBadRequest, nil},
+		{"too many points", "/api/anomalies?step=1m&history=30d", http.StatusBadRequest, nil},
+		{"season not whole steps", "/api/anomalies?method=seasonal&season=90m", http.StatusBadRequest, nil},
+		{"bad method", "/api/anomalies?method=magic", http.StatusBadRequest, nil},
+		{"bad threshold", "/api/anomalies?threshold=-1", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var report AnomalyReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !report.To.Equal(end) || report.Step != "1h0m0s" {
+				t.Errorf("expected the hour ending at %v, got %+v", end, report)
+			}
+			if len(report.Anomalies) != len(tt.expected) {
+				t.Fatalf("expected anomalies in %v, got %+v", tt.expected, report.Anomalies)
+			}
+			for i, service := range tt.expected {
+				if report.Anomalies[i].Service != service {
+					t.Errorf("expected anomalies in %v, got %+v", tt.expected, report.Anomalies)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	exportBufferSize = 64 << 10
+	exportFlushRows  = 1000  // rows between flushes to the client
+	exportRowGroup   = 10000 // rows a Parquet export holds in memory at most
+)
+
+// errExportLimit stops an export once ?limit= rows are written
+var errExportLimit = errors.New("export limit reached")
+
+// exportEncoder writes entries in an export format. Flush passes on rows
+// the encoder buffers itself; Close writes anything the format keeps until
+// the end, such as the Parquet footer.
+type exportEncoder interface {
+	Encode(e *models.LogEntry) error
+	Flush() error
+	Close() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	newEncoder  func(io.Writer) exportEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"ndjson":  {"application/x-ndjson", "ndjson", newNDJSONEncoder},
+	"csv":     {"text/csv; charset=utf-8", "csv", newCSVEncoder},
+	"parquet": {"application/vnd.apache.parquet", "parquet", newParquetEncoder},
+}
+
+// exportHandler streams every entry matching the /api/logs filters and time
+// range, oldest first, as NDJSON, CSV or Parquet. Rows are encoded as they
+// are read and flushed in chunks; a client disconnecting cancels the query.
+func exportHandler(store logstore.LogStore, searches SearchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := resolveLogParams(w, r, searches)
+		if !ok {
+			return
+		}
+
+		name := params.Get("format")
+		if name == "" {
+			name = "ndjson"
+		}
+		format, ok := exportFormats[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid format %q, expected ndjson, csv or parquet", name), http.StatusBadRequest)
+			return
+		}
+		if params.Get("offset") != "" {
+			http.Error(w, "offset is not supported by exports", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseIntParam(params.Get("limit"), 0, math.MaxInt32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+		params.Del("format")
+		params.Del("limit")
+		q, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.From.IsZero() {
+			http.Error(w, "from is required", http.StatusBadRequest)
+			return
+		}
+		// Entries arriving during the export are left out
+		if q.To.IsZero() {
+			q.To = time.Now().UTC()
+		}
+
+		out := &sentWriter{w: w}
+		buf := bufio.NewWriterSize(out, exportBufferSize)
+		enc := format.newEncoder(buf)
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="logs-%s.%s"`,
+			q.From.UTC().Format("20060102T150405Z"), format.extension))
+
+		rows := 0
+		err = store.Export(r.Context(), q, func(e *models.LogEntry) error {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			rows++
+			if rows%exportFlushRows == 0 {
+				if err := enc.Flush(); err != nil {
+					return err
+				}
+				if err := buf.Flush(); err != nil {
+					return err
+				}
+				rc.Flush()
+			}
+			if rows == limit {
+				return errExportLimit
+			}
+			return nil
+		})
+		if errors.Is(err, errExportLimit) {
+			err = nil
+		}
+		if err == nil {
+			err = enc.Close()
+		}
+		if err == nil {
+			err = buf.Flush()
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(r.Context().Err(), context.Canceled):
+			log.Printf("Export cancelled by client after %d rows", rows)
+		case !out.sent:
+			w.Header().Del("Content-Disposition")
+			dbError(w, r, "export", err)
+		default:
+			// The status is gone; break the chunked stream so the client
+			// sees a failed download rather than a short file
+			log.Printf("Export failed after %d rows: %v", rows, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// sentWriter records whether anything reached the client, after which
+// errors can no longer be reported with a status code
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.w.Write(p)
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) exportEncoder {
+	return ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes the entry as /api/logs returns it
+func (n ndjsonEncoder) Encode(e *models.LogEntry) error {
+	return n.enc.Encode(toLogEntry(*e))
+}
+
+func (n ndjsonEncoder) Flush() error {
+	return nil
+}
+
+func (n ndjsonEncoder) Close() error {
+	return nil
+}
+
+var csvHeader = []string{"id", "timestamp", "level", "service", "message", "trace_id", "span_id",
+	"repeat_count", "first_seen", "last_seen", "attributes"}
+
+type csvEncoder struct {
+	w   *csv.Writer
+	err error // from writing the header
+}
+
+func newCSVEncoder(w io.Writer) exportEncoder {
+	c := &csvEncoder{w: csv.NewWriter(w)}
+	c.err = c.w.Write(csvHeader)
+	return c
+}
+
+// Encode writes one row; attributes are a JSON object
+func (c *csvEncoder) Encode(e *models.LogEntry) error {
+	if c.err != nil {
+		return c.err
+	}
+	row := exportRowOf(e)
+	var attributes string
+	if len(row.Attributes) > 0 {
+		data, err := json.Marshal(row.Attributes)
+		if err != nil {
+			return err
+		}
+		attributes = string(data)
+	}
+	c.w.Write([]string{
+		row.ID, row.Timestamp.Format(time.RFC3339), row.Level, row.Service, row.Message, row.TraceID, row.SpanID,
+		strconv.FormatUint(uint64(row.RepeatCount), 10), row.FirstSeen.Format(time.RFC3339), row.LastSeen.Format(time.RFC3339),
+		attributes,
+	})
+	return c.w.Error()
+}
+
+func (c *csvEncoder) Flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvEncoder) Close() error {
+	return c.Flush()
+}
+
+// exportRow is the Parquet schema of an export, also used to fill CSV rows
+type exportRow struct {
+	ID          string            `parquet:"id"`
+	Timestamp   time.Time         `parquet:"timestamp,timestamp(millisecond)"`
+	Level       string            `parquet:"level,dict"`
+	Service     string            `parquet:"service,dict"`
+	Message     string            `parquet:"message"`
+	TraceID     string            `parquet:"trace_id"`
+	SpanID      string            `parquet:"span_id"`
+	RepeatCount uint32            `parquet:"repeat_count"`
+	FirstSeen   time.Time         `parquet:"first_seen,timestamp(millisecond)"`
+	LastSeen    time.Time         `parquet:"last_seen,timestamp(millisecond)"`
+	Attributes  map[string]string `parquet:"attributes"`
+}
+
+// exportRowOf fills in burst fields of plain rows, as processing does on write
+func exportRowOf(e *models.LogEntry) exportRow {
+	row := exportRow{
+		ID: e.ID, Timestamp: e.Timestamp.UTC(), Level: e.Level, Service: e.Service, Message: e.Message,
+		TraceID: e.TraceID, SpanID: e.SpanID, RepeatCount: max(e.RepeatCount, 1),
+		FirstSeen: e.FirstSeen.UTC(), LastSeen: e.LastSeen.UTC(), Attributes: e.Attributes,
+	}
+	if e.FirstSeen.IsZero() {
+		row.FirstSeen = row.Timestamp
+	}
+	if e.LastSeen.IsZero() {
+		row.LastSeen = row.Timestamp
+	}
+	return row
+}
+
+type parquetEncoder struct {
+	w   *parquet.GenericWriter[exportRow]
+	row [1]exportRow
+}
+
+func newParquetEncoder(w io.Writer) exportEncoder {
+	return &parquetEncoder{w: parquet.NewGenericWriter[exportRow](w,
+		parquet.MaxRowsPerRowGroup(exportRowGroup),
+		parquet.Compression(&parquet.Zstd),
+	)}
+}
+
+func (p *parquetEncoder) Encode(e *models.LogEntry) error {
+	p.row[0] = exportRowOf(e)
+	_, err := p.w.Write(p.row[:])
+	return err
+}
+
+// Flush leaves rows to fill the row group; flushing early would only make
+// smaller row groups
+func (p *parquetEncoder) Flush() error {
+	return nil
+}
+
+func (p *parquetEncoder) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+const exportRange = "from=2025-07-24T00:00:00Z&to=2025-07-25T00:00:00Z"
+
+func TestExportFormats(t *testing.T) {
+	router := createTestRouter()
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", url, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	// NDJSON is the default, one /api/logs entry per line, oldest first
+	w := get("/api/export?" + exportRange)
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="logs-20250724T000000Z.ndjson"` {
+		t.Errorf("unexpected content disposition %q", cd)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", w.Body.String())
+	}
+	var first LogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Message != "User login successful" {
+		t.Errorf("expected the oldest entry first, got %+v (%v)", first, err)
+	}
+
+	// CSV starts with a header
+	w = get("/api/export?format=csv&level=error&" + exportRange)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("unexpected CSV: %v", records)
+	}
+	if row := records[1]; row[1] != "2025-07-24T16:01:00Z" || row[4] != "Payment failed" || row[7] != "1" {
+		t.Errorf("unexpected CSV row: %v", row)
+	}
+
+	// Parquet reads back with the export schema
+	w = get("/api/export?format=parquet&" + exportRange)
+	data := w.Body.Bytes()
+	rows, err := parquet.Read[exportRow](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid Parquet: %v", err)
+	}
+	if len(rows) != 3 || rows[2].Message != "High CPU usage" || !rows[2].LastSeen.Equal(rows[2].Timestamp) {
+		t.Errorf("unexpected Parquet rows: %+v", rows)
+	}
+}
+
+func TestExportParams(t *testing.T) {
+	router := newRouter(newTestStore(testLogs), NewMemorySearchStore(
+		SavedSearch{ID: "errors01", Name: "errors", Query: "level=error", From: "2025-07-24T00:00:00Z"},
+	), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedRows   int
+	}{
+		{"limit", "/api/export?limit=2&" + exportRange, http.StatusOK, 2},
+		{"beyond the /api/logs limit", "/api/export?limit=5000&" + exportRange, http.StatusOK, 3},
+		{"saved search", "/api/export?search=errors01", http.StatusOK, 1},
+		{"no from", "/api/export?level=error", http.StatusBadRequest, 0},
+		{"bad format", "/api/export?format=xml&" + exportRange, http.StatusBadRequest, 0},
+		{"offset", "/api/export?offset=10&" + exportRange, http.StatusBadRequest, 0},
+		{"bad limit", "/api/export?limit=-1&" + exportRange, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if n := strings.Count(w.Body.String(), "\n"); n != tt.expectedRows {
+				t.Errorf("expected %d rows, got %d", tt.expectedRows, n)
+			}
+		})
+	}
+}
+
+// failingStore fails an export after a number of entries
+type failingStore struct {
+	*logstore.MemoryStore
+	after int
+}
+
+func (s failingStore) Export(ctx context.Context, q logstore.Query, fn func(*models.LogEntry) error) error {
+	for i := 0; i < s.after; i++ {
+		if err := fn(&models.LogEntry{Timestamp: time.Now(), Level: "info", Message: fmt.Sprint(i), Service: "api"}); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection reset")
+}
+
+func TestExportErrors(t *testing.T) {
+	// Nothing sent yet: the error becomes a status
+	w := httptest.NewRecorder()
+	exportHandler(failingStore{after: 1}, NewMemorySearchStore())(w, httptest.NewRequest("GET", "/api/export?"+exportRange, nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("expected status 500 without an attachment, got %d", w.Code)
+	}
+
+	// Rows already flushed: the stream is aborted
+	w = httptest.NewRecorder()
+	func() {
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("expected the handler to abort, got %v", r)
+			}
+		}()
+		exportHandler(failingStore{after: exportFlushRows + 1}, NewMemorySearchStore())(w, httptest.NewRequest("GET", "/api/export?"+exportRange, nil))
+	}()
+	if !w.Flushed || strings.Count(w.Body.String(), "\n") != exportFlushRows {
+		t.Errorf("expected %d flushed rows", exportFlushRows)
+	}
+
+	// A client that went away stops the export quietly
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	exportHandler(newTestStore(testLogs), NewMemorySearchStore())(w, httptest.NewRequest("GET", "/api/export?"+exportRange, nil).WithContext(ctx))
+	if w.Body.Len() != 0 {
+		t.Errorf("expected nothing written for a cancelled request, got %q", w.Body.String())
+	}
+}
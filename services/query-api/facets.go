@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+const defaultFacetRange = 24 * time.Hour
+
+// facetsHandler returns the top values and counts of the fields in ?fields=,
+// a comma-separated list of level, service, trace_id and attributes.<key>.
+// ?k= caps the values per field (default 10, at most 100). It takes the
+// /api/logs filters, including ?search=, and covers the last 24 hours when
+// no range is given.
+func facetsHandler(store logstore.LogStore, searches SearchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := resolveLogParams(w, r, searches)
+		if !ok {
+			return
+		}
+		if params.Get("limit") != "" || params.Get("offset") != "" {
+			http.Error(w, "limit and offset are not supported, use k", http.StatusBadRequest)
+			return
+		}
+
+		query, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		k, err := parseIntParam(params.Get("k"), 1, logstore.MaxFacetValues)
+		if err != nil {
+			http.Error(w, "invalid k: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if query.From.IsZero() && query.To.IsZero() {
+			query.From = time.Now().UTC().Add(-defaultFacetRange)
+		}
+		query.Limit = k
+
+		q := logstore.FacetQuery{Query: query}
+		for _, field := range strings.Split(params.Get("fields"), ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				q.Fields = append(q.Fields, field)
+			}
+		}
+		if err := q.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		facets, err := store.Facets(r.Context(), q)
+		if err != nil {
+			dbError(w, r, "facets", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, facets)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestFacetsEndpoint(t *testing.T) {
+	ts := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	store := logstore.NewMemoryStore(
+		models.LogEntry{Timestamp: ts, Level: "error", Service: "payment-api", Attributes: map[string]string{"ingest_host": "ingest-1"}},
+		models.LogEntry{Timestamp: ts.Add(time.Minute), Level: "error", Service: "payment-api", Attributes: map[string]string{"ingest_host": "ingest-2"}},
+		models.LogEntry{Timestamp: ts.Add(2 * time.Minute), Level: "info", Service: "auth-service", Attributes: map[string]string{"ingest_host": "ingest-1"}},
+	)
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedValues []int // values per facet
+	}{
+		{"fields", "/api/facets?from=2025-07-24T00:00:00Z&fields=level,service,attributes.ingest_host", http.StatusOK, []int{2, 2, 2}},
+		{"filtered", "/api/facets?from=2025-07-24T00:00:00Z&level=error&fields=service", http.StatusOK, []int{1}},
+		{"k", "/api/facets?from=2025-07-24T00:00:00Z&fields=level&k=1", http.StatusOK, []int{1}},
+		{"last day by default", "/api/facets?fields=level", http.StatusOK, []int{0}},
+		{"no fields", "/api/facets", http.StatusBadRequest, nil},
+		{"unknown field", "/api/facets?fields=message", http.StatusBadRequest, nil},
+		{"bad k", "/api/facets?fields=level&k=500", http.StatusBadRequest, nil},
+		{"limit", "/api/facets?fields=level&limit=10", http.StatusBadRequest, nil},
+		{"unknown search", "/api/facets?fields=level&search=nope", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var facets []logstore.Facet
+			if err := json.NewDecoder(w.Body).Decode(&facets); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(facets) != len(tt.expectedValues) {
+				t.Fatalf("expected %d facets, got %+v", len(tt.expectedValues), facets)
+			}
+			for i, f := range facets {
+				if len(f.Values) != tt.expectedValues[i] {
+					t.Errorf("expected %d values for %s, got %+v", tt.expectedValues[i], f.Field, f.Values)
+				}
+			}
+		})
+	}
+}
+
+func TestFacetsEndpointCounts(t *testing.T) {
+	router := createTestRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/facets?from=2025-07-24T00:00:00Z&fields=service", nil))
+
+	var facets []logstore.Facet
+	if err := json.NewDecoder(w.Body).Decode(&facets); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(facets) != 1 || facets[0].Field != "service" || facets[0].Total != 3 || facets[0].Values[0].Count != 1 {
+		t.Errorf("unexpected facets: %+v", facets)
+	}
+}
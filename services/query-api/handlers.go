@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+// newRouter wires the HTTP API on top of a log store. Endpoints reading logs
+// run their queries within the limits of their class in config. Each of mounts
+// adds routes that share the query guard, and so the per-key budgets, of the
+// endpoints registered here.
+func newRouter(store logstore.LogStore, searches SearchStore, hub *Hub, config QueryConfig, mounts ...func(chi.Router, *queryGuard)) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(corsMiddleware)
+
+	// Health check endpoint
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok","service":"query-api"}`))
+	})
+
+	guard := newQueryGuard(config)
+	r.Group(func(r chi.Router) {
+		r.Use(guard.limit(ClassSearch))
+		r.Get("/api/logs", logsHandler(store, searches))
+		r.Get("/api/logs/tail", tailHandler(store))
+		r.Get("/api/logs/context", contextByTimeHandler(store))
+		r.Get("/api/logs/{id}", getLogHandler(store))
+		r.Get("/api/logs/{id}/context", contextByIDHandler(store))
+		r.Get("/api/traces/{traceID}", traceHandler(store))
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(guard.limit(ClassAggregate))
+		r.Get("/api/patterns", patternsHandler(store, searches))
+		r.Get("/api/facets", facetsHandler(store, searches))
+		r.Get("/api/anomalies", anomaliesHandler(store))
+		r.Get("/api/stats", statsHandler(store))
+		r.Get("/api/stats/timeseries", timeseriesHandler(store))
+	})
+	r.With(guard.limit(ClassExport)).Get("/api/export", exportHandler(store, searches))
+	r.Route("/api/searches", func(r chi.Router) { searchRoutes(r, searches) })
+	r.Get("/ws/live", liveHandler(hub))
+	for _, mount := range mounts {
+		mount(r, guard)
+	}
+
+	return r
+}
+
+// toLogEntry converts a stored entry to the API representation
+func toLogEntry(e models.LogEntry) LogEntry {
+	out := LogEntry{
+		ID:         e.ID,
+		Timestamp:  e.Timestamp.UTC().Format(time.RFC3339),
+		Level:      e.Level,
+		Message:    e.Message,
+		Service:    e.Service,
+		TraceID:    e.TraceID,
+		SpanID:     e.SpanID,
+		Attributes: e.Attributes,
+	}
+	// Plain rows carry no burst information
+	if e.RepeatCount > 1 {
+		out.RepeatCount = e.RepeatCount
+		out.FirstSeen = e.FirstSeen.UTC().Format(time.RFC3339)
+		out.LastSeen = e.LastSeen.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+func toLogEntries(entries []models.LogEntry) []LogEntry {
+	out := make([]LogEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, toLogEntry(e))
+	}
+	return out
+}
+
+// parseLogParams reads level, service, trace_id, from, to, limit and offset parameters
+func parseLogParams(params url.Values) (logstore.Query, error) {
+	q := logstore.Query{
+		Level:   params.Get("level"),
+		Service: params.Get("service"),
+		TraceID: strings.ToLower(params.Get("trace_id")),
+	}
+	if q.TraceID != "" && !isTraceID(q.TraceID) {
+		return q, fmt.Errorf("invalid trace_id, expected 32 hex characters")
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from: %v", err)
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to: %v", err)
+	}
+	if q.Limit, err = parseIntParam(params.Get("limit"), 0, logstore.MaxLimit); err != nil {
+		return q, fmt.Errorf("invalid limit: %v", err)
+	}
+	if q.Offset, err = parseIntParam(params.Get("offset"), 0, 1<<31-1); err != nil {
+		return q, fmt.Errorf("invalid offset: %v", err)
+	}
+	return q, nil
+}
+
+// resolveLogParams returns the request parameters on top of those of the
+// saved search named by ?search=, if any
+func resolveLogParams(w http.ResponseWriter, r *http.Request, searches SearchStore) (url.Values, bool) {
+	params := r.URL.Query()
+	id := params.Get("search")
+	if id == "" {
+		return params, true
+	}
+
+	search, err := searches.GetSearch(r.Context(), id)
+	if errors.Is(err, ErrSearchNotFound) {
+		http.Error(w, "saved search not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		dbError(w, r, "get search", err)
+		return nil, false
+	}
+	merged := search.params(time.Now())
+	for k, v := range params {
+		if k != "search" {
+			merged[k] = v
+		}
+	}
+	return merged, true
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func parseIntParam(v string, min, max int) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("must be between %d and %d", min, max)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// logsHandler searches entries. With ?search=, a saved search supplies the
+// filters and time range, and other parameters override it.
+func logsHandler(store logstore.LogStore, searches SearchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := resolveLogParams(w, r, searches)
+		if !ok {
+			return
+		}
+
+		q, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := store.Search(r.Context(), q)
+		if err != nil {
+			dbError(w, r, "logs", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toLogEntries(entries))
+	}
+}
+
+// getLogHandler returns a single entry by the ID assigned at ingestion
+func getLogHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := store.Get(r.Context(), id)
+		if errors.Is(err, logstore.ErrNotFound) {
+			http.Error(w, "log entry not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			dbError(w, r, "get log", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toLogEntry(entry))
+	}
+}
+
+// tailHandler returns entries newer than ?since=, oldest first, for polling clients
+func tailHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := parseTimeParam(r.URL.Query().Get("since"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+		if since.IsZero() {
+			since = time.Now().Add(-time.Minute)
+		}
+		limit, err := parseIntParam(r.URL.Query().Get("limit"), 0, logstore.MaxLimit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := store.Tail(r.Context(), since, limit)
+		if err != nil {
+			dbError(w, r, "tail", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toLogEntries(entries))
+	}
+}
+
+func liveHandler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			return
+		}
+
+		client := &Client{
+			hub:  hub,
+			conn: conn,
+			send: make(chan []byte, 256),
+		}
+
+		client.hub.register <- client
+
+		// Start goroutines for reading and writing
+		go client.writePump()
+		go client.readPump()
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestGetLogsQueryParams(t *testing.T) {
+	router := createTestRouter()
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expected       []string
+	}{
+		{"limit", "/api/logs?limit=1", http.StatusOK, []string{"High CPU usage"}},
+		{"offset", "/api/logs?limit=1&offset=2", http.StatusOK, []string{"User login successful"}},
+		{"time range", "/api/logs?from=2025-07-24T16:01:00Z&to=2025-07-24T16:02:00Z", http.StatusOK, []string{"Payment failed"}},
+		{"bad limit", "/api/logs?limit=5000", http.StatusBadRequest, nil},
+		{"bad from", "/api/logs?from=yesterday", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var logs []LogEntry
+			if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(logs) != len(tt.expected) {
+				t.Fatalf("expected %d logs, got %d", len(tt.expected), len(logs))
+			}
+			for i, l := range logs {
+				if l.Message != tt.expected[i] {
+					t.Errorf("log %d: expected %q, got %q", i, tt.expected[i], l.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLogsBurstFields(t *testing.T) {
+	ts := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	store := logstore.NewMemoryStore(
+		models.LogEntry{Timestamp: ts, Level: "fatal", Message: "panic", Service: "worker",
+			RepeatCount: 3, FirstSeen: ts, LastSeen: ts.Add(5 * time.Second)},
+		models.LogEntry{Timestamp: ts, Level: "info", Message: "ok", Service: "worker",
+			Attributes: map[string]string{"env": "prod"}},
+	)
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs", nil))
+
+	var logs []LogEntry
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, l := range logs {
+		switch l.Level {
+		case "fatal":
+			if l.RepeatCount != 3 || l.LastSeen != "2025-07-24T16:00:05Z" {
+				t.Errorf("unexpected burst fields: %+v", l)
+			}
+		case "info":
+			if l.RepeatCount != 0 || l.FirstSeen != "" || l.Attributes["env"] != "prod" {
+				t.Errorf("unexpected plain entry: %+v", l)
+			}
+		}
+	}
+}
+
+func TestTailEndpoint(t *testing.T) {
+	router := createTestRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs/tail?since=2025-07-24T16:00:00Z", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var logs []LogEntry
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Message != "Payment failed" || logs[1].Message != "High CPU usage" {
+		t.Errorf("expected entries after since in ascending order, got %+v", logs)
+	}
+}
+
+func TestGetLogByID(t *testing.T) {
+	const id = "0198a6b2-7c3e-7d4f-9a1b-2c3d4e5f6a7b"
+	store := logstore.NewMemoryStore(
+		models.LogEntry{ID: id, Timestamp: time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC), Level: "error", Message: "Payment failed", Service: "payment-api"},
+	)
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"found", "/api/logs/" + id, http.StatusOK},
+		{"unknown", "/api/logs/0198a6b2-7c3e-7d4f-9a1b-000000000000", http.StatusNotFound},
+		{"malformed", "/api/logs/42", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var entry LogEntry
+			if err := json.NewDecoder(w.Body).Decode(&entry); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if entry.ID != id || entry.Message != "Payment failed" {
+				t.Errorf("unexpected entry: %+v", entry)
+			}
+		})
+	}
+}
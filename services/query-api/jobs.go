@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	defaultJobMaxRows    = 1000000
+	defaultJobMaxRunning = 4
+	jobResultBatch       = 1000 // results written per insert
+	jobSaveTimeout       = 10 * time.Second
+
+	// codeQueryWasCancelled is the ClickHouse error of a killed query
+	codeQueryWasCancelled = 394
+)
+
+// JobStatus is the lifecycle state of a query job
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// JobQuery is the search a job runs
+type JobQuery struct {
+	Level   string    `json:"level,omitempty"`
+	Service string    `json:"service,omitempty"`
+	TraceID string    `json:"trace_id,omitempty"`
+	From    time.Time `json:"from,omitzero"`
+	To      time.Time `json:"to,omitzero"`
+	Limit   int       `json:"limit"`
+}
+
+func (q JobQuery) logQuery() logstore.Query {
+	return logstore.Query{Level: q.Level, Service: q.Service, TraceID: q.TraceID, From: q.From, To: q.To}
+}
+
+// Progress is how far a job's ClickHouse query has read
+type Progress struct {
+	RowsRead        uint64 `json:"rows_read"`
+	BytesRead       uint64 `json:"bytes_read"`
+	TotalRowsApprox uint64 `json:"total_rows_approx,omitempty"`
+	Elapsed         string `json:"elapsed,omitempty"`
+}
+
+// Job is a search running in the background. Results are kept in order,
+// oldest first, and can be paged through once the job has succeeded.
+type Job struct {
+	ID         string    `json:"id"`
+	Status     JobStatus `json:"status"`
+	Query      JobQuery  `json:"query"`
+	Rows       int       `json:"rows"` // results stored so far
+	Progress   Progress  `json:"progress"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// JobConfig bounds the jobs of one replica
+type JobConfig struct {
+	MaxRows    int         // results a job keeps at most
+	MaxRunning int         // jobs running at once on this replica
+	Limits     QueryLimits // applied to the query of each job
+}
+
+// LoadJobConfig reads JOB_MAX_ROWS and JOB_MAX_RUNNING, keeping defaults for
+// unset ones
+func LoadJobConfig(getenv func(string) string) (JobConfig, error) {
+	cfg := JobConfig{MaxRows: defaultJobMaxRows, MaxRunning: defaultJobMaxRunning}
+	for _, v := range []struct {
+		name string
+		dest *int
+	}{
+		{"JOB_MAX_ROWS", &cfg.MaxRows},
+		{"JOB_MAX_RUNNING", &cfg.MaxRunning},
+	} {
+		raw := getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+		}
+		*v.dest = n
+	}
+	return cfg, nil
+}
+
+// errTooManyJobs is returned by Submit when the replica is at MaxRunning
+var errTooManyJobs = errors.New("too many running jobs")
+
+// runningJob is a job this replica is running
+type runningJob struct {
+	cancel    context.CancelFunc
+	cancelled atomic.Bool
+	rows      atomic.Uint64 // rows read, from ClickHouse progress packets
+	bytes     atomic.Uint64
+	total     atomic.Uint64
+	started   time.Time
+}
+
+func (r *runningJob) progress() Progress {
+	return Progress{
+		RowsRead:        r.rows.Load(),
+		BytesRead:       r.bytes.Load(),
+		TotalRowsApprox: r.total.Load(),
+		Elapsed:         time.Since(r.started).Round(time.Millisecond).String(),
+	}
+}
+
+// JobManager runs query jobs and answers for jobs of every replica. Each job
+// runs its ClickHouse query with the job ID as query_id, so progress and
+// cancellation work from any replica.
+type JobManager struct {
+	logs   logstore.LogStore
+	jobs   JobStore
+	config JobConfig
+
+	mu       sync.Mutex
+	running  map[string]*runningJob
+	wg       sync.WaitGroup
+	stopping atomic.Bool // Stop ran out of time and cancels what is left
+}
+
+func NewJobManager(logs logstore.LogStore, jobs JobStore, config JobConfig) *JobManager {
+	return &JobManager{logs: logs, jobs: jobs, config: config, running: make(map[string]*runningJob)}
+}
+
+// Submit records a job and starts running it. Submitted through a guarded
+// request, the job keeps the request's slot in the budget of its API key
+// until it finishes.
+func (m *JobManager) Submit(ctx context.Context, q JobQuery) (Job, error) {
+	job := Job{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		Status:    JobRunning,
+		Query:     q,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	if len(m.running) >= m.config.MaxRunning {
+		m.mu.Unlock()
+		return job, errTooManyJobs
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	run := &runningJob{cancel: cancel, started: time.Now()}
+	m.running[job.ID] = run
+	m.mu.Unlock()
+
+	if err := m.jobs.SaveJob(ctx, job); err != nil {
+		m.finish(job.ID)
+		return job, err
+	}
+	release := keepQuerySlot(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer release()
+		m.run(runCtx, job, run)
+	}()
+	return job, nil
+}
+
+// run reads the job's entries and stores them as results in batches
+func (m *JobManager) run(ctx context.Context, job Job, run *runningJob) {
+	defer m.finish(job.ID)
+
+	queryCtx, cancelQuery := m.config.Limits.context(ctx)
+	defer cancelQuery()
+	queryCtx = clickhouse.Context(queryCtx,
+		clickhouse.WithQueryID(job.ID),
+		clickhouse.WithProgress(func(p *clickhouse.Progress) {
+			run.rows.Add(p.Rows)
+			run.bytes.Add(p.Bytes)
+			run.total.Add(p.TotalRows)
+		}),
+	)
+
+	// Results are written without the query ID, which belongs to the read
+	batch := make([]models.LogEntry, 0, jobResultBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := m.jobs.AppendResults(ctx, job.ID, job.Rows, batch); err != nil {
+			return err
+		}
+		job.Rows += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	err := m.logs.Export(queryCtx, job.Query.logQuery(), func(e *models.LogEntry) error {
+		batch = append(batch, *e)
+		if len(batch) == cap(batch) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if job.Rows+len(batch) >= job.Query.Limit {
+			return errExportLimit
+		}
+		return nil
+	})
+	if errors.Is(err, errExportLimit) {
+		err = nil
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	job.Progress = run.progress()
+	job.FinishedAt = time.Now().UTC()
+	var exception *clickhouse.Exception
+	switch {
+	case m.stopping.Load() && err != nil:
+		job.Status = JobFailed
+		job.Error = "query-api shut down before the job finished"
+	case run.cancelled.Load(), errors.As(err, &exception) && exception.Code == codeQueryWasCancelled:
+		job.Status = JobCancelled
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+		if rejected, ok := rejection(ClassJob, m.config.Limits, err); ok {
+			job.Error = rejected.Message
+		}
+		log.Printf("Query job %s failed: %v", job.ID, err)
+	default:
+		job.Status = JobSucceeded
+	}
+
+	saveCtx, cancel := context.WithTimeout(context.Background(), jobSaveTimeout)
+	defer cancel()
+	if err := m.jobs.SaveJob(saveCtx, job); err != nil {
+		log.Printf("Failed to save query job %s: %v", job.ID, err)
+	}
+}
+
+func (m *JobManager) finish(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run, ok := m.running[id]; ok {
+		run.cancel()
+		delete(m.running, id)
+	}
+}
+
+func (m *JobManager) local(id string) (*runningJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, ok := m.running[id]
+	return run, ok
+}
+
+// Get returns a job with the live progress of its query while it runs
+func (m *JobManager) Get(ctx context.Context, id string) (Job, error) {
+	job, err := m.jobs.GetJob(ctx, id)
+	if err != nil || job.Status != JobRunning {
+		return job, err
+	}
+	if run, ok := m.local(id); ok {
+		job.Progress = run.progress()
+		return job, nil
+	}
+
+	progress, live, err := m.jobs.Progress(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	if live {
+		job.Progress = progress
+		return job, nil
+	}
+	// Between its query and its final save a job is briefly in neither
+	// place, so re-read it before declaring it lost
+	if job, err = m.jobs.GetJob(ctx, id); err != nil || job.Status != JobRunning {
+		return job, err
+	}
+	job.Status = JobFailed
+	job.Error = "query is no longer running; the replica running it may have restarted"
+	return job, nil
+}
+
+// Cancel stops a running job. Finished jobs are returned unchanged.
+func (m *JobManager) Cancel(ctx context.Context, id string) (Job, error) {
+	job, err := m.jobs.GetJob(ctx, id)
+	if err != nil || job.Status != JobRunning {
+		return job, err
+	}
+
+	if run, ok := m.local(id); ok {
+		// run records the cancellation once the query returns
+		run.cancelled.Store(true)
+		run.cancel()
+		job.Status = JobCancelled
+		return job, nil
+	}
+
+	// Another replica runs it: kill the query there and record the outcome
+	if err := m.jobs.Kill(ctx, id); err != nil {
+		return job, err
+	}
+	job.Status = JobCancelled
+	job.FinishedAt = time.Now().UTC()
+	return job, m.jobs.SaveJob(ctx, job)
+}
+
+// Wait blocks until the jobs started by this replica have finished
+func (m *JobManager) Wait() {
+	m.wg.Wait()
+}
+
+// Stop waits for the jobs of this replica until ctx is done, then cancels the
+// rest and records them as failed. No job may be submitted once Stop is called.
+func (m *JobManager) Stop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		m.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	m.stopping.Store(true)
+	m.mu.Lock()
+	for id, run := range m.running {
+		log.Printf("Cancelling query job %s on shutdown", id)
+		run.cancel()
+	}
+	m.mu.Unlock()
+	<-done
+}
+
+// jobRoutes serves /api/jobs
+func jobRoutes(r chi.Router, jobs *JobManager, searches SearchStore) {
+	// Jobs take the /api/logs parameters, with a limit up to JOB_MAX_ROWS
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		params, ok := resolveLogParams(w, r, searches)
+		if !ok {
+			return
+		}
+		if params.Get("offset") != "" {
+			http.Error(w, "offset is not supported by jobs", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseIntParam(params.Get("limit"), 0, jobs.config.MaxRows)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+		if limit == 0 {
+			limit = jobs.config.MaxRows
+		}
+		params.Del("limit")
+		q, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job, err := jobs.Submit(r.Context(), JobQuery{
+			Level: q.Level, Service: q.Service, TraceID: q.TraceID, From: q.From, To: q.To, Limit: limit,
+		})
+		if errors.Is(err, errTooManyJobs) {
+			http.Error(w, "too many running jobs, try again later", http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			dbError(w, r, "submit job", err)
+			return
+		}
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	})
+
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := jobs.Get(r.Context(), chi.URLParam(r, "id"))
+		if writeJobError(w, r, "get job", err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	r.Post("/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		job, err := jobs.Cancel(r.Context(), chi.URLParam(r, "id"))
+		if writeJobError(w, r, "cancel job", err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	r.Get("/{id}/results", func(w http.ResponseWriter, r *http.Request) {
+		limit, err := parseIntParam(r.URL.Query().Get("limit"), 0, logstore.MaxLimit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+		if limit == 0 {
+			limit = logstore.DefaultLimit
+		}
+		offset, err := parseIntParam(r.URL.Query().Get("offset"), 0, 1<<31-1)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid offset: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		job, err := jobs.Get(r.Context(), chi.URLParam(r, "id"))
+		if writeJobError(w, r, "get job", err) {
+			return
+		}
+		if job.Status != JobSucceeded {
+			http.Error(w, fmt.Sprintf("job is %s", job.Status), http.StatusConflict)
+			return
+		}
+		entries, err := jobs.jobs.Results(r.Context(), job.ID, limit, offset)
+		if err != nil {
+			dbError(w, r, "job results", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, JobResults{JobID: job.ID, Rows: job.Rows, Entries: toLogEntries(entries)})
+	})
+}
+
+// JobResults is a page of a job's results
+type JobResults struct {
+	JobID   string     `json:"job_id"`
+	Rows    int        `json:"rows"` // results in total
+	Entries []LogEntry `json:"entries"`
+}
+
+// writeJobError reports err, if any, and whether it did
+func writeJobError(w http.ResponseWriter, r *http.Request, op string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrJobNotFound):
+		http.Error(w, "query job not found", http.StatusNotFound)
+	default:
+		dbError(w, r, op, err)
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+// blockingStore holds exports open until they are cancelled
+type blockingStore struct {
+	*logstore.MemoryStore
+	started chan struct{}
+}
+
+func (s blockingStore) Export(ctx context.Context, q logstore.Query, fn func(*models.LogEntry) error) error {
+	close(s.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// remoteJobStore pretends a job runs on another replica
+type remoteJobStore struct {
+	*MemoryJobStore
+	live   bool
+	killed []string
+}
+
+func (s *remoteJobStore) Progress(ctx context.Context, id string) (Progress, bool, error) {
+	return Progress{RowsRead: 42}, s.live, nil
+}
+
+func (s *remoteJobStore) Kill(ctx context.Context, id string) error {
+	s.killed = append(s.killed, id)
+	return nil
+}
+
+func newJobRouter(jobs *JobManager) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route("/api/jobs", func(r chi.Router) { jobRoutes(r, jobs, NewMemorySearchStore()) })
+	return r
+}
+
+func doJob(t *testing.T, router http.Handler, method, url string, status int, v interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+	if w.Code != status {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, url, status, w.Code, w.Body.String())
+	}
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	jobs := NewJobManager(newTestStore(testLogs), NewMemoryJobStore(), JobConfig{MaxRows: 2, MaxRunning: 1})
+	router := newJobRouter(jobs)
+
+	var job Job
+	doJob(t, router, "POST", "/api/jobs?from=2025-07-24T00:00:00Z", http.StatusAccepted, &job)
+	if job.Status != JobRunning || job.Query.Limit != 2 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	jobs.Wait()
+
+	// The limit defaults to JOB_MAX_ROWS
+	doJob(t, router, "GET", "/api/jobs/"+job.ID, http.StatusOK, &job)
+	if job.Status != JobSucceeded || job.Rows != 2 || job.FinishedAt.IsZero() {
+		t.Fatalf("expected a finished job with 2 rows, got %+v", job)
+	}
+
+	var page JobResults
+	doJob(t, router, "GET", "/api/jobs/"+job.ID+"/results?limit=1&offset=1", http.StatusOK, &page)
+	if page.Rows != 2 || len(page.Entries) != 1 || page.Entries[0].Message != "Payment failed" {
+		t.Errorf("expected the second oldest entry, got %+v", page)
+	}
+
+	// Cancelling a finished job changes nothing
+	doJob(t, router, "POST", "/api/jobs/"+job.ID+"/cancel", http.StatusOK, &job)
+	if job.Status != JobSucceeded {
+		t.Errorf("expected the job to stay succeeded, got %s", job.Status)
+	}
+
+	tests := []struct {
+		name, method, url string
+		expectedStatus    int
+	}{
+		{"limit above max rows", "POST", "/api/jobs?limit=3", http.StatusBadRequest},
+		{"offset", "POST", "/api/jobs?offset=1", http.StatusBadRequest},
+		{"bad trace", "POST", "/api/jobs?trace_id=x", http.StatusBadRequest},
+		{"unknown", "GET", "/api/jobs/nope", http.StatusNotFound},
+		{"unknown results", "GET", "/api/jobs/nope/results", http.StatusNotFound},
+		{"bad results limit", "GET", "/api/jobs/" + job.ID + "/results?limit=5000", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doJob(t, router, tt.method, tt.url, tt.expectedStatus, nil)
+		})
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	store := blockingStore{MemoryStore: logstore.NewMemoryStore(), started: make(chan struct{})}
+	jobs := NewJobManager(store, NewMemoryJobStore(), JobConfig{MaxRows: 10, MaxRunning: 1})
+	router := newJobRouter(jobs)
+
+	var job Job
+	doJob(t, router, "POST", "/api/jobs", http.StatusAccepted, &job)
+	<-store.started
+
+	doJob(t, router, "POST", "/api/jobs", http.StatusTooManyRequests, nil)
+	doJob(t, router, "GET", "/api/jobs/"+job.ID+"/results", http.StatusConflict, nil)
+	doJob(t, router, "GET", "/api/jobs/"+job.ID, http.StatusOK, &job)
+	if job.Status != JobRunning || job.Progress.Elapsed == "" {
+		t.Errorf("expected a running job with progress, got %+v", job)
+	}
+
+	doJob(t, router, "POST", "/api/jobs/"+job.ID+"/cancel", http.StatusOK, &job)
+	jobs.Wait()
+	doJob(t, router, "GET", "/api/jobs/"+job.ID, http.StatusOK, &job)
+	if job.Status != JobCancelled || job.Error != "" {
+		t.Errorf("expected a cancelled job, got %+v", job)
+	}
+}
+
+func TestJobManagerStop(t *testing.T) {
+	store := blockingStore{MemoryStore: logstore.NewMemoryStore(), started: make(chan struct{})}
+	jobs := NewJobManager(store, NewMemoryJobStore(), JobConfig{MaxRows: 10, MaxRunning: 1})
+	router := newJobRouter(jobs)
+
+	var job Job
+	doJob(t, router, "POST", "/api/jobs", http.StatusAccepted, &job)
+	<-store.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	jobs.Stop(ctx)
+
+	doJob(t, router, "GET", "/api/jobs/"+job.ID, http.StatusOK, &job)
+	if job.Status != JobFailed || !strings.Contains(job.Error, "shut down") {
+		t.Errorf("expected a job failed by shutdown, got %+v", job)
+	}
+}
+
+func TestRemoteJob(t *testing.T) {
+	store := &remoteJobStore{MemoryJobStore: NewMemoryJobStore(), live: true}
+	jobs := NewJobManager(logstore.NewMemoryStore(), store, JobConfig{MaxRows: 10, MaxRunning: 1})
+	ctx := context.Background()
+	store.SaveJob(ctx, Job{ID: "remote", Status: JobRunning, CreatedAt: time.Now()})
+
+	// Progress comes from the query running elsewhere
+	job, err := jobs.Get(ctx, "remote")
+	if err != nil || job.Status != JobRunning || job.Progress.RowsRead != 42 {
+		t.Fatalf("expected live progress, got %+v (%v)", job, err)
+	}
+
+	// A job whose query is gone was lost with its replica
+	store.live = false
+	job, _ = jobs.Get(ctx, "remote")
+	if job.Status != JobFailed || !strings.Contains(job.Error, "no longer running") {
+		t.Errorf("expected the job to be reported lost, got %+v", job)
+	}
+
+	// Cancelling kills the query on the server
+	job, err = jobs.Cancel(ctx, "remote")
+	if err != nil || job.Status != JobCancelled || len(store.killed) != 1 {
+		t.Fatalf("expected the query to be killed, got %+v (%v), killed %v", job, err, store.killed)
+	}
+	if saved, _ := store.GetJob(ctx, "remote"); saved.Status != JobCancelled {
+		t.Errorf("expected the cancellation to be saved, got %s", saved.Status)
+	}
+}
+
+func TestLoadJobConfig(t *testing.T) {
+	cfg, err := LoadJobConfig(func(string) string { return "" })
+	if err != nil || cfg.MaxRows != defaultJobMaxRows || cfg.MaxRunning != defaultJobMaxRunning {
+		t.Errorf("unexpected defaults %+v (%v)", cfg, err)
+	}
+	env := map[string]string{"JOB_MAX_ROWS": "500", "JOB_MAX_RUNNING": "2"}
+	cfg, err = LoadJobConfig(func(k string) string { return env[k] })
+	if err != nil || cfg.MaxRows != 500 || cfg.MaxRunning != 2 {
+		t.Errorf("unexpected config %+v (%v)", cfg, err)
+	}
+	if _, err := LoadJobConfig(func(k string) string { return map[string]string{"JOB_MAX_RUNNING": "0"}[k] }); err == nil {
+		t.Errorf("expected an error for JOB_MAX_RUNNING=0")
+	}
+}
+
+func TestJobsCountAgainstKey(t *testing.T) {
+	store := blockingStore{MemoryStore: logstore.NewMemoryStore(), started: make(chan struct{})}
+	jobs := NewJobManager(store, NewMemoryJobStore(), JobConfig{MaxRows: 10, MaxRunning: 2})
+	config := DefaultQueryConfig()
+	config.MaxQueriesPerKey = 1
+	config.APIKeys = map[string]bool{"team-a": true}
+	router := newRouter(logstore.NewMemoryStore(), NewMemorySearchStore(), newHub(), config, func(r chi.Router, guard *queryGuard) {
+		r.With(guard.limit(ClassJob)).Route("/api/jobs", func(r chi.Router) { jobRoutes(r, jobs, NewMemorySearchStore()) })
+	})
+
+	request := func(method, url, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		r.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("POST", "/api/jobs", "team-a")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job Job
+	json.NewDecoder(w.Body).Decode(&job)
+	<-store.started
+
+	// The running job holds the key's only slot
+	if w := request("GET", "/api/stats", "team-a"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 while the job runs, got %d", w.Code)
+	}
+	if w := request("POST", "/api/jobs/"+job.ID+"/cancel", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	jobs.Wait()
+	if w := request("GET", "/api/jobs/"+job.ID, "team-a"); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 once the job finished, got %d", w.Code)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/yourusername/oglogstream-models"
+)
+
+// ErrJobNotFound is returned for unknown or expired jobs
+var ErrJobNotFound = errors.New("query job not found")
+
+// JobStore keeps query jobs and their results where every replica can reach
+// them, and inspects the ClickHouse queries running them
+type JobStore interface {
+	// SaveJob creates or replaces a job
+	SaveJob(ctx context.Context, job Job) error
+
+	// GetJob returns the job with the given ID or ErrJobNotFound
+	GetJob(ctx context.Context, id string) (Job, error)
+
+	// AppendResults stores entries as results seq, seq+1, ... of a job
+	AppendResults(ctx context.Context, id string, seq int, entries []models.LogEntry) error
+
+	// Results returns up to limit results of a job from offset, in order
+	Results(ctx context.Context, id string, limit, offset int) ([]models.LogEntry, error)
+
+	// Progress returns the progress of a job's query, and false when no
+	// query with the job's ID is running
+	Progress(ctx context.Context, id string) (Progress, bool, error)
+
+	// Kill stops the query with the job's ID on the server, whichever
+	// replica started it
+	Kill(ctx context.Context, id string) error
+}
+
+// ClickHouseJobStore keeps jobs as JSON in query_jobs, a ReplacingMergeTree
+// where the highest version of an ID wins, and results in query_job_results.
+// Running queries carry the job ID as their query_id, so any replica can
+// find them in system.processes. The tables are created by processing-svc
+// migrations.
+type ClickHouseJobStore struct {
+	db *sql.DB
+}
+
+func NewClickHouseJobStore(db *sql.DB) *ClickHouseJobStore {
+	return &ClickHouseJobStore{db: db}
+}
+
+func (s *ClickHouseJobStore) SaveJob(ctx context.Context, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO query_jobs (id, job, version) VALUES (?, ?, ?)`,
+		job.ID, string(data), uint64(time.Now().UnixNano()))
+	return err
+}
+
+func (s *ClickHouseJobStore) GetJob(ctx context.Context, id string) (Job, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT argMax(job, version)
+		FROM query_jobs
+		WHERE id = ?
+		GROUP BY id`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	err = json.Unmarshal([]byte(data), &job)
+	return job, err
+}
+
+func (s *ClickHouseJobStore) AppendResults(ctx context.Context, id string, seq int, entries []models.LogEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO query_job_results (job_id, seq, entry)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, id, uint64(seq+i), string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *ClickHouseJobStore) Results(ctx context.Context, id string, limit, offset int) ([]models.LogEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT entry
+		FROM query_job_results
+		WHERE job_id = ?
+		ORDER BY seq
+		LIMIT ? OFFSET ?`, id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LogEntry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var e models.LogEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *ClickHouseJobStore) Progress(ctx context.Context, id string) (Progress, bool, error) {
+	var p Progress
+	var elapsed float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT read_rows, read_bytes, total_rows_approx, elapsed
+		FROM system.processes
+		WHERE query_id = ?`, id).Scan(&p.RowsRead, &p.BytesRead, &p.TotalRowsApprox, &elapsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, false, nil
+	}
+	p.Elapsed = time.Duration(elapsed * float64(time.Second)).Round(time.Millisecond).String()
+	return p, err == nil, err
+}
+
+func (s *ClickHouseJobStore) Kill(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `KILL QUERY WHERE query_id = ? ASYNC`, id)
+	return err
+}
+
+// MemoryJobStore keeps jobs and results in memory, for tests. It knows of no
+// running queries.
+type MemoryJobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]Job
+	results map[string][]models.LogEntry
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job), results: make(map[string][]models.LogEntry)}
+}
+
+func (s *MemoryJobStore) SaveJob(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) GetJob(ctx context.Context, id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryJobStore) AppendResults(ctx context.Context, id string, seq int, entries []models.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = append(s.results[id][:seq], entries...)
+	return nil
+}
+
+func (s *MemoryJobStore) Results(ctx context.Context, id string, limit, offset int) ([]models.LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.results[id]
+	if offset >= len(results) {
+		return nil, nil
+	}
+	results = results[offset:]
+	return append([]models.LogEntry(nil), results[:min(limit, len(results))]...), nil
+}
+
+func (s *MemoryJobStore) Progress(ctx context.Context, id string) (Progress, bool, error) {
+	return Progress{}, false, nil
+}
+
+func (s *MemoryJobStore) Kill(ctx context.Context, id string) error {
+	return nil
+}
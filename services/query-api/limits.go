@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// apiKeyHeader identifies the client a request counts against. Only keys
+// listed in API_KEYS count; requests without one share the keyless budget.
+const apiKeyHeader = "X-API-Key"
+
+const (
+	defaultMaxQueriesPerKey  = 8
+	defaultMaxQueriesKeyless = 8
+)
+
+// ClickHouse errors of queries stopped by their limits
+const (
+	codeTooManyRows        = 158
+	codeTimeoutExceeded    = 159
+	codeMemoryLimit        = 241
+	codeTooManyBytes       = 307
+	codeTooManyRowsOrBytes = 396
+)
+
+// QueryClass groups the endpoints whose queries share limits
+type QueryClass string
+
+const (
+	ClassSearch    QueryClass = "search"    // entries by filter, ID, trace or position
+	ClassAggregate QueryClass = "aggregate" // stats, patterns, facets and anomalies
+	ClassExport    QueryClass = "export"    // streamed downloads
+	ClassJob       QueryClass = "job"       // background query jobs
+	ClassAdmin     QueryClass = "admin"     // storage and retention reports
+)
+
+var queryClasses = []QueryClass{ClassSearch, ClassAggregate, ClassExport, ClassJob, ClassAdmin}
+
+// QueryLimits bound the ClickHouse queries of a class. Zero values don't limit.
+type QueryLimits struct {
+	Timeout        time.Duration // request deadline, also sent as max_execution_time
+	MaxRowsToRead  uint64        // max_rows_to_read
+	MaxMemoryUsage uint64        // max_memory_usage, in bytes
+}
+
+// QueryConfig is the cost guardrails of the query API
+type QueryConfig struct {
+	Limits            map[QueryClass]QueryLimits
+	APIKeys           map[string]bool // known X-API-Key values, none accepted when empty
+	MaxQueriesPerKey  int             // requests of an API key running at once on this replica
+	MaxQueriesKeyless int             // requests without an API key running at once on this replica
+}
+
+func DefaultQueryConfig() QueryConfig {
+	return QueryConfig{
+		Limits: map[QueryClass]QueryLimits{
+			ClassSearch:    {Timeout: 10 * time.Second, MaxRowsToRead: 500_000_000, MaxMemoryUsage: 2 << 30},
+			ClassAggregate: {Timeout: 30 * time.Second, MaxRowsToRead: 2_000_000_000, MaxMemoryUsage: 4 << 30},
+			ClassExport:    {Timeout: 10 * time.Minute, MaxMemoryUsage: 4 << 30},
+			ClassJob:       {Timeout: 30 * time.Minute, MaxMemoryUsage: 4 << 30},
+			ClassAdmin:     {Timeout: 30 * time.Second, MaxMemoryUsage: 1 << 30},
+		},
+		MaxQueriesPerKey:  defaultMaxQueriesPerKey,
+		MaxQueriesKeyless: defaultMaxQueriesKeyless,
+	}
+}
+
+// LoadQueryConfig reads <CLASS>_QUERY_TIMEOUT, <CLASS>_MAX_ROWS_TO_READ and
+// <CLASS>_MAX_MEMORY_USAGE for each class, e.g. SEARCH_QUERY_TIMEOUT=5s,
+// MAX_QUERIES_PER_KEY, MAX_QUERIES_KEYLESS and the comma-separated API_KEYS,
+// keeping defaults for unset ones. 0 removes a limit.
+func LoadQueryConfig(getenv func(string) string) (QueryConfig, error) {
+	cfg := DefaultQueryConfig()
+	for _, class := range queryClasses {
+		limits := cfg.Limits[class]
+		prefix := strings.ToUpper(string(class)) + "_"
+
+		if raw := getenv(prefix + "QUERY_TIMEOUT"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d < 0 {
+				return cfg, fmt.Errorf("invalid %sQUERY_TIMEOUT %q", prefix, raw)
+			}
+			limits.Timeout = d
+		}
+		for _, v := range []struct {
+			name string
+			dest *uint64
+		}{
+			{prefix + "MAX_ROWS_TO_READ", &limits.MaxRowsToRead},
+			{prefix + "MAX_MEMORY_USAGE", &limits.MaxMemoryUsage},
+		} {
+			raw := getenv(v.name)
+			if raw == "" {
+				continue
+			}
+			n, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+			}
+			*v.dest = n
+		}
+		cfg.Limits[class] = limits
+	}
+
+	for _, v := range []struct {
+		name string
+		dest *int
+	}{
+		{"MAX_QUERIES_PER_KEY", &cfg.MaxQueriesPerKey},
+		{"MAX_QUERIES_KEYLESS", &cfg.MaxQueriesKeyless},
+	} {
+		raw := getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", v.name, raw)
+		}
+		*v.dest = n
+	}
+
+	cfg.APIKeys = make(map[string]bool)
+	for _, key := range strings.Split(getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.APIKeys[key] = true
+		}
+	}
+	return cfg, nil
+}
+
+// context returns ctx with the deadline of l and its ClickHouse settings
+// attached to every query run with it. With a deadline, the driver replaces
+// max_execution_time by the time left plus a few seconds, so the client
+// gives up first and cancels the query.
+func (l QueryLimits) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	settings := clickhouse.Settings{}
+	if l.Timeout > 0 {
+		settings["max_execution_time"] = max(int(l.Timeout/time.Second), 1)
+	}
+	if l.MaxRowsToRead > 0 {
+		settings["max_rows_to_read"] = l.MaxRowsToRead
+	}
+	if l.MaxMemoryUsage > 0 {
+		settings["max_memory_usage"] = l.MaxMemoryUsage
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+	if l.Timeout > 0 {
+		return context.WithTimeout(ctx, l.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// QueryRejection is the body of a response to a query stopped by its limits
+type QueryRejection struct {
+	Error   string     `json:"error"` // timeout, too_many_rows, memory_limit, too_many_queries or unknown_api_key
+	Message string     `json:"message"`
+	Class   QueryClass `json:"class"`
+	Limit   uint64     `json:"limit,omitempty"` // the limit reached: seconds, rows, bytes or queries
+
+	status int
+}
+
+// rejection tells whether err comes from the limits of a class rather than
+// from a failure
+func rejection(class QueryClass, limits QueryLimits, err error) (QueryRejection, bool) {
+	timeout := QueryRejection{
+		Error:   "timeout",
+		Message: fmt.Sprintf("query did not finish within %s; narrow the time range or filters, or run it as a job", limits.Timeout),
+		Class:   class,
+		Limit:   uint64(limits.Timeout / time.Second),
+		status:  http.StatusGatewayTimeout,
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return timeout, true
+	}
+
+	var exception *clickhouse.Exception
+	if !errors.As(err, &exception) {
+		return QueryRejection{}, false
+	}
+	switch exception.Code {
+	case codeTimeoutExceeded:
+		return timeout, true
+	case codeTooManyRows, codeTooManyBytes, codeTooManyRowsOrBytes:
+		return QueryRejection{
+			Error:   "too_many_rows",
+			Message: fmt.Sprintf("query would read more than %d rows; narrow the time range or filters", limits.MaxRowsToRead),
+			Class:   class,
+			Limit:   limits.MaxRowsToRead,
+			status:  http.StatusUnprocessableEntity,
+		}, true
+	case codeMemoryLimit:
+		return QueryRejection{
+			Error:   "memory_limit",
+			Message: fmt.Sprintf("query would use more than %d bytes of memory; narrow the time range or group by fewer fields", limits.MaxMemoryUsage),
+			Class:   class,
+			Limit:   limits.MaxMemoryUsage,
+			status:  http.StatusUnprocessableEntity,
+		}, true
+	}
+	return QueryRejection{}, false
+}
+
+type queryClassKey struct{}
+
+// guardedQuery is the class a request runs as, kept in its context
+type guardedQuery struct {
+	class  QueryClass
+	limits QueryLimits
+	slot   *querySlot
+}
+
+// querySlot is the place a request takes in the budget of its key. It is
+// given back when the request ends unless kept for work outliving it.
+type querySlot struct {
+	release func()
+	kept    bool
+}
+
+// keepQuerySlot takes over the budget slot of the guarded request ctx belongs
+// to, so that it stays taken after the request ends. The returned function
+// gives it back and must be called once. It must be called from the request's
+// handler; outside guarded requests there is no slot and it does nothing.
+func keepQuerySlot(ctx context.Context) func() {
+	guarded, ok := ctx.Value(queryClassKey{}).(guardedQuery)
+	if !ok || guarded.slot == nil {
+		return func() {}
+	}
+	guarded.slot.kept = true
+	return guarded.slot.release
+}
+
+// queryGuard applies the limits of a class to requests and caps the requests
+// each API key runs at once. Requests without a key share a budget of their
+// own, and unknown keys are refused so that changing the header value does not
+// buy another budget.
+type queryGuard struct {
+	config QueryConfig
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newQueryGuard(config QueryConfig) *queryGuard {
+	return &queryGuard{config: config, running: make(map[string]int)}
+}
+
+// limit is middleware running the queries of next as class
+func (g *queryGuard) limit(class QueryClass) func(http.Handler) http.Handler {
+	limits := g.config.Limits[class]
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(apiKeyHeader)
+			if key != "" && !g.config.APIKeys[key] {
+				writeJSON(w, http.StatusUnauthorized, QueryRejection{
+					Error:   "unknown_api_key",
+					Message: fmt.Sprintf("%s is not a configured API key; omit it to use the keyless budget", apiKeyHeader),
+					Class:   class,
+				})
+				return
+			}
+			if !g.acquire(key) {
+				budget, per := g.budget(key), "per API key"
+				if key == "" {
+					per = "without an API key"
+				}
+				w.Header().Set("Retry-After", "1")
+				writeJSON(w, http.StatusTooManyRequests, QueryRejection{
+					Error:   "too_many_queries",
+					Message: fmt.Sprintf("at most %d queries %s can run at once", budget, per),
+					Class:   class,
+					Limit:   uint64(budget),
+				})
+				return
+			}
+			slot := &querySlot{release: func() { g.release(key) }}
+			defer func() {
+				if !slot.kept {
+					slot.release()
+				}
+			}()
+
+			ctx, cancel := limits.context(r.Context())
+			defer cancel()
+			ctx = context.WithValue(ctx, queryClassKey{}, guardedQuery{class, limits, slot})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// budget is the number of requests key may run at once, "" being keyless
+func (g *queryGuard) budget(key string) int {
+	if key == "" {
+		return g.config.MaxQueriesKeyless
+	}
+	return g.config.MaxQueriesPerKey
+}
+
+func (g *queryGuard) acquire(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[key] >= g.budget(key) {
+		return false
+	}
+	g.running[key]++
+	return true
+}
+
+func (g *queryGuard) release(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[key]--; g.running[key] <= 0 {
+		delete(g.running, key)
+	}
+}
+
+// dbError answers a failed store call. Queries of a guarded request stopped
+// by the limits of its class get a QueryRejection, anything else is logged
+// as a database error.
+func dbError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	guarded, ok := r.Context().Value(queryClassKey{}).(guardedQuery)
+	if rejected, rejectedOK := rejection(guarded.class, guarded.limits, err); ok && rejectedOK {
+		log.Printf("Query rejected (%s): %v", op, err)
+		writeJSON(w, rejected.status, rejected)
+		return
+	}
+	log.Printf("DB error (%s): %v", op, err)
+	http.Error(w, "db error", http.StatusInternalServerError)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestLoadQueryConfig(t *testing.T) {
+	env := map[string]string{
+		"SEARCH_QUERY_TIMEOUT":       "5s",
+		"AGGREGATE_MAX_ROWS_TO_READ": "0",
+		"JOB_MAX_MEMORY_USAGE":       "1073741824",
+		"MAX_QUERIES_PER_KEY":        "2",
+		"MAX_QUERIES_KEYLESS":        "3",
+		"API_KEYS":                   "team-a, team-b,",
+	}
+	cfg, err := LoadQueryConfig(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("LoadQueryConfig failed: %v", err)
+	}
+	defaults := DefaultQueryConfig()
+	if l := cfg.Limits[ClassSearch]; l.Timeout != 5*time.Second || l.MaxRowsToRead != defaults.Limits[ClassSearch].MaxRowsToRead {
+		t.Errorf("unexpected search limits: %+v", l)
+	}
+	if l := cfg.Limits[ClassAggregate]; l.MaxRowsToRead != 0 || l.Timeout != defaults.Limits[ClassAggregate].Timeout {
+		t.Errorf("expected the aggregate row limit removed, got %+v", l)
+	}
+	if cfg.Limits[ClassJob].MaxMemoryUsage != 1<<30 || cfg.MaxQueriesPerKey != 2 || cfg.MaxQueriesKeyless != 3 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.APIKeys) != 2 || !cfg.APIKeys["team-a"] || !cfg.APIKeys["team-b"] {
+		t.Errorf("unexpected API keys: %v", cfg.APIKeys)
+	}
+
+	for name, value := range map[string]string{
+		"EXPORT_QUERY_TIMEOUT":    "soon",
+		"SEARCH_MAX_ROWS_TO_READ": "-1",
+		"MAX_QUERIES_PER_KEY":     "0",
+		"MAX_QUERIES_KEYLESS":     "none",
+	} {
+		if _, err := LoadQueryConfig(func(k string) string { return map[string]string{name: value}[k] }); err == nil {
+			t.Errorf("expected an error for %s=%s", name, value)
+		}
+	}
+}
+
+func TestRejection(t *testing.T) {
+	limits := QueryLimits{Timeout: 10 * time.Second, MaxRowsToRead: 1000, MaxMemoryUsage: 1 << 20}
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+		limit  uint64
+	}{
+		{"deadline", context.DeadlineExceeded, "timeout", http.StatusGatewayTimeout, 10},
+		{"server timeout", &clickhouse.Exception{Code: codeTimeoutExceeded}, "timeout", http.StatusGatewayTimeout, 10},
+		{"rows", &clickhouse.Exception{Code: codeTooManyRows}, "too_many_rows", http.StatusUnprocessableEntity, 1000},
+		{"memory", &clickhouse.Exception{Code: codeMemoryLimit}, "memory_limit", http.StatusUnprocessableEntity, 1 << 20},
+		{"syntax", &clickhouse.Exception{Code: 62}, "", 0, 0},
+		{"cancelled", context.Canceled, "", 0, 0},
+		{"other", errors.New("connection reset"), "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected, ok := rejection(ClassSearch, limits, tt.err)
+			if ok != (tt.code != "") {
+				t.Fatalf("expected rejected=%v, got %+v", tt.code != "", rejected)
+			}
+			if ok && (rejected.Error != tt.code || rejected.status != tt.status || rejected.Limit != tt.limit || rejected.Class != ClassSearch) {
+				t.Errorf("unexpected rejection: %+v", rejected)
+			}
+		})
+	}
+}
+
+func TestQueryLimitsContext(t *testing.T) {
+	ctx, cancel := QueryLimits{Timeout: time.Minute}.context(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("expected a deadline within a minute, got %v", deadline)
+	}
+
+	ctx, cancel = QueryLimits{}.context(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline without a timeout")
+	}
+}
+
+// limitedStore fails or holds searches like a ClickHouse enforcing limits
+type limitedStore struct {
+	*logstore.MemoryStore
+	err     error
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s limitedStore) Search(ctx context.Context, q logstore.Query) ([]models.LogEntry, error) {
+	if s.started != nil {
+		s.started <- struct{}{}
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, s.err
+}
+
+func decodeRejection(t *testing.T, w *httptest.ResponseRecorder) QueryRejection {
+	t.Helper()
+	var rejected QueryRejection
+	if err := json.NewDecoder(w.Body).Decode(&rejected); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return rejected
+}
+
+func TestQueryRejectedForCost(t *testing.T) {
+	store := limitedStore{MemoryStore: logstore.NewMemoryStore(), err: &clickhouse.Exception{Code: codeTooManyRows}}
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body.String())
+	}
+	rejected := decodeRejection(t, w)
+	if rejected.Error != "too_many_rows" || rejected.Class != ClassSearch || rejected.Limit != DefaultQueryConfig().Limits[ClassSearch].MaxRowsToRead {
+		t.Errorf("unexpected rejection: %+v", rejected)
+	}
+
+	// Other failures stay database errors
+	store.err = errors.New("connection reset")
+	w = httptest.NewRecorder()
+	newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/api/logs", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	config := DefaultQueryConfig()
+	config.Limits[ClassSearch] = QueryLimits{Timeout: 10 * time.Millisecond}
+	store := limitedStore{MemoryStore: logstore.NewMemoryStore(), started: make(chan struct{}, 1)}
+	router := newRouter(store, NewMemorySearchStore(), newHub(), config)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d: %s", w.Code, w.Body.String())
+	}
+	if rejected := decodeRejection(t, w); rejected.Error != "timeout" || rejected.Class != ClassSearch {
+		t.Errorf("unexpected rejection: %+v", rejected)
+	}
+}
+
+func TestQueriesPerKey(t *testing.T) {
+	config := DefaultQueryConfig()
+	config.MaxQueriesPerKey, config.MaxQueriesKeyless = 1, 1
+	config.APIKeys = map[string]bool{"team-a": true, "team-b": true}
+	store := limitedStore{MemoryStore: logstore.NewMemoryStore(), started: make(chan struct{}), release: make(chan struct{})}
+	router := newRouter(store, NewMemorySearchStore(), newHub(), config)
+
+	request := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/logs", nil)
+		r.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- request("team-a") }()
+	<-store.started
+
+	// The key is at its limit, whatever the class
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/stats", nil)
+	r.Header.Set(apiKeyHeader, "team-a")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected status 429 with Retry-After, got %d", w.Code)
+	}
+	if rejected := decodeRejection(t, w); rejected.Error != "too_many_queries" || rejected.Limit != 1 || rejected.Class != ClassAggregate {
+		t.Errorf("unexpected rejection: %+v", rejected)
+	}
+
+	// Unknown keys don't get a budget of their own
+	if w := request("team-c"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for an unknown key, got %d", w.Code)
+	} else if rejected := decodeRejection(t, w); rejected.Error != "unknown_api_key" {
+		t.Errorf("unexpected rejection: %+v", rejected)
+	}
+
+	// Other keys and keyless requests are not affected
+	go func() { done <- request("team-b") }()
+	<-store.started
+	go func() { done <- request("") }()
+	<-store.started
+	if w := request(""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected keyless requests to have their own budget, got %d", w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		store.release <- struct{}{}
+	}
+	for i := 0; i < 3; i++ {
+		if w := <-done; w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	// Finished requests free their slot
+	go func() { store.release <- struct{}{} }()
+	go func() { <-store.started }()
+	if w := request("team-a"); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 once the first request finished, got %d", w.Code)
+	}
+}
+
+func TestQueryGuardForgetsIdleKeys(t *testing.T) {
+	g := newQueryGuard(DefaultQueryConfig())
+	for _, key := range []string{"a", "b", ""} {
+		if !g.acquire(key) {
+			t.Fatalf("expected %q to get a slot", key)
+		}
+		g.release(key)
+	}
+	if len(g.running) != 0 {
+		t.Errorf("expected no entries once every request finished, got %v", g.running)
+	}
+}
+
+func TestQueryGuardMounts(t *testing.T) {
+	jobs := NewJobManager(logstore.NewMemoryStore(), NewMemoryJobStore(), JobConfig{MaxRows: 10, MaxRunning: 1})
+	router := newRouter(logstore.NewMemoryStore(), NewMemorySearchStore(), newHub(), DefaultQueryConfig(), func(r chi.Router, guard *queryGuard) {
+		r.With(guard.limit(ClassJob)).Route("/api/jobs", func(r chi.Router) { jobRoutes(r, jobs, NewMemorySearchStore()) })
+	})
+
+	for key, expectedStatus := range map[string]int{"": http.StatusNotFound, "made-up": http.StatusUnauthorized} {
+		r := httptest.NewRequest("GET", "/api/jobs/nope", nil)
+		r.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != expectedStatus {
+			t.Errorf("key %q: expected status %d, got %d", key, expectedStatus, w.Code)
+		}
+	}
+}
+
+type failingJobStore struct {
+	*MemoryJobStore
+	err error
+}
+
+func (s failingJobStore) GetJob(ctx context.Context, id string) (Job, error) {
+	return Job{}, s.err
+}
+
+func TestJobRoutesRejectOverLimit(t *testing.T) {
+	jobs := NewJobManager(logstore.NewMemoryStore(), failingJobStore{NewMemoryJobStore(), &clickhouse.Exception{Code: codeTimeoutExceeded}}, JobConfig{MaxRows: 10, MaxRunning: 1})
+	router := newRouter(logstore.NewMemoryStore(), NewMemorySearchStore(), newHub(), DefaultQueryConfig(), func(r chi.Router, guard *queryGuard) {
+		r.With(guard.limit(ClassJob)).Route("/api/jobs", func(r chi.Router) { jobRoutes(r, jobs, NewMemorySearchStore()) })
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs/some-job", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d: %s", w.Code, w.Body.String())
+	}
+	if rejected := decodeRejection(t, w); rejected.Error != "timeout" || rejected.Class != ClassJob {
+		t.Errorf("unexpected rejection: %+v", rejected)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+const (
+	defaultContextLines = 50
+
+	// Attribute the host scope matches on
+	hostAttribute = "host"
+)
+
+// ContextResponse holds the neighbours of an entry, oldest first
+type ContextResponse struct {
+	Scope  string     `json:"scope"`
+	Entry  *LogEntry  `json:"entry,omitempty"`
+	Before []LogEntry `json:"before"`
+	After  []LogEntry `json:"after"`
+}
+
+// contextByIDHandler serves /api/logs/{id}/context
+func contextByIDHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+
+		anchor, err := store.Get(r.Context(), id)
+		if errors.Is(err, logstore.ErrNotFound) {
+			http.Error(w, "log entry not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			dbError(w, r, "context", err)
+			return
+		}
+
+		entry := toLogEntry(anchor)
+		serveContext(w, r, store, anchor, &entry)
+	}
+}
+
+// contextByTimeHandler serves /api/logs/context?timestamp=&service= for
+// entries without an ID. host= and trace_id= stand in for the anchor's
+// host attribute and trace ID when widening the scope.
+func contextByTimeHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		ts, err := time.Parse(time.RFC3339, params.Get("timestamp"))
+		if err != nil {
+			http.Error(w, "timestamp is required in RFC 3339 format", http.StatusBadRequest)
+			return
+		}
+		if params.Get("service") == "" {
+			http.Error(w, "service is required", http.StatusBadRequest)
+			return
+		}
+
+		anchor := models.LogEntry{
+			Timestamp:  ts,
+			Service:    params.Get("service"),
+			TraceID:    strings.ToLower(params.Get("trace_id")),
+			Attributes: map[string]string{},
+		}
+		if v := params.Get(hostAttribute); v != "" {
+			anchor.Attributes[hostAttribute] = v
+		}
+		serveContext(w, r, store, anchor, nil)
+	}
+}
+
+func serveContext(w http.ResponseWriter, r *http.Request, store logstore.LogStore, anchor models.LogEntry, entry *LogEntry) {
+	q, scope, err := parseContextQuery(r, anchor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, after, err := store.Surrounding(r.Context(), q)
+	if err != nil {
+		dbError(w, r, "context", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ContextResponse{
+		Scope:  scope,
+		Entry:  entry,
+		Before: toLogEntries(before),
+		After:  toLogEntries(after),
+	})
+}
+
+// parseContextQuery reads before, after and scope. The service scope keeps
+// the anchor's service; host and trace widen to every service sharing the
+// anchor's host attribute or trace ID.
+func parseContextQuery(r *http.Request, anchor models.LogEntry) (logstore.SurroundingQuery, string, error) {
+	params := r.URL.Query()
+	q := logstore.SurroundingQuery{Anchor: anchor, Before: defaultContextLines, After: defaultContextLines}
+
+	var err error
+	if v := params.Get("before"); v != "" {
+		if q.Before, err = parseIntParam(v, 0, logstore.MaxLimit); err != nil {
+			return q, "", fmt.Errorf("invalid before: %v", err)
+		}
+	}
+	if v := params.Get("after"); v != "" {
+		if q.After, err = parseIntParam(v, 0, logstore.MaxLimit); err != nil {
+			return q, "", fmt.Errorf("invalid after: %v", err)
+		}
+	}
+
+	scope := params.Get("scope")
+	switch scope {
+	case "", "service":
+		scope = "service"
+		q.Service = anchor.Service
+	case "host":
+		value := anchor.Attributes[hostAttribute]
+		if value == "" {
+			return q, "", fmt.Errorf("entry has no %s attribute for scope host", hostAttribute)
+		}
+		q.Attributes = map[string]string{hostAttribute: value}
+	case "trace":
+		if anchor.TraceID == "" {
+			return q, "", fmt.Errorf("entry has no trace_id for scope trace")
+		}
+		q.TraceID = anchor.TraceID
+	default:
+		return q, "", fmt.Errorf("invalid scope %q, expected service, host or trace", scope)
+	}
+	return q, scope, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+// contextStore holds api lines 0-5 alternating between hosts a and b, with a
+// worker line on host a at the same time as line 2. Lines 1-2 and the worker
+// line share a trace.
+const contextTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func contextStore() *logstore.MemoryStore {
+	ts := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	var entries []models.LogEntry
+	for i := 0; i < 6; i++ {
+		host := "a"
+		if i%2 == 1 {
+			host = "b"
+		}
+		var trace string
+		if i == 1 || i == 2 {
+			trace = contextTrace
+		}
+		entries = append(entries, models.LogEntry{
+			ID:        fmt.Sprintf("0198a6b2-7c3e-7d4f-9a1b-00000000000%d", i),
+			Timestamp: ts.Add(time.Duration(i) * time.Second),
+			Level:     "info", Message: fmt.Sprintf("line %d", i), Service: "api", TraceID: trace,
+			Attributes: map[string]string{"host": host},
+		})
+	}
+	entries = append(entries, models.LogEntry{
+		ID: "0198a6b2-7c3e-7d4f-9a1b-000000000009", Timestamp: ts.Add(2 * time.Second),
+		Level: "error", Message: "worker crashed", Service: "worker", TraceID: contextTrace,
+		Attributes: map[string]string{"host": "a"},
+	})
+	return logstore.NewMemoryStore(entries...)
+}
+
+func TestLogContext(t *testing.T) {
+	router := newRouter(contextStore(), NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+	const anchor = "/api/logs/0198a6b2-7c3e-7d4f-9a1b-000000000002/context"
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		before, after  string
+	}{
+		{"service", anchor + "?before=1&after=2", http.StatusOK, "[line 1]", "[line 3 line 4]"},
+		{"host widens across services", anchor + "?scope=host", http.StatusOK, "[line 0]", "[worker crashed line 4]"},
+		{"by timestamp", "/api/logs/context?timestamp=2025-07-24T16:00:03Z&service=api&before=1&after=1", http.StatusOK, "[line 2]", "[line 3]"},
+		{"trace widens across services", anchor + "?scope=trace", http.StatusOK, "[line 1]", "[worker crashed]"},
+		{"trace by timestamp", "/api/logs/context?timestamp=2025-07-24T16:00:03Z&service=api&scope=trace&trace_id=" + contextTrace, http.StatusOK, "[line 1 line 2 worker crashed]", "[]"},
+		{"missing trace", "/api/logs/0198a6b2-7c3e-7d4f-9a1b-000000000004/context?scope=trace", http.StatusBadRequest, "", ""},
+		{"bad scope", anchor + "?scope=cluster", http.StatusBadRequest, "", ""},
+		{"bad before", anchor + "?before=5000", http.StatusBadRequest, "", ""},
+		{"unknown id", "/api/logs/0198a6b2-7c3e-7d4f-9a1b-0000000000ff/context", http.StatusNotFound, "", ""},
+		{"timestamp without service", "/api/logs/context?timestamp=2025-07-24T16:00:03Z", http.StatusBadRequest, "", ""},
+	}
+
+	messages := func(entries []LogEntry) string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Message)
+		}
+		return fmt.Sprint(out)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp ContextResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := messages(resp.Before); got != tt.before {
+				t.Errorf("before: expected %s, got %s", tt.before, got)
+			}
+			if got := messages(resp.After); got != tt.after {
+				t.Errorf("after: expected %s, got %s", tt.after, got)
+			}
+		})
+	}
+}
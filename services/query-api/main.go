@@ -1,31 +1,38 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
+
+	"github.com/yourusername/oglogstream-logstore"
 )
 
 type LogEntry struct {
+	ID        string `json:"id,omitempty"`
 	Timestamp string `json:"timestamp"`
 	Level     string `json:"level"`
 	Message   string `json:"message"`
 	Service   string `json:"service"`
-}
+	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
 
-type Stat struct {
-	Level string `json:"level"`
-	Count int    `json:"count"`
+	// Set when processing collapsed a burst of identical entries into this row
+	RepeatCount uint32 `json:"repeat_count,omitempty"`
+	FirstSeen   string `json:"first_seen,omitempty"`
+	LastSeen    string `json:"last_seen,omitempty"`
 }
 
 // Client represents a single WebSocket client
@@ -148,7 +155,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 		
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -184,111 +191,33 @@ func main() {
 	hub := newHub()
 	go hub.run()
 
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(corsMiddleware)
-
-	// Health check endpoint
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok","service":"query-api"}`))
-	})
-
-	r.Get("/api/logs", func(w http.ResponseWriter, r *http.Request) {
-		// Get query parameters for filtering
-		levelFilter := r.URL.Query().Get("level")
-		serviceFilter := r.URL.Query().Get("service")
-		
-		// Build dynamic SQL query with filters
-		query := `SELECT timestamp, level, message, service FROM logs`
-		var conditions []string
-		var args []interface{}
-		
-		if levelFilter != "" {
-			conditions = append(conditions, "level = ?")
-			args = append(args, levelFilter)
-		}
-		
-		if serviceFilter != "" {
-			conditions = append(conditions, "service ILIKE ?")
-			args = append(args, "%"+serviceFilter+"%")
-		}
-		
-		if len(conditions) > 0 {
-			query += " WHERE " + strings.Join(conditions, " AND ")
-		}
-		
-		query += " ORDER BY timestamp DESC LIMIT 100"
-		
-		rows, err := db.Query(query, args...)
-		if err != nil {
-			log.Printf("DB error (logs): %v", err)
-			http.Error(w, "db error", http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-		var logs []LogEntry
-		for rows.Next() {
-			var e LogEntry
-			if err := rows.Scan(&e.Timestamp, &e.Level, &e.Message, &e.Service); err != nil {
-				continue
-			}
-			logs = append(logs, e)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(logs)
-	})
-
-	r.Get("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query(`SELECT level, count() FROM logs GROUP BY level`)
-		if err != nil {
-			log.Printf("DB error (stats): %v", err)
-			http.Error(w, "db error", http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-		var stats []Stat
-		for rows.Next() {
-			var s Stat
-			if err := rows.Scan(&s.Level, &s.Count); err != nil {
-				continue
-			}
-			stats = append(stats, s)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(stats)
-	})
-
-	r.Get("/ws/live", func(w http.ResponseWriter, r *http.Request) {
-		upgrader := websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-		}
+	logs := logstore.NewClickHouseStore(db)
+	searches := NewClickHouseSearchStore(db)
+	queryConfig, err := LoadQueryConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid query limits: %v", err)
+	}
+	// Searches too long for a request run as jobs
+	jobConfig, err := LoadJobConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid job config: %v", err)
+	}
+	jobConfig.Limits = queryConfig.Limits[ClassJob]
+	jobs := NewJobManager(logs, NewClickHouseJobStore(db), jobConfig)
+	
+	r := newRouter(logs, searches, hub, queryConfig, func(r chi.Router, guard *queryGuard) {
+		r.With(guard.limit(ClassJob)).Route("/api/jobs", func(r chi.Router) { jobRoutes(r, jobs, searches) })
 		
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Printf("WebSocket upgrade error: %v", err)
-			return
-		}
-
-		client := &Client{
-			hub:  hub,
-			conn: conn,
-			send: make(chan []byte, 256),
+		// Retention policy and storage per partition, only with ADMIN_TOKEN
+		if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+			r.With(adminAuth(token), guard.limit(ClassAdmin)).Get("/api/admin/retention", retentionHandler(db))
+		} else {
+			log.Printf("ADMIN_TOKEN not set, admin endpoints are disabled")
 		}
-
-		client.hub.register <- client
-
-		// Start goroutines for reading and writing
-		go client.writePump()
-		go client.readPump()
 	})
-
-	// Subscribe to NATS and broadcast to all clients
-	_, err = nc.Subscribe("logs.raw", func(msg *nats.Msg) {
+	
+	// Broadcast entries to all clients once processing has redacted them
+	_, err = nc.Subscribe("logs.live", func(msg *nats.Msg) {
 		hub.broadcast <- msg.Data
 	})
 	if err != nil {
@@ -296,8 +225,26 @@ func main() {
 	}
 
 	addr := ":8081"
-	log.Printf("Query API listening on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		log.Printf("Query API listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+	
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	log.Printf("Shutdown signal received, stopping gracefully...")
+	
+	// No new jobs start once the server is down; running ones get what is left
+	// of the shutdown timeout before they are cancelled
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	jobs.Stop(shutdownCtx)
+	log.Printf("Query API stopped")
 } 
\ No newline at end of file
@@ -2,38 +2,18 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-)
-
-// Mock database for testing
-type mockDB struct {
-	logs  []LogEntry
-	stats []Stat
-}
-
-func (m *mockDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	// This would need proper mock implementation in real tests
-	// For now, we'll test with integration approach
-	return nil, fmt.Errorf("mock query not implemented")
-}
-
-func (m *mockDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return m.Query(query, args...)
-}
 
-func (m *mockDB) Close() error {
-	return nil
-}
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
 
 // Test data
 var testLogs = []LogEntry{
@@ -57,51 +37,32 @@ var testLogs = []LogEntry{
 	},
 }
 
-var testStats = []Stat{
-	{Level: "info", Count: 5},
-	{Level: "error", Count: 3},
-	{Level: "warn", Count: 2},
-	{Level: "fatal", Count: 1},
+var testStats = []struct {
+	Level   string
+	Service string
+	Count   int
+}{
+	{Level: "info", Service: "auth-service", Count: 5},
+	{Level: "error", Service: "payment-api", Count: 3},
+	{Level: "warn", Service: "auth-service", Count: 2},
+	{Level: "fatal", Service: "payment-api", Count: 1},
 }
 
-// Create test router with mock handlers
-func createTestRouter() *chi.Mux {
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(corsMiddleware)
-
-	// Mock /api/logs endpoint
-	r.Get("/api/logs", func(w http.ResponseWriter, r *http.Request) {
-		levelFilter := r.URL.Query().Get("level")
-		serviceFilter := r.URL.Query().Get("service")
-		
-		var filteredLogs []LogEntry
-		for _, log := range testLogs {
-			// Apply level filter
-			if levelFilter != "" && log.Level != levelFilter {
-				continue
-			}
-			
-			// Apply service filter (case-insensitive partial match)
-			if serviceFilter != "" && !strings.Contains(strings.ToLower(log.Service), strings.ToLower(serviceFilter)) {
-				continue
-			}
-			
-			filteredLogs = append(filteredLogs, log)
-		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(filteredLogs)
-	})
-
-	// Mock /api/stats endpoint
-	r.Get("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(testStats)
-	})
+// newTestStore seeds an in-memory store with API entries
+func newTestStore(logs []LogEntry) *logstore.MemoryStore {
+	store := logstore.NewMemoryStore()
+	for _, l := range logs {
+		ts, _ := time.Parse(time.RFC3339, l.Timestamp)
+		store.WriteBatch(context.Background(), []models.LogEntry{{
+			Timestamp: ts, Level: l.Level, Message: l.Message, Service: l.Service,
+		}})
+	}
+	return store
+}
 
-	return r
+// Create test router with the real handlers on top of an in-memory store
+func createTestRouter() *chi.Mux {
+	return newRouter(newTestStore(testLogs), NewMemorySearchStore(), newHub(), DefaultQueryConfig())
 }
 
 func TestGetLogsEndpoint(t *testing.T) {
@@ -195,7 +156,18 @@ func TestGetLogsEndpoint(t *testing.T) {
 }
 
 func TestGetStatsEndpoint(t *testing.T) {
-	router := createTestRouter()
+	// Collapsed rows carrying repeat counts reproduce testStats
+	store := logstore.NewMemoryStore()
+	for i, s := range testStats {
+		store.WriteBatch(context.Background(), []models.LogEntry{{
+			Timestamp:   time.Date(2025, 7, 24, 16, i, 0, 0, time.UTC),
+			Level:       s.Level,
+			Message:     "repeated",
+			Service:     s.Service,
+			RepeatCount: uint32(s.Count),
+		}})
+	}
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
 
 	req := httptest.NewRequest("GET", "/api/stats", nil)
 	w := httptest.NewRecorder()
@@ -206,34 +178,43 @@ func TestGetStatsEndpoint(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
-	var stats []Stat
+	var stats Stats
 	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	expectedStatsCount := 4
-	if len(stats) != expectedStatsCount {
-		t.Errorf("Expected %d stats, got %d", expectedStatsCount, len(stats))
+	if stats.TotalLogs != 11 {
+		t.Errorf("Expected 11 logs in total, got %d", stats.TotalLogs)
 	}
 
 	// Verify stats structure and content
-	expectedLevels := map[string]int{
+	expectedLevels := map[string]uint64{
 		"info":  5,
 		"error": 3,
 		"warn":  2,
 		"fatal": 1,
 	}
 
-	for _, stat := range stats {
-		if expectedCount, exists := expectedLevels[stat.Level]; exists {
-			if stat.Count != expectedCount {
-				t.Errorf("Expected count %d for level %s, got %d", expectedCount, stat.Level, stat.Count)
+	if len(stats.LogsByLevel) != len(expectedLevels) {
+		t.Errorf("Expected %d levels, got %d", len(expectedLevels), len(stats.LogsByLevel))
+	}
+	for level, count := range stats.LogsByLevel {
+		if expectedCount, exists := expectedLevels[level]; exists {
+			if count != expectedCount {
+				t.Errorf("Expected count %d for level %s, got %d", expectedCount, level, count)
 			}
 		} else {
-			t.Errorf("Unexpected level in stats: %s", stat.Level)
+			t.Errorf("Unexpected level in stats: %s", level)
 		}
 	}
 
+	if stats.LogsByService["auth-service"] != 7 || stats.LogsByService["payment-api"] != 4 {
+		t.Errorf("Unexpected service counts: %v", stats.LogsByService)
+	}
+	if len(stats.TopServices) != 2 || stats.TopServices[0].Service != "auth-service" || stats.TopServices[1].ErrorRatio != 1 {
+		t.Errorf("Unexpected top services: %+v", stats.TopServices)
+	}
+
 	// Verify Content-Type header
 	expectedContentType := "application/json"
 	if ct := w.Header().Get("Content-Type"); ct != expectedContentType {
@@ -265,7 +246,7 @@ func TestCORSHeaders(t *testing.T) {
 			expectedHeaders := map[string]string{
 				"Access-Control-Allow-Origin":  "*",
 				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
-				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization, X-API-Key",
 			}
 
 			for header, expectedValue := range expectedHeaders {
@@ -317,30 +298,49 @@ func TestLogEntryJSONSerialization(t *testing.T) {
 	}
 }
 
-func TestStatJSONSerialization(t *testing.T) {
-	testStat := Stat{
-		Level: "error",
-		Count: 42,
-	}
+func TestStatsWindow(t *testing.T) {
+	router := createTestRouter()
 
-	// Test JSON marshaling
-	jsonData, err := json.Marshal(testStat)
-	if err != nil {
-		t.Fatalf("Failed to marshal Stat: %v", err)
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedTotal  uint64
+		expectedTop    int
+	}{
+		{"/api/stats?from=2025-07-24T16:01:00Z", http.StatusOK, 2, 2},
+		{"/api/stats?from=2025-07-24T16:00:00Z&to=2025-07-24T16:01:00Z", http.StatusOK, 1, 1},
+		{"/api/stats?top=1", http.StatusOK, 3, 1},
+		{"/api/stats?from=yesterday", http.StatusBadRequest, 0, 0},
+		{"/api/stats?from=2025-07-24T17:00:00Z&to=2025-07-24T16:00:00Z", http.StatusBadRequest, 0, 0},
+		{"/api/stats?top=0", http.StatusBadRequest, 0, 0},
+		{"/api/stats?top=101", http.StatusBadRequest, 0, 0},
 	}
 
-	// Test JSON unmarshaling
-	var unmarshaled Stat
-	if err := json.Unmarshal(jsonData, &unmarshaled); err != nil {
-		t.Fatalf("Failed to unmarshal Stat: %v", err)
-	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
 
-	// Verify fields
-	if unmarshaled.Level != testStat.Level {
-		t.Errorf("Expected level %s, got %s", testStat.Level, unmarshaled.Level)
-	}
-	if unmarshaled.Count != testStat.Count {
-		t.Errorf("Expected count %d, got %d", testStat.Count, unmarshaled.Count)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var stats Stats
+			if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if stats.TotalLogs != tt.expectedTotal {
+				t.Errorf("Expected %d logs, got %d", tt.expectedTotal, stats.TotalLogs)
+			}
+			if len(stats.TopServices) != tt.expectedTop || len(stats.LogsByService) != tt.expectedTop {
+				t.Errorf("Expected %d top services, got %+v", tt.expectedTop, stats.TopServices)
+			}
+		})
 	}
 }
 
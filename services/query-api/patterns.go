@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+const (
+	defaultPatternLimit = 50
+	defaultPatternRange = 24 * time.Hour
+)
+
+// patternsHandler groups entries by message template, most frequent first.
+// It takes the /api/logs parameters except offset, including ?search=, and
+// covers the last 24 hours when no range is given.
+func patternsHandler(store logstore.LogStore, searches SearchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, ok := resolveLogParams(w, r, searches)
+		if !ok {
+			return
+		}
+		if params.Get("offset") != "" {
+			http.Error(w, "offset is not supported, raise limit instead", http.StatusBadRequest)
+			return
+		}
+
+		q, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Limit == 0 {
+			q.Limit = defaultPatternLimit
+		}
+		if q.From.IsZero() && q.To.IsZero() {
+			q.From = time.Now().UTC().Add(-defaultPatternRange)
+		}
+
+		patterns, err := store.Patterns(r.Context(), q)
+		if err != nil {
+			dbError(w, r, "patterns", err)
+			return
+		}
+		if patterns == nil {
+			patterns = []logstore.Pattern{}
+		}
+		writeJSON(w, http.StatusOK, patterns)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+func TestPatternsEndpoint(t *testing.T) {
+	logs := append([]LogEntry{
+		{Timestamp: "2025-07-24T16:03:00Z", Level: "error", Message: "Payment 42 failed", Service: "payment-api"},
+		{Timestamp: "2025-07-24T16:04:00Z", Level: "error", Message: "Payment 43 failed", Service: "payment-api"},
+	}, testLogs...)
+	router := newRouter(newTestStore(logs), NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"range", "/api/patterns?from=2025-07-24T00:00:00Z", http.StatusOK, 4},
+		{"filtered", "/api/patterns?from=2025-07-24T00:00:00Z&service=payment", http.StatusOK, 2},
+		{"limit", "/api/patterns?from=2025-07-24T00:00:00Z&limit=1", http.StatusOK, 1},
+		{"last day by default", "/api/patterns", http.StatusOK, 0},
+		{"offset", "/api/patterns?offset=10", http.StatusBadRequest, 0},
+		{"bad limit", "/api/patterns?limit=5000", http.StatusBadRequest, 0},
+		{"unknown search", "/api/patterns?search=nope", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var patterns []logstore.Pattern
+			if err := json.NewDecoder(w.Body).Decode(&patterns); err != nil || patterns == nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(patterns) != tt.expectedCount {
+				t.Fatalf("expected %d patterns, got %+v", tt.expectedCount, patterns)
+			}
+			if tt.expectedCount > 0 && (patterns[0].Template != "Payment <num> failed" || patterns[0].Count != 2) {
+				t.Errorf("expected the payment pattern first, got %+v", patterns[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// PartitionUsage describes storage used by one partition of the logs table
+type PartitionUsage struct {
+	Partition   string `json:"partition"`
+	Rows        uint64 `json:"rows"`
+	BytesOnDisk uint64 `json:"bytes_on_disk"`
+	Size        string `json:"size"`
+	MinTime     string `json:"min_time"`
+	MaxTime     string `json:"max_time"`
+}
+
+// RetentionReport is returned by /api/admin/retention
+type RetentionReport struct {
+	Policy        json.RawMessage  `json:"policy"`
+	TTLExpression string           `json:"ttl_expression,omitempty"`
+	AppliedAt     string           `json:"applied_at,omitempty"`
+	AppliedBy     string           `json:"applied_by,omitempty"`
+	Partitions    []PartitionUsage `json:"partitions"`
+	TotalRows     uint64           `json:"total_rows"`
+	TotalBytes    uint64           `json:"total_bytes"`
+}
+
+// retentionHandler reports the retention policy last applied by
+// processing-svc and storage used per partition
+func retentionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		report := RetentionReport{Policy: json.RawMessage("null"), Partitions: []PartitionUsage{}}
+
+		var policy string
+		err := db.QueryRowContext(ctx, `
+			SELECT policy, ttl_expression, applied_at, applied_by
+			FROM retention_policies
+			ORDER BY applied_at DESC
+			LIMIT 1`).Scan(&policy, &report.TTLExpression, &report.AppliedAt, &report.AppliedBy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			dbError(w, r, "retention policy", err)
+			return
+		}
+		if policy != "" {
+			report.Policy = json.RawMessage(policy)
+		}
+
+		rows, err := db.QueryContext(ctx, `
+			SELECT partition, sum(rows), sum(bytes_on_disk), formatReadableSize(sum(bytes_on_disk)),
+			       min(min_time), max(max_time)
+			FROM system.parts
+			WHERE database = currentDatabase() AND table = 'logs' AND active
+			GROUP BY partition
+			ORDER BY partition`)
+		if err != nil {
+			dbError(w, r, "retention partitions", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var p PartitionUsage
+			if err := rows.Scan(&p.Partition, &p.Rows, &p.BytesOnDisk, &p.Size, &p.MinTime, &p.MaxTime); err != nil {
+				continue
+			}
+			report.TotalRows += p.Rows
+			report.TotalBytes += p.BytesOnDisk
+			report.Partitions = append(report.Partitions, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
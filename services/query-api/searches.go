@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// ownerHeader names the user or tenant a request acts for. It is expected
+	// to be set by an authenticating proxy; without it searches are shared.
+	ownerHeader = "X-Forwarded-User"
+
+	searchIDLength = 8
+	searchIDChars  = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	maxSearchBytes = 16 << 10
+	maxSearchName  = 200
+)
+
+// ErrSearchNotFound is returned for unknown or deleted saved searches
+var ErrSearchNotFound = errors.New("saved search not found")
+
+// searchFilters are the /api/logs parameters a saved query may set
+var searchFilters = map[string]bool{"level": true, "service": true, "trace_id": true}
+
+// searchColumns are the columns a saved search may show, besides attributes.<key>
+var searchColumns = map[string]bool{
+	"id": true, "timestamp": true, "level": true, "service": true, "message": true,
+	"trace_id": true, "span_id": true, "repeat_count": true,
+}
+
+// SavedSearch is a named /api/logs query. Its short ID never changes, so
+// links to it keep working when it is edited.
+type SavedSearch struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	Query     string    `json:"query"`             // filters as URL parameters, e.g. level=error&service=api
+	Range     string    `json:"range,omitempty"`   // relative range ending now, e.g. 15m
+	From      string    `json:"from,omitempty"`    // absolute range, RFC3339
+	To        string    `json:"to,omitempty"`      // absolute range, RFC3339
+	Columns   []string  `json:"columns,omitempty"` // shown in the UI, in order
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks a saved search and normalizes its query
+func (s *SavedSearch) Validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.Name) > maxSearchName {
+		return fmt.Errorf("name must be at most %d bytes", maxSearchName)
+	}
+
+	params, err := url.ParseQuery(s.Query)
+	if err != nil {
+		return fmt.Errorf("invalid query: %v", err)
+	}
+	for k := range params {
+		if !searchFilters[k] {
+			return fmt.Errorf("invalid query: unsupported parameter %q, expected level, service or trace_id", k)
+		}
+	}
+	if _, err := parseLogParams(params); err != nil {
+		return fmt.Errorf("invalid query: %v", err)
+	}
+	s.Query = params.Encode()
+
+	if s.Range != "" {
+		if s.From != "" || s.To != "" {
+			return errors.New("range and from/to are mutually exclusive")
+		}
+		if d, err := time.ParseDuration(s.Range); err != nil || d <= 0 {
+			return fmt.Errorf("invalid range %q", s.Range)
+		}
+	}
+	if _, err := parseTimeParam(s.From); err != nil {
+		return fmt.Errorf("invalid from: %v", err)
+	}
+	if _, err := parseTimeParam(s.To); err != nil {
+		return fmt.Errorf("invalid to: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range s.Columns {
+		key, isAttr := strings.CutPrefix(c, "attributes.")
+		if !searchColumns[c] && !(isAttr && key != "") {
+			return fmt.Errorf("invalid column %q", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("duplicate column %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// params returns the search as /api/logs parameters, resolving a relative
+// range against now
+func (s SavedSearch) params(now time.Time) url.Values {
+	params, _ := url.ParseQuery(s.Query)
+	if s.Range != "" {
+		d, _ := time.ParseDuration(s.Range)
+		params.Set("from", now.Add(-d).UTC().Format(time.RFC3339))
+	}
+	if s.From != "" {
+		params.Set("from", s.From)
+	}
+	if s.To != "" {
+		params.Set("to", s.To)
+	}
+	return params
+}
+
+// newSearchID returns a random short ID
+func newSearchID() string {
+	b := make([]byte, searchIDLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = searchIDChars[int(b[i])%len(searchIDChars)]
+	}
+	return string(b)
+}
+
+// SearchStore keeps saved searches
+type SearchStore interface {
+	// ListSearches returns the searches of an owner, ordered by name
+	ListSearches(ctx context.Context, owner string) ([]SavedSearch, error)
+
+	// GetSearch returns the search with the given ID or ErrSearchNotFound
+	GetSearch(ctx context.Context, id string) (SavedSearch, error)
+
+	// SaveSearch creates or replaces a search
+	SaveSearch(ctx context.Context, s SavedSearch) error
+
+	// DeleteSearch removes a search or returns ErrSearchNotFound
+	DeleteSearch(ctx context.Context, id string) error
+}
+
+// ClickHouseSearchStore keeps searches as JSON in saved_searches, a
+// ReplacingMergeTree where the highest version of an ID wins. The table is
+// created by processing-svc migrations.
+type ClickHouseSearchStore struct {
+	db *sql.DB
+}
+
+func NewClickHouseSearchStore(db *sql.DB) *ClickHouseSearchStore {
+	return &ClickHouseSearchStore{db: db}
+}
+
+func (s *ClickHouseSearchStore) ListSearches(ctx context.Context, owner string) ([]SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT argMax(search, version) AS latest_search, argMax(deleted, version) AS is_deleted
+		FROM saved_searches
+		GROUP BY id
+		HAVING is_deleted = 0 AND argMax(owner, version) = ?`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var searches []SavedSearch
+	for rows.Next() {
+		var data string
+		var deleted uint8
+		if err := rows.Scan(&data, &deleted); err != nil {
+			return nil, err
+		}
+		var search SavedSearch
+		if err := json.Unmarshal([]byte(data), &search); err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	sortSearches(searches)
+	return searches, rows.Err()
+}
+
+func (s *ClickHouseSearchStore) GetSearch(ctx context.Context, id string) (SavedSearch, error) {
+	var data string
+	var deleted uint8
+	err := s.db.QueryRowContext(ctx, `
+		SELECT argMax(search, version), argMax(deleted, version)
+		FROM saved_searches
+		WHERE id = ?
+		GROUP BY id`, id).Scan(&data, &deleted)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && deleted == 1) {
+		return SavedSearch{}, ErrSearchNotFound
+	}
+	if err != nil {
+		return SavedSearch{}, err
+	}
+	var search SavedSearch
+	err = json.Unmarshal([]byte(data), &search)
+	return search, err
+}
+
+func (s *ClickHouseSearchStore) SaveSearch(ctx context.Context, search SavedSearch) error {
+	data, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO saved_searches (id, owner, search, version, deleted) VALUES (?, ?, ?, ?, 0)`,
+		search.ID, search.Owner, string(data), uint64(time.Now().UnixNano()))
+	return err
+}
+
+func (s *ClickHouseSearchStore) DeleteSearch(ctx context.Context, id string) error {
+	search, err := s.GetSearch(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO saved_searches (id, owner, search, version, deleted) VALUES (?, ?, '', ?, 1)`,
+		id, search.Owner, uint64(time.Now().UnixNano()))
+	return err
+}
+
+// MemorySearchStore keeps searches in memory, for tests
+type MemorySearchStore struct {
+	mu       sync.Mutex
+	searches map[string]SavedSearch
+}
+
+func NewMemorySearchStore(searches ...SavedSearch) *MemorySearchStore {
+	s := &MemorySearchStore{searches: make(map[string]SavedSearch)}
+	for _, search := range searches {
+		s.searches[search.ID] = search
+	}
+	return s
+}
+
+func (s *MemorySearchStore) ListSearches(ctx context.Context, owner string) ([]SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var searches []SavedSearch
+	for _, search := range s.searches {
+		if search.Owner == owner {
+			searches = append(searches, search)
+		}
+	}
+	sortSearches(searches)
+	return searches, nil
+}
+
+func (s *MemorySearchStore) GetSearch(ctx context.Context, id string) (SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	search, ok := s.searches[id]
+	if !ok {
+		return SavedSearch{}, ErrSearchNotFound
+	}
+	return search, nil
+}
+
+func (s *MemorySearchStore) SaveSearch(ctx context.Context, search SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches[search.ID] = search
+	return nil
+}
+
+func (s *MemorySearchStore) DeleteSearch(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.searches[id]; !ok {
+		return ErrSearchNotFound
+	}
+	delete(s.searches, id)
+	return nil
+}
+
+func sortSearches(searches []SavedSearch) {
+	sort.Slice(searches, func(i, j int) bool {
+		if searches[i].Name != searches[j].Name {
+			return searches[i].Name < searches[j].Name
+		}
+		return searches[i].ID < searches[j].ID
+	})
+}
+
+// searchRoutes serves /api/searches. Anyone with an ID can read a search;
+// only its owner can change or delete it.
+func searchRoutes(r chi.Router, searches SearchStore) {
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		list, err := searches.ListSearches(r.Context(), r.Header.Get(ownerHeader))
+		if err != nil {
+			log.Printf("DB error (list searches): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []SavedSearch{}
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		search, ok := decodeSearch(w, r)
+		if !ok {
+			return
+		}
+		// Retry the unlikely collision rather than overwrite another search
+		for {
+			search.ID = newSearchID()
+			_, err := searches.GetSearch(r.Context(), search.ID)
+			if errors.Is(err, ErrSearchNotFound) {
+				break
+			}
+			if err != nil {
+				log.Printf("DB error (get search): %v", err)
+				http.Error(w, "db error", http.StatusInternalServerError)
+				return
+			}
+		}
+		search.Owner = r.Header.Get(ownerHeader)
+		search.CreatedAt = time.Now().UTC()
+		search.UpdatedAt = search.CreatedAt
+		if err := searches.SaveSearch(r.Context(), search); err != nil {
+			log.Printf("DB error (save search): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, search)
+	})
+
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if search, ok := loadSearch(w, r, searches); ok {
+			writeJSON(w, http.StatusOK, search)
+		}
+	})
+
+	r.Put("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		existing, ok := loadOwnSearch(w, r, searches)
+		if !ok {
+			return
+		}
+		search, ok := decodeSearch(w, r)
+		if !ok {
+			return
+		}
+		search.ID, search.Owner, search.CreatedAt = existing.ID, existing.Owner, existing.CreatedAt
+		search.UpdatedAt = time.Now().UTC()
+		if err := searches.SaveSearch(r.Context(), search); err != nil {
+			log.Printf("DB error (save search): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, search)
+	})
+
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		search, ok := loadOwnSearch(w, r, searches)
+		if !ok {
+			return
+		}
+		if err := searches.DeleteSearch(r.Context(), search.ID); err != nil && !errors.Is(err, ErrSearchNotFound) {
+			log.Printf("DB error (delete search): %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// decodeSearch reads and validates a saved search from the request body
+func decodeSearch(w http.ResponseWriter, r *http.Request) (SavedSearch, bool) {
+	var search SavedSearch
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSearchBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&search); err != nil {
+		http.Error(w, "invalid search: "+err.Error(), http.StatusBadRequest)
+		return search, false
+	}
+	if err := search.Validate(); err != nil {
+		http.Error(w, "invalid search: "+err.Error(), http.StatusBadRequest)
+		return search, false
+	}
+	return search, true
+}
+
+func loadSearch(w http.ResponseWriter, r *http.Request, searches SearchStore) (SavedSearch, bool) {
+	search, err := searches.GetSearch(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrSearchNotFound) {
+		http.Error(w, "saved search not found", http.StatusNotFound)
+		return search, false
+	}
+	if err != nil {
+		log.Printf("DB error (get search): %v", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return search, false
+	}
+	return search, true
+}
+
+// loadOwnSearch loads a search the requester may change
+func loadOwnSearch(w http.ResponseWriter, r *http.Request, searches SearchStore) (SavedSearch, bool) {
+	search, ok := loadSearch(w, r, searches)
+	if ok && search.Owner != r.Header.Get(ownerHeader) {
+		http.Error(w, "saved search belongs to another user", http.StatusForbidden)
+		return search, false
+	}
+	return search, ok
+}
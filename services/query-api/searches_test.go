@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSavedSearchValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		search   SavedSearch
+		expected string
+	}{
+		{"filters", SavedSearch{Name: "payment errors", Query: "service=payment-api&level=error", Range: "15m"}, ""},
+		{"absolute range", SavedSearch{Name: "incident", From: "2025-07-24T16:00:00Z", To: "2025-07-24T17:00:00Z"}, ""},
+		{"columns", SavedSearch{Name: "x", Columns: []string{"timestamp", "message", "attributes.region"}}, ""},
+		{"no name", SavedSearch{Name: " "}, "name is required"},
+		{"unsupported parameter", SavedSearch{Name: "x", Query: "limit=5"}, "unsupported parameter"},
+		{"bad trace", SavedSearch{Name: "x", Query: "trace_id=abc"}, "invalid trace_id"},
+		{"bad range", SavedSearch{Name: "x", Range: "-5m"}, "invalid range"},
+		{"range and from", SavedSearch{Name: "x", Range: "5m", From: "2025-07-24T16:00:00Z"}, "mutually exclusive"},
+		{"bad from", SavedSearch{Name: "x", From: "yesterday"}, "invalid from"},
+		{"bad column", SavedSearch{Name: "x", Columns: []string{"host"}}, "invalid column"},
+		{"empty attribute column", SavedSearch{Name: "x", Columns: []string{"attributes."}}, "invalid column"},
+		{"duplicate column", SavedSearch{Name: "x", Columns: []string{"level", "level"}}, "duplicate column"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.search.Validate()
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatalf("expected valid search, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Fatalf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// Queries are stored in canonical order
+	s := SavedSearch{Name: "x", Query: "service=api&level=error"}
+	if err := s.Validate(); err != nil || s.Query != "level=error&service=api" {
+		t.Errorf("expected a normalized query, got %q (%v)", s.Query, err)
+	}
+}
+
+func TestSearchCRUD(t *testing.T) {
+	router := createTestRouter()
+	do := func(method, url, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set(ownerHeader, user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/searches", "alice", `{"name":"payment errors","query":"level=error&service=payment","columns":["timestamp","message"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created SavedSearch
+	json.NewDecoder(w.Body).Decode(&created)
+	if len(created.ID) != searchIDLength || created.Owner != "alice" || created.CreatedAt.IsZero() {
+		t.Fatalf("unexpected search: %+v", created)
+	}
+
+	tests := []struct {
+		name           string
+		method, url    string
+		user, body     string
+		expectedStatus int
+	}{
+		{"get by anyone", "GET", "/api/searches/" + created.ID, "bob", "", http.StatusOK},
+		{"get unknown", "GET", "/api/searches/nope", "", "", http.StatusNotFound},
+		{"invalid", "POST", "/api/searches", "alice", `{"name":"x","query":"offset=5"}`, http.StatusBadRequest},
+		{"unknown field", "POST", "/api/searches", "alice", `{"name":"x","filters":"level=error"}`, http.StatusBadRequest},
+		{"update by another user", "PUT", "/api/searches/" + created.ID, "bob", `{"name":"mine"}`, http.StatusForbidden},
+		{"delete by another user", "DELETE", "/api/searches/" + created.ID, "", "", http.StatusForbidden},
+		{"search unknown", "GET", "/api/logs?search=nope", "", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.url, tt.user, tt.body); w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Lists are per owner
+	var list []SavedSearch
+	json.NewDecoder(do("GET", "/api/searches", "alice", "").Body).Decode(&list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("expected alice's search, got %+v", list)
+	}
+	json.NewDecoder(do("GET", "/api/searches", "bob", "").Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("expected no searches for bob, got %+v", list)
+	}
+
+	// The ID survives updates
+	w = do("PUT", "/api/searches/"+created.ID, "alice", `{"name":"all errors","query":"level=error"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated SavedSearch
+	json.NewDecoder(w.Body).Decode(&updated)
+	if updated.ID != created.ID || updated.Owner != "alice" || !updated.CreatedAt.Equal(created.CreatedAt) || updated.Columns != nil {
+		t.Errorf("unexpected update: %+v", updated)
+	}
+
+	if w := do("DELETE", "/api/searches/"+created.ID, "alice", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if w := do("GET", "/api/searches/"+created.ID, "alice", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected deleted search to be gone, got %d", w.Code)
+	}
+}
+
+func TestLogsBySavedSearch(t *testing.T) {
+	searches := NewMemorySearchStore(
+		SavedSearch{ID: "errors01", Name: "errors", Query: "level=error"},
+		SavedSearch{ID: "window01", Name: "window", From: "2025-07-24T16:01:30Z", To: "2025-07-24T16:05:00Z"},
+		SavedSearch{ID: "recent01", Name: "recent", Range: "15m"},
+	)
+	router := newRouter(newTestStore(testLogs), searches, newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name     string
+		url      string
+		expected []string
+	}{
+		{"filters", "/api/logs?search=errors01", []string{"Payment failed"}},
+		{"absolute range", "/api/logs?search=window01", []string{"High CPU usage"}},
+		{"relative range", "/api/logs?search=recent01", nil},
+		{"override", "/api/logs?search=errors01&level=info", []string{"User login successful"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var logs []LogEntry
+			json.NewDecoder(w.Body).Decode(&logs)
+			if len(logs) != len(tt.expected) {
+				t.Fatalf("expected %d logs, got %+v", len(tt.expected), logs)
+			}
+			for i, l := range logs {
+				if l.Message != tt.expected[i] {
+					t.Errorf("log %d: expected %q, got %q", i, tt.expected[i], l.Message)
+				}
+			}
+		})
+	}
+
+	// Relative ranges end at the time of the request
+	now := time.Date(2025, 7, 24, 16, 10, 0, 0, time.UTC)
+	params := SavedSearch{Range: "15m"}.params(now)
+	if params.Get("from") != "2025-07-24T15:55:00Z" || params.Get("to") != "" {
+		t.Errorf("unexpected range parameters: %v", params)
+	}
+}
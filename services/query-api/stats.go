@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+const (
+	defaultTopServices = 10
+	maxTopServices     = 100
+
+	defaultSeriesRange = 24 * time.Hour
+	targetSeriesPoints = 300
+	maxSeriesPoints    = 1000
+)
+
+// seriesIntervals are the bucket widths chosen from the range of a series.
+// Whole minutes and hours are read from the rollups.
+var seriesIntervals = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// Stats summarises the entries of a time window
+type Stats struct {
+	From          time.Time         `json:"from,omitzero"`
+	To            time.Time         `json:"to,omitzero"`
+	TotalLogs     uint64            `json:"total_logs"`
+	LogsByLevel   map[string]uint64 `json:"logs_by_level"`
+	LogsByService map[string]uint64 `json:"logs_by_service"` // the top services only
+	TopServices   []ServiceStat     `json:"top_services"`
+}
+
+// ServiceStat is the volume of one service. Errors counts error and fatal
+// entries.
+type ServiceStat struct {
+	Service    string  `json:"service"`
+	Count      uint64  `json:"count"`
+	Errors     uint64  `json:"errors"`
+	ErrorRatio float64 `json:"error_ratio"`
+}
+
+// Timeseries is entry counts per bucket of a time window
+type Timeseries struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Interval string            `json:"interval"`
+	Buckets  []logstore.Bucket `json:"buckets"`
+}
+
+// seriesInterval returns the narrowest interval giving at most
+// targetSeriesPoints buckets over span
+func seriesInterval(span time.Duration) time.Duration {
+	for _, interval := range seriesIntervals {
+		if span/interval <= targetSeriesPoints {
+			return interval
+		}
+	}
+	return seriesIntervals[len(seriesIntervals)-1]
+}
+
+// computeStats folds counts grouped by service and level into Stats with the
+// top services by volume
+func computeStats(buckets []logstore.Bucket, top int) Stats {
+	stats := Stats{LogsByLevel: make(map[string]uint64), LogsByService: make(map[string]uint64)}
+	services := make(map[string]*ServiceStat)
+	for _, b := range buckets {
+		level, service := b.Keys["level"], b.Keys["service"]
+		stats.TotalLogs += b.Count
+		stats.LogsByLevel[level] += b.Count
+
+		s, ok := services[service]
+		if !ok {
+			s = &ServiceStat{Service: service}
+			services[service] = s
+		}
+		s.Count += b.Count
+		if level == "error" || level == "fatal" {
+			s.Errors += b.Count
+		}
+	}
+
+	stats.TopServices = make([]ServiceStat, 0, len(services))
+	for _, s := range services {
+		s.ErrorRatio = float64(s.Errors) / float64(s.Count)
+		stats.TopServices = append(stats.TopServices, *s)
+	}
+	sort.Slice(stats.TopServices, func(i, j int) bool {
+		a, b := stats.TopServices[i], stats.TopServices[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Service < b.Service
+	})
+	if len(stats.TopServices) > top {
+		stats.TopServices = stats.TopServices[:top]
+	}
+	for _, s := range stats.TopServices {
+		stats.LogsByService[s.Service] = s.Count
+	}
+	return stats
+}
+
+// statsHandler reports volumes over ?from= and ?to=, all time by default.
+// Whole hours are read from the hourly rollup rather than from logs.
+func statsHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		from, err := parseTimeParam(params.Get("from"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+		to, err := parseTimeParam(params.Get("to"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			http.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+		top, err := parseIntParam(params.Get("top"), 1, maxTopServices)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid top: %v", err), http.StatusBadRequest)
+			return
+		}
+		if top == 0 {
+			top = defaultTopServices
+		}
+
+		buckets, err := store.Aggregate(r.Context(), logstore.AggregateQuery{
+			Query:   logstore.Query{From: from, To: to},
+			GroupBy: []string{"service", "level"},
+		})
+		if err != nil {
+			dbError(w, r, "stats", err)
+			return
+		}
+		stats := computeStats(buckets, top)
+		stats.From, stats.To = from, to
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
+
+// timeseriesHandler counts entries per interval over ?from= and ?to=, the
+// last 24 hours by default, grouped by ?group_by= level (the default) and
+// service. Without ?interval= the width comes from the range, so long
+// ranges are read from the hourly rollup and short ones from the per-minute
+// one.
+func timeseriesHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q, err := parseLogParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Every bucket is returned
+		q.Limit, q.Offset = 0, 0
+		if q.To.IsZero() {
+			q.To = time.Now().UTC().Truncate(time.Second)
+		}
+		if q.From.IsZero() {
+			q.From = q.To.Add(-defaultSeriesRange)
+		}
+		if !q.From.Before(q.To) {
+			http.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+
+		interval := seriesInterval(q.To.Sub(q.From))
+		if v := params.Get("interval"); v != "" {
+			if interval, err = time.ParseDuration(v); err != nil || interval < time.Second || interval%time.Second != 0 {
+				http.Error(w, "invalid interval, expected whole seconds such as 30s or 5m", http.StatusBadRequest)
+				return
+			}
+			if q.To.Sub(q.From)/interval > maxSeriesPoints {
+				http.Error(w, fmt.Sprintf("interval too small, the range would have more than %d buckets", maxSeriesPoints), http.StatusBadRequest)
+				return
+			}
+		}
+
+		groupBy := []string{"level"}
+		if v, ok := params["group_by"]; ok {
+			groupBy = nil
+			for _, field := range strings.Split(v[0], ",") {
+				switch field {
+				case "":
+				case "level", "service":
+					groupBy = append(groupBy, field)
+				default:
+					http.Error(w, fmt.Sprintf("cannot group by %q", field), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		buckets, err := store.Aggregate(r.Context(), logstore.AggregateQuery{Query: q, GroupBy: groupBy, Interval: interval})
+		if err != nil {
+			dbError(w, r, "timeseries", err)
+			return
+		}
+		if buckets == nil {
+			buckets = []logstore.Bucket{}
+		}
+		writeJSON(w, http.StatusOK, Timeseries{From: q.From, To: q.To, Interval: interval.String(), Buckets: buckets})
+	}
+}
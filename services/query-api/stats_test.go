@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSeriesInterval(t *testing.T) {
+	tests := []struct {
+		span     time.Duration
+		expected time.Duration
+	}{
+		{time.Hour, time.Minute},
+		{5 * time.Hour, time.Minute},
+		{24 * time.Hour, 5 * time.Minute},
+		{7 * 24 * time.Hour, time.Hour},
+		{90 * 24 * time.Hour, 12 * time.Hour},
+		{10 * 365 * 24 * time.Hour, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := seriesInterval(tt.span); got != tt.expected {
+			t.Errorf("seriesInterval(%v) = %v, expected %v", tt.span, got, tt.expected)
+		}
+	}
+}
+
+func TestTimeseriesEndpoint(t *testing.T) {
+	router := createTestRouter()
+
+	tests := []struct {
+		name             string
+		url              string
+		expectedStatus   int
+		expectedInterval string
+		expectedBuckets  int
+	}{
+		{"auto interval", "/api/stats/timeseries?from=2025-07-24T16:00:00Z&to=2025-07-24T17:00:00Z", http.StatusOK, "1m0s", 3},
+		{"hourly", "/api/stats/timeseries?from=2025-07-24T00:00:00Z&to=2025-07-25T00:00:00Z&interval=1h&group_by=", http.StatusOK, "1h0m0s", 1},
+		{"by service", "/api/stats/timeseries?from=2025-07-24T16:00:00Z&to=2025-07-24T17:00:00Z&interval=1h&group_by=service,level&level=error", http.StatusOK, "1h0m0s", 1},
+		{"default range", "/api/stats/timeseries", http.StatusOK, "5m0s", 0},
+		{"bad interval", "/api/stats/timeseries?interval=1.5s", http.StatusBadRequest, "", 0},
+		{"too many buckets", "/api/stats/timeseries?interval=1m&from=2025-07-01T00:00:00Z&to=2025-07-24T00:00:00Z", http.StatusBadRequest, "", 0},
+		{"bad group", "/api/stats/timeseries?group_by=message", http.StatusBadRequest, "", 0},
+		{"empty range", "/api/stats/timeseries?from=2025-07-24T16:00:00Z&to=2025-07-24T16:00:00Z", http.StatusBadRequest, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var series Timeseries
+			if err := json.NewDecoder(w.Body).Decode(&series); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if series.Interval != tt.expectedInterval || len(series.Buckets) != tt.expectedBuckets {
+				t.Errorf("expected %d buckets of %s, got %+v", tt.expectedBuckets, tt.expectedInterval, series)
+			}
+			if series.Buckets == nil {
+				t.Error("expected an empty array rather than null")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yourusername/oglogstream-logstore"
+)
+
+// TraceResponse holds every entry of a trace, oldest first
+type TraceResponse struct {
+	TraceID  string     `json:"trace_id"`
+	Services []string   `json:"services"`
+	Entries  []LogEntry `json:"entries"`
+}
+
+// traceHandler serves /api/traces/{traceID}
+func traceHandler(store logstore.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		traceID := strings.ToLower(chi.URLParam(r, "traceID"))
+		if !isTraceID(traceID) {
+			http.Error(w, "invalid trace id, expected 32 hex characters", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseIntParam(r.URL.Query().Get("limit"), 0, logstore.MaxLimit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := store.Trace(r.Context(), traceID, limit)
+		if err != nil {
+			dbError(w, r, "trace", err)
+			return
+		}
+		if len(entries) == 0 {
+			http.Error(w, "trace not found", http.StatusNotFound)
+			return
+		}
+
+		// Services in the order they first appear in the trace
+		services := []string{}
+		seen := map[string]bool{}
+		for _, e := range entries {
+			if !seen[e.Service] {
+				seen[e.Service] = true
+				services = append(services, e.Service)
+			}
+		}
+		writeJSON(w, http.StatusOK, TraceResponse{
+			TraceID:  traceID,
+			Services: services,
+			Entries:  toLogEntries(entries),
+		})
+	}
+}
+
+// isTraceID reports whether s is a W3C trace ID: 32 lowercase hex characters,
+// not all zero
+func isTraceID(s string) bool {
+	if len(s) != 32 || s == strings.Repeat("0", 32) {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
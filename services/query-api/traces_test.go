@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yourusername/oglogstream-logstore"
+	"github.com/yourusername/oglogstream-models"
+)
+
+func TestTrace(t *testing.T) {
+	const trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ts := time.Date(2025, 7, 24, 16, 0, 0, 0, time.UTC)
+	store := logstore.NewMemoryStore(
+		models.LogEntry{Timestamp: ts.Add(2 * time.Second), Level: "error", Message: "charge failed", Service: "payment-api", TraceID: trace, SpanID: "00f067aa0ba902b7"},
+		models.LogEntry{Timestamp: ts, Level: "info", Message: "checkout started", Service: "web", TraceID: trace},
+		models.LogEntry{Timestamp: ts.Add(time.Second), Level: "info", Message: "cart loaded", Service: "web", TraceID: trace},
+		models.LogEntry{Timestamp: ts, Level: "info", Message: "unrelated", Service: "web", TraceID: "0af7651916cd43dd8448eb211c80319c"},
+	)
+	router := newRouter(store, NewMemorySearchStore(), newHub(), DefaultQueryConfig())
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		messages       string
+	}{
+		{"across services", "/api/traces/" + trace, http.StatusOK, "[checkout started cart loaded charge failed]"},
+		{"uppercase", "/api/traces/4BF92F3577B34DA6A3CE929D0E0E4736?limit=1", http.StatusOK, "[checkout started]"},
+		{"unknown", "/api/traces/11111111111111111111111111111111", http.StatusNotFound, ""},
+		{"malformed", "/api/traces/abc", http.StatusBadRequest, ""},
+		{"all zero", "/api/traces/00000000000000000000000000000000", http.StatusBadRequest, ""},
+		{"bad limit", "/api/traces/" + trace + "?limit=5000", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp TraceResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var got []string
+			for _, e := range resp.Entries {
+				got = append(got, e.Message)
+			}
+			if fmt.Sprint(got) != tt.messages {
+				t.Errorf("expected %s, got %v", tt.messages, got)
+			}
+			if resp.TraceID != trace {
+				t.Errorf("expected trace %s, got %s", trace, resp.TraceID)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/traces/"+trace, nil))
+	var resp TraceResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if fmt.Sprint(resp.Services) != "[web payment-api]" || resp.Entries[2].SpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected services or span: %+v", resp)
+	}
+}